@@ -27,12 +27,13 @@ func init() {
 
 type Conn struct {
 	*redis.Client
-	Id       string
-	ctx      context.Context
-	host     string
-	dbname   int
-	channels map[string]*redis.PubSub
-	mutex    *sync.RWMutex
+	Id        string
+	ctx       context.Context
+	host      string
+	dbname    int
+	channels  map[string]*redis.PubSub
+	consumers map[string]context.CancelFunc
+	mutex     *sync.RWMutex
 }
 
 /**
@@ -56,6 +57,7 @@ func LoadTo(params utility.Config) error {
 	host := params.GetStr("REDIS_HOST", "")
 	password := params.GetStr("REDIS_PASSWORD", "")
 	dbname := params.GetInt("REDIS_DB", 0)
+	SetPrefix(params.GetStr("REDIS_PREFIX", Prefix()))
 
 	var err error
 	conn, err = connectTo(host, password, dbname)
@@ -82,6 +84,7 @@ func Load() error {
 		"REDIS_HOST":     "",
 		"REDIS_PASSWORD": "",
 		"REDIS_DB":       0,
+		"REDIS_PREFIX":   "",
 	})
 	err := LoadTo(params)
 	if err != nil {
@@ -100,6 +103,13 @@ func Close() {
 		return
 	}
 
+	conn.mutex.Lock()
+	for key, cancel := range conn.consumers {
+		cancel()
+		delete(conn.consumers, key)
+	}
+	conn.mutex.Unlock()
+
 	conn.Close()
 
 	logs.Log(packageName, `Disconnect...`)
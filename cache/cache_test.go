@@ -0,0 +1,21 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/cgalvisleon/et/envar"
+)
+
+/**
+* loadTest: Connects to the Redis service of REDIS_HOST, skipping the test when it is not set.
+* @param t *testing.T
+**/
+func loadTest(t *testing.T) {
+	t.Helper()
+	if envar.GetStr("REDIS_HOST", "") == "" {
+		t.Skip("REDIS_HOST is not set")
+	}
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/cgalvisleon/et/reg"
+	"github.com/cgalvisleon/et/utility"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+/**
+* Codec: Serializes the values written by SetAs and read by GetAs.
+**/
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                       { return "json" }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string                       { return "msgpack" }
+func (msgpackCodec) Marshal(v any) ([]byte, error)      { return msgpack.Marshal(v) }
+func (msgpackCodec) Unmarshal(data []byte, v any) error { return msgpack.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+var (
+	JSON    Codec = jsonCodec{}
+	Msgpack Codec = msgpackCodec{}
+	Gob     Codec = gobCodec{}
+)
+
+var (
+	optionsMu sync.RWMutex
+	codec     = JSON
+	prefix    = ""
+	// compressAbove is the encoded size in bytes from which values are gzipped, 0 disables it.
+	compressAbove = 0
+	gzipMagic     = []byte{0x1f, 0x8b}
+)
+
+/**
+* SetCodec: Sets the serialization used by the typed accessors.
+* @param c Codec
+**/
+func SetCodec(c Codec) {
+	if c == nil {
+		return
+	}
+
+	optionsMu.Lock()
+	codec = c
+	optionsMu.Unlock()
+}
+
+/**
+* SetCompression: Gzips typed values whose encoded size reaches threshold bytes, 0 disables it.
+* @param threshold int
+**/
+func SetCompression(threshold int) {
+	optionsMu.Lock()
+	compressAbove = threshold
+	optionsMu.Unlock()
+}
+
+/**
+* SetPrefix: Sets the service namespace prepended to the keys built with Key and
+* to the keys of the typed accessors.
+* @param val string
+**/
+func SetPrefix(val string) {
+	optionsMu.Lock()
+	prefix = val
+	optionsMu.Unlock()
+}
+
+/**
+* Prefix
+* @return string
+**/
+func Prefix() string {
+	optionsMu.RLock()
+	defer optionsMu.RUnlock()
+
+	return prefix
+}
+
+/**
+* Key: Builds a cache key from args inside the service namespace.
+* @params args ...interface{}
+* @return string
+**/
+func Key(args ...interface{}) string {
+	result := utility.ToBase64(reg.GenKey(args...))
+	if p := Prefix(); p != "" {
+		return p + ":" + result
+	}
+
+	return result
+}
+
+/**
+* namespaced: Prepends the service namespace to key unless it already carries it.
+* @param key string
+* @return string
+**/
+func namespaced(key string) string {
+	p := Prefix()
+	if p == "" || strings.HasPrefix(key, p+":") {
+		return key
+	}
+
+	return p + ":" + key
+}
+
+/**
+* encode: Serializes v with the current codec, gzipping it over the threshold.
+* @param v any
+* @return []byte, error
+**/
+func encode(v any) ([]byte, error) {
+	optionsMu.RLock()
+	c, threshold := codec, compressAbove
+	optionsMu.RUnlock()
+
+	bt, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if threshold <= 0 || len(bt) < threshold {
+		return bt, nil
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(bt); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+/**
+* decode: Decompresses gzipped data and deserializes it into v with the current codec.
+* @param data []byte, v any
+* @return error
+**/
+func decode(data []byte, v any) error {
+	optionsMu.RLock()
+	c := codec
+	optionsMu.RUnlock()
+
+	if bytes.HasPrefix(data, gzipMagic) {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		data, err = io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.Unmarshal(data, v)
+}
@@ -29,6 +29,7 @@ func connectTo(host, password string, db int) (*Conn, error) {
 		MinRetryBackoff: 1 * time.Second,
 		MaxRetryBackoff: 2 * time.Second,
 	})
+	client.AddHook(traceHook{})
 
 	ctx := context.Background()
 	_, err := client.Ping(ctx).Result()
@@ -39,12 +40,13 @@ func connectTo(host, password string, db int) (*Conn, error) {
 	logs.Logf("Redis", "Connected host:%s", host)
 
 	return &Conn{
-		Client:   client,
-		Id:       utility.UUID(),
-		ctx:      ctx,
-		host:     host,
-		dbname:   db,
-		channels: make(map[string]*redis.PubSub),
-		mutex:    &sync.RWMutex{},
+		Client:    client,
+		Id:        utility.UUID(),
+		ctx:       ctx,
+		host:      host,
+		dbname:    db,
+		channels:  make(map[string]*redis.PubSub),
+		consumers: make(map[string]context.CancelFunc),
+		mutex:     &sync.RWMutex{},
 	}, nil
 }
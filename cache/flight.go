@@ -0,0 +1,56 @@
+package cache
+
+import "sync"
+
+type flightCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+/**
+* flight: Collapses concurrent loads of the same key into a single call.
+**/
+type flight struct {
+	calls map[string]*flightCall
+	mu    sync.Mutex
+}
+
+/**
+* newFlight
+* @return *flight
+**/
+func newFlight() *flight {
+	return &flight{
+		calls: make(map[string]*flightCall),
+	}
+}
+
+/**
+* do: Runs fn once per key while callers are waiting; every waiter gets the same result.
+* @param key string, fn func() (interface{}, error)
+* @return interface{}, bool, error
+**/
+func (s *flight) do(key string, fn func() (interface{}, error)) (interface{}, bool, error) {
+	s.mu.Lock()
+	if call, ok := s.calls[key]; ok {
+		s.mu.Unlock()
+		call.wg.Wait()
+		return call.val, true, call.err
+	}
+
+	call := &flightCall{}
+	call.wg.Add(1)
+	s.calls[key] = call
+	s.mu.Unlock()
+
+	defer func() {
+		call.wg.Done()
+		s.mu.Lock()
+		delete(s.calls, key)
+		s.mu.Unlock()
+	}()
+
+	call.val, call.err = fn()
+	return call.val, false, call.err
+}
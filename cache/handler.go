@@ -9,53 +9,62 @@ import (
 
 	"github.com/cgalvisleon/et/et"
 	"github.com/cgalvisleon/et/msg"
-	"github.com/cgalvisleon/et/reg"
 	"github.com/cgalvisleon/et/response"
-	"github.com/cgalvisleon/et/utility"
 	"github.com/redis/go-redis/v9"
 )
 
 const IsNil = redis.Nil
 
 /**
-* SetDuration
-* @params key string, val interface{}, expMilisecond int64
-* @return interface{}
+* valueStr: Returns the string representation stored in the cache for val.
+* @params val interface{}
+* @return string, bool
 **/
-func SetDuration(key string, val interface{}, expiration time.Duration) interface{} {
-	if conn == nil {
-		return val
-	}
-
+func valueStr(val interface{}) (string, bool) {
 	switch v := val.(type) {
 	case et.Json:
-		return SetCtx(conn.ctx, key, v.ToString(), expiration)
+		return v.ToString(), true
 	case et.Items:
-		return SetCtx(conn.ctx, key, v.ToString(), expiration)
+		return v.ToString(), true
 	case et.Item:
-		return SetCtx(conn.ctx, key, v.ToString(), expiration)
+		return v.ToString(), true
 	case int:
-		return SetCtx(conn.ctx, key, fmt.Sprintf(`%d`, v), expiration)
+		return fmt.Sprintf(`%d`, v), true
 	case int64:
-		return SetCtx(conn.ctx, key, fmt.Sprintf(`%d`, v), expiration)
+		return fmt.Sprintf(`%d`, v), true
 	case float64:
-		return SetCtx(conn.ctx, key, fmt.Sprintf(`%f`, v), expiration)
+		return fmt.Sprintf(`%f`, v), true
 	case bool:
-		return SetCtx(conn.ctx, key, fmt.Sprintf(`%t`, v), expiration)
+		return fmt.Sprintf(`%t`, v), true
 	case []byte:
-		return SetCtx(conn.ctx, key, string(v), expiration)
+		return string(v), true
 	case time.Time:
-		return SetCtx(conn.ctx, key, v.Format(time.RFC3339), expiration)
+		return v.Format(time.RFC3339), true
 	case time.Duration:
-		return SetCtx(conn.ctx, key, v.String(), expiration)
-	default:
-		s, ok := v.(string)
-		if ok {
-			return SetCtx(conn.ctx, key, s, expiration)
-		}
+		return v.String(), true
+	case string:
+		return v, true
 	}
 
-	return nil
+	return "", false
+}
+
+/**
+* SetDuration
+* @params key string, val interface{}, expMilisecond int64
+* @return interface{}
+**/
+func SetDuration(key string, val interface{}, expiration time.Duration) interface{} {
+	if conn == nil {
+		return val
+	}
+
+	str, ok := valueStr(val)
+	if !ok {
+		return nil
+	}
+
+	return SetCtx(conn.ctx, key, str, expiration)
 }
 
 /**
@@ -410,23 +419,13 @@ func ObjetDelete(name, key string) error {
 	return CollectionDelete(name, key)
 }
 
-/**
-* genKey
-* @params args ...interface{}
-* @return string
-**/
-func genKey(args ...interface{}) string {
-	result := reg.GenKey(args...)
-	return utility.ToBase64(result)
-}
-
 /**
 * SetVerify
 * @params device string, key string, val string, expiration time.Duration
 * @return interface{}
 **/
 func SetVerify(device, key, val string, expiration time.Duration) interface{} {
-	key = genKey("verify", device, key)
+	key = Key("verify", device, key)
 	return Set(key, val, expiration)
 }
 
@@ -436,7 +435,7 @@ func SetVerify(device, key, val string, expiration time.Duration) interface{} {
 * @return string, error
 **/
 func GetVerify(device string, key string) (string, error) {
-	key = genKey("verify", device, key)
+	key = Key("verify", device, key)
 	result, err := Get(key, "")
 	if err != nil {
 		return "", err
@@ -453,7 +452,7 @@ func GetVerify(device string, key string) (string, error) {
 * @return int64, error
 **/
 func DeleteVerify(device string, key string) (int64, error) {
-	key = genKey("verify", device, key)
+	key = Key("verify", device, key)
 	return Delete(key)
 }
 
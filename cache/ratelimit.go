@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cgalvisleon/et/msg"
+	"github.com/cgalvisleon/et/reg"
+	"github.com/cgalvisleon/et/timezone"
+	"github.com/redis/go-redis/v9"
+)
+
+type RateAlgorithm string
+
+const (
+	SlidingWindow RateAlgorithm = "sliding_window"
+	TokenBucket   RateAlgorithm = "token_bucket"
+)
+
+/**
+* slidingWindowScript: Sliding-window log over a sorted set scored by request time (ms).
+* KEYS[1] key, ARGV[1] now, ARGV[2] window, ARGV[3] limit, ARGV[4] member
+* Returns {allowed, remaining, retry_after_ms, reset_ms}
+**/
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", key, 0, now - window)
+local count = redis.call("ZCARD", key)
+if count < limit then
+	redis.call("ZADD", key, now, ARGV[4])
+	redis.call("PEXPIRE", key, window)
+	return {1, limit - count - 1, 0, window}
+end
+local oldest = redis.call("ZRANGE", key, 0, 0, "WITHSCORES")
+local retry = window
+if oldest[2] then
+	retry = tonumber(oldest[2]) + window - now
+end
+if retry < 0 then
+	retry = 0
+end
+return {0, 0, retry, retry}
+`)
+
+/**
+* tokenBucketScript: Token bucket stored as a hash with the token count and last refill time (ms).
+* KEYS[1] key, ARGV[1] now, ARGV[2] capacity, ARGV[3] refill rate in tokens per ms
+* Returns {allowed, remaining, retry_after_ms, reset_ms}
+**/
+var tokenBucketScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local rate = tonumber(ARGV[3])
+local state = redis.call("HMGET", key, "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+	tokens = capacity
+	ts = now
+end
+local elapsed = math.max(0, now - ts)
+tokens = math.min(capacity, tokens + elapsed * rate)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+local reset = math.ceil((capacity - tokens) / rate)
+redis.call("HSET", key, "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", key, math.max(1, reset))
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+/**
+* RateLimit: Defines a rate limit rule.
+* Limit requests are allowed per Window. For TokenBucket, Burst is the bucket
+* capacity and defaults to Limit.
+**/
+type RateLimit struct {
+	Algorithm RateAlgorithm `json:"algorithm"`
+	Limit     int64         `json:"limit"`
+	Window    time.Duration `json:"window"`
+	Burst     int64         `json:"burst"`
+}
+
+/**
+* RateResult: Outcome of a rate limit check.
+**/
+type RateResult struct {
+	Allowed    bool          `json:"allowed"`
+	Limit      int64         `json:"limit"`
+	Remaining  int64         `json:"remaining"`
+	Reset      time.Duration `json:"reset"`
+	RetryAfter time.Duration `json:"retry_after"`
+}
+
+/**
+* AllowCtx: Checks and consumes one request from the rate limit bucket of key.
+* @param ctx context.Context, key string, limit RateLimit
+* @return RateResult, error
+**/
+func AllowCtx(ctx context.Context, key string, limit RateLimit) (RateResult, error) {
+	result := RateResult{
+		Allowed:   true,
+		Limit:     limit.Limit,
+		Remaining: limit.Limit,
+	}
+
+	if conn == nil {
+		return result, errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	if limit.Limit <= 0 || limit.Window <= 0 {
+		return result, nil
+	}
+
+	now := timezone.Now().UnixMilli()
+	window := limit.Window.Milliseconds()
+	if window < 1 {
+		window = 1
+	}
+
+	var values []interface{}
+	var err error
+	key = fmt.Sprintf("ratelimit:%s:%s", limit.Algorithm, key)
+	switch limit.Algorithm {
+	case TokenBucket:
+		capacity := limit.Burst
+		if capacity <= 0 {
+			capacity = limit.Limit
+		}
+		rate := float64(limit.Limit) / float64(window)
+		result.Limit = capacity
+		values, err = tokenBucketScript.Run(ctx, conn, []string{key}, now, capacity, rate).Slice()
+	default:
+		member := fmt.Sprintf("%d-%s", now, reg.ULID())
+		values, err = slidingWindowScript.Run(ctx, conn, []string{key}, now, window, limit.Limit, member).Slice()
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if len(values) < 4 {
+		return result, fmt.Errorf(msg.MSG_RATE_LIMIT_INVALID_REPLY, key)
+	}
+
+	toInt := func(v interface{}) int64 {
+		n, _ := v.(int64)
+		return n
+	}
+
+	result.Allowed = toInt(values[0]) == 1
+	result.Remaining = toInt(values[1])
+	result.RetryAfter = time.Duration(toInt(values[2])) * time.Millisecond
+	result.Reset = time.Duration(toInt(values[3])) * time.Millisecond
+
+	return result, nil
+}
+
+/**
+* Allow: Checks and consumes one request from the rate limit bucket of key.
+* @param key string, limit RateLimit
+* @return RateResult, error
+**/
+func Allow(key string, limit RateLimit) (RateResult, error) {
+	if conn == nil {
+		return RateResult{Allowed: true, Limit: limit.Limit, Remaining: limit.Limit}, errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	return AllowCtx(conn.ctx, key, limit)
+}
+
+/**
+* ResetRate: Removes the rate limit state of key.
+* @param key string, algorithm RateAlgorithm
+* @return error
+**/
+func ResetRate(key string, algorithm RateAlgorithm) error {
+	if conn == nil {
+		return errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	key = fmt.Sprintf("ratelimit:%s:%s", algorithm, key)
+	_, err := DeleteCtx(conn.ctx, key)
+	return err
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	loadTest(t)
+
+	tests := []struct {
+		name    string
+		limit   RateLimit
+		calls   int
+		allowed []bool
+	}{
+		{
+			name:    "sliding window within the limit",
+			limit:   RateLimit{Algorithm: SlidingWindow, Limit: 3, Window: time.Minute},
+			calls:   3,
+			allowed: []bool{true, true, true},
+		},
+		{
+			name:    "sliding window past the limit",
+			limit:   RateLimit{Algorithm: SlidingWindow, Limit: 2, Window: time.Minute},
+			calls:   3,
+			allowed: []bool{true, true, false},
+		},
+		{
+			name:    "token bucket burst",
+			limit:   RateLimit{Algorithm: TokenBucket, Limit: 1, Window: time.Minute, Burst: 3},
+			calls:   4,
+			allowed: []bool{true, true, true, false},
+		},
+		{
+			name:    "without limit",
+			limit:   RateLimit{Algorithm: SlidingWindow, Window: time.Minute},
+			calls:   3,
+			allowed: []bool{true, true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := fmt.Sprintf("test:%d", time.Now().UnixNano())
+			defer ResetRate(key, tt.limit.Algorithm)
+
+			for i := 0; i < tt.calls; i++ {
+				result, err := Allow(key, tt.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Allowed != tt.allowed[i] {
+					t.Fatalf("call %d: allowed = %v, want %v", i, result.Allowed, tt.allowed[i])
+				}
+				if !result.Allowed && result.RetryAfter <= 0 {
+					t.Errorf("call %d: retry after = %s, want a wait", i, result.RetryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowWithoutService(t *testing.T) {
+	if IsLoad() {
+		t.Skip("cache service is loaded")
+	}
+
+	result, err := Allow("test", RateLimit{Limit: 1, Window: time.Second})
+	if err == nil {
+		t.Fatal("expected an error without the cache service")
+	}
+	if !result.Allowed {
+		t.Fatal("limiter must fail open without the cache service")
+	}
+}
@@ -0,0 +1,500 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/msg"
+	"github.com/redis/go-redis/v9"
+)
+
+/**
+* StreamMessage: Entry read from a Redis Stream.
+**/
+type StreamMessage struct {
+	ID     string  `json:"id"`
+	Stream string  `json:"stream"`
+	Group  string  `json:"group"`
+	Data   et.Json `json:"data"`
+}
+
+/**
+* ToJson
+* @return et.Json
+**/
+func (s StreamMessage) ToJson() et.Json {
+	return et.Json{
+		"id":     s.ID,
+		"stream": s.Stream,
+		"group":  s.Group,
+		"data":   s.Data,
+	}
+}
+
+/**
+* StreamOptions: Consumer group tuning.
+* MinIdle is how long a pending entry must stay unacknowledged before another
+* consumer reclaims it with XAUTOCLAIM. An entry delivered more than MaxDeliveries
+* times is moved to the dead-letter stream, <stream>:dead, and acknowledged.
+**/
+type StreamOptions struct {
+	Count         int64         `json:"count"`
+	Block         time.Duration `json:"block"`
+	MinIdle       time.Duration `json:"min_idle"`
+	MaxLen        int64         `json:"max_len"`
+	MaxDeliveries int64         `json:"max_deliveries"`
+	Consumer      string        `json:"consumer"`
+}
+
+/**
+* defaultStreamOptions
+* @return StreamOptions
+**/
+func defaultStreamOptions() StreamOptions {
+	return StreamOptions{
+		Count:         10,
+		Block:         5 * time.Second,
+		MinIdle:       time.Minute,
+		MaxDeliveries: 5,
+	}
+}
+
+/**
+* DeadStream: Returns the dead-letter stream of stream.
+* @param stream string
+* @return string
+**/
+func DeadStream(stream string) string {
+	return fmt.Sprintf("%s:dead", stream)
+}
+
+/**
+* toStreamMessages
+* @param stream, group string, messages []redis.XMessage
+* @return []StreamMessage
+**/
+func toStreamMessages(stream, group string, messages []redis.XMessage) []StreamMessage {
+	result := make([]StreamMessage, 0, len(messages))
+	for _, m := range messages {
+		data := et.Json{}
+		if val, ok := m.Values["data"].(string); ok {
+			if err := json.Unmarshal([]byte(val), &data); err != nil {
+				logs.Alertf("stream:%s id:%s invalid data: %s", stream, m.ID, err.Error())
+			}
+		}
+
+		result = append(result, StreamMessage{
+			ID:     m.ID,
+			Stream: stream,
+			Group:  group,
+			Data:   data,
+		})
+	}
+
+	return result
+}
+
+/**
+* XAddCtx: Appends data to stream, trimming it to about maxLen entries when maxLen > 0.
+* @param ctx context.Context, stream string, data et.Json, maxLen int64
+* @return string, error
+**/
+func XAddCtx(ctx context.Context, stream string, data et.Json, maxLen int64) (string, error) {
+	if conn == nil {
+		return "", errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	args := &redis.XAddArgs{
+		Stream: stream,
+		Values: map[string]interface{}{"data": data.ToString()},
+	}
+	if maxLen > 0 {
+		args.MaxLen = maxLen
+		args.Approx = true
+	}
+
+	return conn.XAdd(ctx, args).Result()
+}
+
+/**
+* XAdd: Appends data to stream.
+* @param stream string, data et.Json
+* @return string, error
+**/
+func XAdd(stream string, data et.Json) (string, error) {
+	if conn == nil {
+		return "", errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	return XAddCtx(conn.ctx, stream, data, 0)
+}
+
+/**
+* XTrim: Trims stream to about maxLen entries.
+* @param stream string, maxLen int64
+* @return int64, error
+**/
+func XTrim(stream string, maxLen int64) (int64, error) {
+	if conn == nil {
+		return 0, errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	return conn.XTrimMaxLenApprox(conn.ctx, stream, maxLen, 0).Result()
+}
+
+/**
+* XTrimMinID: Removes the stream entries older than minID.
+* @param stream, minID string
+* @return int64, error
+**/
+func XTrimMinID(stream, minID string) (int64, error) {
+	if conn == nil {
+		return 0, errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	return conn.XTrimMinID(conn.ctx, stream, minID).Result()
+}
+
+/**
+* XGroup: Creates the consumer group, and the stream if missing. Existing groups are kept.
+* @param stream, group string
+* @return error
+**/
+func XGroup(stream, group string) error {
+	if conn == nil {
+		return errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	err := conn.XGroupCreateMkStream(conn.ctx, stream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	return nil
+}
+
+/**
+* XReadGroupCtx: Reads new entries for consumer, blocking up to block or until ctx is done.
+* @param ctx context.Context, stream, group, consumer string, count int64, block time.Duration
+* @return []StreamMessage, error
+**/
+func XReadGroupCtx(ctx context.Context, stream, group, consumer string, count int64, block time.Duration) ([]StreamMessage, error) {
+	if conn == nil {
+		return []StreamMessage{}, errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	streams, err := conn.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return []StreamMessage{}, nil
+	} else if err != nil {
+		return []StreamMessage{}, err
+	}
+
+	result := []StreamMessage{}
+	for _, s := range streams {
+		result = append(result, toStreamMessages(s.Stream, group, s.Messages)...)
+	}
+
+	return result, nil
+}
+
+/**
+* XReadGroup: Reads new entries for consumer, blocking up to block.
+* @param stream, group, consumer string, count int64, block time.Duration
+* @return []StreamMessage, error
+**/
+func XReadGroup(stream, group, consumer string, count int64, block time.Duration) ([]StreamMessage, error) {
+	if conn == nil {
+		return []StreamMessage{}, errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	return XReadGroupCtx(conn.ctx, stream, group, consumer, count, block)
+}
+
+/**
+* XAck: Acknowledges the entries of group.
+* @param stream, group string, ids ...string
+* @return error
+**/
+func XAck(stream, group string, ids ...string) error {
+	if conn == nil {
+		return errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return conn.XAck(conn.ctx, stream, group, ids...).Err()
+}
+
+/**
+* XAutoClaim: Transfers to consumer the pending entries idle longer than minIdle,
+* recovering the work of dead consumers.
+* @param stream, group, consumer string, minIdle time.Duration, count int64
+* @return []StreamMessage, error
+**/
+func XAutoClaim(stream, group, consumer string, minIdle time.Duration, count int64) ([]StreamMessage, error) {
+	if conn == nil {
+		return []StreamMessage{}, errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	result := []StreamMessage{}
+	start := "0-0"
+	for {
+		messages, next, err := conn.XAutoClaim(conn.ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    group,
+			MinIdle:  minIdle,
+			Start:    start,
+			Count:    count,
+			Consumer: consumer,
+		}).Result()
+		if err != nil {
+			return result, err
+		}
+
+		result = append(result, toStreamMessages(stream, group, messages)...)
+		if next == "0-0" || next == "" || len(messages) == 0 {
+			break
+		}
+		start = next
+	}
+
+	return result, nil
+}
+
+/**
+* XPending: Returns the pending summary of group.
+* @param stream, group string
+* @return et.Json, error
+**/
+func XPending(stream, group string) (et.Json, error) {
+	if conn == nil {
+		return et.Json{}, errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	result, err := conn.XPending(conn.ctx, stream, group).Result()
+	if err != nil {
+		return et.Json{}, err
+	}
+
+	return et.Json{
+		"count":     result.Count,
+		"lower":     result.Lower,
+		"higher":    result.Higher,
+		"consumers": result.Consumers,
+	}, nil
+}
+
+/**
+* XDeliveries: Returns how many times the pending entry id of group was delivered.
+* @param stream, group, id string
+* @return int64, error
+**/
+func XDeliveries(stream, group, id string) (int64, error) {
+	if conn == nil {
+		return 0, errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	pending, err := conn.XPendingExt(conn.ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	return pending[0].RetryCount, nil
+}
+
+/**
+* deadLetter: Moves the entry m of group to the dead-letter stream and acknowledges it.
+* @param m StreamMessage, deliveries int64
+* @return error
+**/
+func deadLetter(m StreamMessage, deliveries int64) error {
+	_, err := XAdd(DeadStream(m.Stream), et.Json{
+		"id":         m.ID,
+		"stream":     m.Stream,
+		"group":      m.Group,
+		"deliveries": deliveries,
+		"data":       m.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	return XAck(m.Stream, m.Group, m.ID)
+}
+
+/**
+* Consume: Joins group on stream and dispatches entries to f in a goroutine.
+* An entry is acknowledged when f returns nil; if f returns an error or panics it
+* stays pending and is reclaimed after MinIdle, until it passes MaxDeliveries and
+* goes to the dead-letter stream. A second call for the same stream and group is a no-op.
+* @param stream, group string, f func(StreamMessage) error, opts ...StreamOptions
+* @return error
+**/
+func (s *Conn) Consume(stream, group string, f func(StreamMessage) error, opts ...StreamOptions) error {
+	options := defaultStreamOptions()
+	if len(opts) > 0 {
+		def := options
+		options = opts[0]
+		if options.Count <= 0 {
+			options.Count = def.Count
+		}
+		if options.Block <= 0 {
+			options.Block = def.Block
+		}
+		if options.MinIdle <= 0 {
+			options.MinIdle = def.MinIdle
+		}
+		if options.MaxDeliveries <= 0 {
+			options.MaxDeliveries = def.MaxDeliveries
+		}
+	}
+	if options.Consumer == "" {
+		options.Consumer = s.Id
+	}
+
+	key := fmt.Sprintf("%s:%s", stream, group)
+	s.mutex.Lock()
+	if _, ok := s.consumers[key]; ok {
+		s.mutex.Unlock()
+		return nil
+	}
+
+	if err := XGroup(stream, group); err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.consumers[key] = cancel
+	s.mutex.Unlock()
+
+	handle := func(m StreamMessage) {
+		defer func() {
+			if r := recover(); r != nil {
+				logs.Errorf("panic in Consume stream:%s group:%s err:%v", stream, group, r)
+			}
+		}()
+
+		if err := f(m); err != nil {
+			logs.Alertf("stream:%s group:%s id:%s error:%s", stream, group, m.ID, err.Error())
+			return
+		}
+		if err := XAck(stream, group, m.ID); err != nil {
+			logs.Alertf("stream:%s group:%s ack id:%s error:%s", stream, group, m.ID, err.Error())
+		}
+	}
+
+	go func() {
+		lastClaim := time.Time{}
+		for ctx.Err() == nil {
+			if time.Since(lastClaim) >= options.MinIdle {
+				lastClaim = time.Now()
+				claimed, err := XAutoClaim(stream, group, options.Consumer, options.MinIdle, options.Count)
+				if err != nil {
+					logs.Alertf("stream:%s group:%s autoclaim error:%s", stream, group, err.Error())
+				}
+				for _, m := range claimed {
+					deliveries, err := XDeliveries(stream, group, m.ID)
+					if err != nil {
+						logs.Alertf("stream:%s group:%s pending id:%s error:%s", stream, group, m.ID, err.Error())
+					} else if deliveries > options.MaxDeliveries {
+						logs.Alertf("stream:%s group:%s id:%s dead after %d deliveries", stream, group, m.ID, deliveries)
+						if err := deadLetter(m, deliveries); err != nil {
+							logs.Alertf("stream:%s group:%s dead letter id:%s error:%s", stream, group, m.ID, err.Error())
+						}
+						continue
+					}
+					handle(m)
+				}
+			}
+
+			messages, err := XReadGroupCtx(ctx, stream, group, options.Consumer, options.Count, options.Block)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logs.Alertf("stream:%s group:%s read error:%s", stream, group, err.Error())
+				time.Sleep(time.Second)
+				continue
+			}
+
+			for _, m := range messages {
+				handle(m)
+			}
+
+			if options.MaxLen > 0 {
+				XTrim(stream, options.MaxLen)
+			}
+		}
+	}()
+
+	return nil
+}
+
+/**
+* StopConsume: Stops the consumer loop of stream and group.
+* @param stream, group string
+**/
+func (s *Conn) StopConsume(stream, group string) {
+	key := fmt.Sprintf("%s:%s", stream, group)
+	s.mutex.Lock()
+	cancel, ok := s.consumers[key]
+	if ok {
+		delete(s.consumers, key)
+	}
+	s.mutex.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+/**
+* Consume: Joins group on stream and dispatches entries to f.
+* @param stream, group string, f func(StreamMessage) error, opts ...StreamOptions
+* @return error
+**/
+func Consume(stream, group string, f func(StreamMessage) error, opts ...StreamOptions) error {
+	if conn == nil {
+		return errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	return conn.Consume(stream, group, f, opts...)
+}
+
+/**
+* StopConsume: Stops the consumer loop of stream and group.
+* @param stream, group string
+**/
+func StopConsume(stream, group string) {
+	if conn == nil {
+		return
+	}
+
+	conn.StopConsume(stream, group)
+}
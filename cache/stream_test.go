@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+)
+
+func TestConsume(t *testing.T) {
+	loadTest(t)
+
+	tests := []struct {
+		name    string
+		fail    bool
+		pending int64
+	}{
+		{name: "acknowledged when the handler succeeds", fail: false, pending: 0},
+		{name: "left pending when the handler fails", fail: true, pending: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := fmt.Sprintf("test:stream:%d", time.Now().UnixNano())
+			group := "test"
+			defer conn.Del(conn.ctx, stream)
+
+			done := make(chan struct{}, 1)
+			err := Consume(stream, group, func(m StreamMessage) error {
+				defer func() { done <- struct{}{} }()
+				if tt.fail {
+					return errors.New("failed")
+				}
+				return nil
+			}, StreamOptions{Block: 100 * time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := XAdd(stream, et.Json{"n": 1}); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("message was not delivered")
+			}
+
+			start := time.Now()
+			StopConsume(stream, group)
+			if time.Since(start) > time.Second {
+				t.Errorf("StopConsume waited %s", time.Since(start))
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			pending, err := XPending(stream, group)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pending.Int64("count"); got != tt.pending {
+				t.Fatalf("pending = %d, want %d", got, tt.pending)
+			}
+		})
+	}
+}
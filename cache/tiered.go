@@ -0,0 +1,303 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/mem"
+	"github.com/cgalvisleon/et/msg"
+	"github.com/redis/go-redis/v9"
+)
+
+/**
+* Tiered: Two-level cache with a local mem store in front of Redis.
+* Writes and deletes are broadcast over Pub so every replica evicts its local copy.
+**/
+type Tiered struct {
+	Name       string        `json:"name"`
+	LocalTTL   time.Duration `json:"local_ttl"`
+	channel    string
+	local      *mem.Mem
+	flight     *flight
+	subscribed atomic.Bool
+}
+
+/**
+* NewTiered
+* @param name string, localTTL time.Duration
+* @return *Tiered
+**/
+func NewTiered(name string, localTTL time.Duration) *Tiered {
+	result := &Tiered{
+		Name:     name,
+		LocalTTL: localTTL,
+		channel:  fmt.Sprintf("cache:tiered:%s", name),
+		local:    mem.Load(),
+		flight:   newFlight(),
+	}
+	result.subscribe()
+
+	return result
+}
+
+/**
+* subscribe: Listens for invalidations from other replicas once the cache is loaded.
+**/
+func (s *Tiered) subscribe() {
+	if conn == nil || s.subscribed.Load() {
+		return
+	}
+
+	if !s.subscribed.CompareAndSwap(false, true) {
+		return
+	}
+
+	conn.Sub(s.channel, func(m *redis.Message) {
+		var message Message
+		err := json.Unmarshal([]byte(m.Payload), &message)
+		if err != nil {
+			return
+		}
+
+		if message.ID == conn.Id {
+			return
+		}
+
+		if message.Content == "" {
+			s.local.Empty()
+			return
+		}
+
+		s.local.Delete(message.Content)
+	})
+}
+
+/**
+* broadcast: Publishes an invalidation of key, an empty key evicts everything.
+* @param key string
+**/
+func (s *Tiered) broadcast(key string) {
+	if conn == nil {
+		return
+	}
+
+	message := Message{
+		ID:      conn.Id,
+		Content: key,
+	}
+	bt, err := message.serialize()
+	if err != nil {
+		return
+	}
+
+	if err := conn.Pub(s.channel, bt); err != nil {
+		logs.Alertf("tiered:%s broadcast error:%s", s.Name, err.Error())
+	}
+}
+
+/**
+* localTTL: Local TTL never outlives the Redis TTL.
+* @param ttl time.Duration
+* @return time.Duration
+**/
+func (s *Tiered) localTTL(ttl time.Duration) time.Duration {
+	if ttl > 0 && (s.LocalTTL == 0 || ttl < s.LocalTTL) {
+		return ttl
+	}
+
+	return s.LocalTTL
+}
+
+/**
+* Get: Reads key from the local store, then from Redis, filling the local store on a hit.
+* @param key string
+* @return string, bool, error
+**/
+func (s *Tiered) Get(key string) (string, bool, error) {
+	s.subscribe()
+
+	result, exists, err := s.local.GetStr(key)
+	if err == nil && exists {
+		return result, true, nil
+	}
+
+	if conn == nil {
+		return "", false, errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	result, err = conn.Get(conn.ctx, key).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	ttl := s.LocalTTL
+	if remaining, err := conn.PTTL(conn.ctx, key).Result(); err == nil && remaining > 0 {
+		ttl = s.localTTL(remaining)
+	}
+	s.local.Set(key, result, ttl)
+
+	return result, true, nil
+}
+
+/**
+* GetJson
+* @param key string
+* @return et.Json, error
+**/
+func (s *Tiered) GetJson(key string) (et.Json, error) {
+	val, exists, err := s.Get(key)
+	if err != nil {
+		return et.Json{}, err
+	}
+
+	if !exists {
+		return et.Json{}, IsNil
+	}
+
+	var result et.Json
+	err = json.Unmarshal([]byte(val), &result)
+	if err != nil {
+		return et.Json{}, err
+	}
+
+	return result, nil
+}
+
+/**
+* Set: Writes key to Redis and the local store and invalidates the other replicas.
+* @param key string, val interface{}, ttl time.Duration
+* @return error
+**/
+func (s *Tiered) Set(key string, val interface{}, ttl time.Duration) error {
+	s.subscribe()
+
+	str, ok := valueStr(val)
+	if !ok {
+		bt, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		str = string(bt)
+	}
+
+	if conn != nil {
+		if err := conn.Set(conn.ctx, key, str, ttl).Err(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.local.Set(key, str, s.localTTL(ttl)); err != nil {
+		return err
+	}
+
+	s.broadcast(key)
+
+	return nil
+}
+
+/**
+* Delete: Removes key from both tiers on every replica.
+* @param key string
+* @return error
+**/
+func (s *Tiered) Delete(key string) error {
+	s.subscribe()
+
+	s.local.Delete(key)
+	s.broadcast(key)
+
+	if conn == nil {
+		return nil
+	}
+
+	_, err := DeleteCtx(conn.ctx, key)
+	return err
+}
+
+/**
+* Invalidate: Evicts key from the local store of every replica, keeping Redis.
+* @param key string
+**/
+func (s *Tiered) Invalidate(key string) {
+	s.subscribe()
+
+	s.local.Delete(key)
+	s.broadcast(key)
+}
+
+/**
+* Flush: Empties the local store of every replica.
+**/
+func (s *Tiered) Flush() {
+	s.subscribe()
+
+	s.local.Empty()
+	s.broadcast("")
+}
+
+/**
+* Purge: Removes the keys starting with prefix from Redis and from the local store
+* of every replica.
+* @param prefix string
+* @return error
+**/
+func (s *Tiered) Purge(prefix string) error {
+	s.subscribe()
+
+	s.local.Clear(prefix)
+	s.broadcast("")
+
+	if conn == nil {
+		return nil
+	}
+
+	return Empty(prefix + "*")
+}
+
+/**
+* Load: Returns key from the cache or runs loader and stores its result in both tiers.
+* Concurrent misses of the same key share a single loader call.
+* @param key string, ttl time.Duration, loader func() (et.Json, error)
+* @return et.Json, error
+**/
+func (s *Tiered) Load(key string, ttl time.Duration, loader func() (et.Json, error)) (et.Json, error) {
+	result, err := s.GetJson(key)
+	if err == nil {
+		return result, nil
+	}
+
+	val, _, err := s.flight.do(key, func() (interface{}, error) {
+		result, err := s.GetJson(key)
+		if err == nil {
+			return result, nil
+		}
+
+		result, err = loader()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.Set(key, result, ttl); err != nil {
+			logs.Alertf("tiered:%s set key:%s error:%s", s.Name, key, err.Error())
+		}
+
+		return result, nil
+	})
+	if err != nil {
+		return et.Json{}, err
+	}
+
+	result, ok := val.(et.Json)
+	if !ok {
+		return et.Json{}, IsNil
+	}
+
+	return result, nil
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+)
+
+func TestTieredLocalTTL(t *testing.T) {
+	tests := []struct {
+		name  string
+		local time.Duration
+		ttl   time.Duration
+		want  time.Duration
+	}{
+		{"shorter remote ttl", time.Minute, time.Second, time.Second},
+		{"longer remote ttl", time.Second, time.Minute, time.Second},
+		{"remote without ttl", time.Second, 0, time.Second},
+		{"local without ttl", 0, time.Minute, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tiered := &Tiered{LocalTTL: tt.local}
+			if got := tiered.localTTL(tt.ttl); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTieredInvalidation(t *testing.T) {
+	tiered := NewTiered(fmt.Sprintf("test-%d", time.Now().UnixNano()), time.Minute)
+	key := fmt.Sprintf("tiered:%d", time.Now().UnixNano())
+	defer tiered.Delete(key)
+
+	tests := []struct {
+		name   string
+		op     func()
+		exists bool
+	}{
+		{name: "set", op: func() { tiered.Set(key, "a", time.Minute) }, exists: true},
+		{name: "invalidate", op: func() { tiered.Invalidate(key) }, exists: false},
+		{name: "set again", op: func() { tiered.Set(key, "b", time.Minute) }, exists: true},
+		{name: "flush", op: func() { tiered.Flush() }, exists: false},
+		{name: "set before purge", op: func() { tiered.Set(key, "c", time.Minute) }, exists: true},
+		{name: "purge", op: func() { tiered.Purge("tiered:") }, exists: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.op()
+			_, exists, _ := tiered.local.GetStr(key)
+			if exists != tt.exists {
+				t.Fatalf("local copy exists = %v, want %v", exists, tt.exists)
+			}
+		})
+	}
+}
+
+func TestTieredLoad(t *testing.T) {
+	tiered := NewTiered(fmt.Sprintf("test-%d", time.Now().UnixNano()), time.Minute)
+	key := fmt.Sprintf("tiered:load:%d", time.Now().UnixNano())
+	defer tiered.Delete(key)
+
+	var calls atomic.Int32
+	loader := func() (et.Json, error) {
+		calls.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return et.Json{"name": "a"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := tiered.Load(key, time.Minute, loader)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if result.Str("name") != "a" {
+				t.Errorf("got %v", result)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("loader ran %d times, want 1", got)
+	}
+}
+
+func TestTieredRemoteInvalidation(t *testing.T) {
+	loadTest(t)
+
+	tiered := NewTiered(fmt.Sprintf("test-%d", time.Now().UnixNano()), time.Minute)
+	key := fmt.Sprintf("tiered:remote:%d", time.Now().UnixNano())
+	defer tiered.Delete(key)
+
+	if err := tiered.Set(key, "a", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	/* Another replica writes the key */
+	bt, err := Message{ID: "other-replica", Content: key}.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := conn.Pub(tiered.channel, bt); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, exists, _ := tiered.local.GetStr(key); !exists {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("local copy was not invalidated")
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/cgalvisleon/et/trace"
+	"github.com/redis/go-redis/v9"
+)
+
+/**
+* traceHook: Records a client span for each command run with a traced context,
+* such as the ones given to the Ctx functions.
+**/
+type traceHook struct{}
+
+func (traceHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (traceHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, record := trace.Start(ctx, cmd.Name(), trace.KindClient)
+		record.Set("db.system", "redis").Set("db.operation.name", cmd.Name())
+		err := next(ctx, cmd)
+		if !errors.Is(err, redis.Nil) {
+			record.Error(err)
+		}
+		record.Finish()
+		return err
+	}
+}
+
+func (traceHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, record := trace.Start(ctx, "pipeline", trace.KindClient)
+		record.Set("db.system", "redis").Set("db.operation.batch.size", len(cmds))
+		err := next(ctx, cmds)
+		if !errors.Is(err, redis.Nil) {
+			record.Error(err)
+		}
+		record.Finish()
+		return err
+	}
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/msg"
+	"github.com/redis/go-redis/v9"
+)
+
+var loads = newFlight()
+
+/**
+* SetAs: Serializes v with the configured codec and stores it under key, inside the
+* service namespace.
+* @params key string, v T, expiration time.Duration
+* @return error
+**/
+func SetAs[T any](key string, v T, expiration time.Duration) error {
+	if conn == nil {
+		return errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	bt, err := encode(v)
+	if err != nil {
+		return err
+	}
+
+	return conn.Set(conn.ctx, namespaced(key), bt, clampExpiration(expiration)).Err()
+}
+
+/**
+* GetAs: Reads key, inside the service namespace, and deserializes it into T.
+* A missing key returns IsNil.
+* @params key string
+* @return T, error
+**/
+func GetAs[T any](key string) (T, error) {
+	var result T
+	if conn == nil {
+		return result, errors.New(msg.MSG_NOT_CACHE_SERVICE)
+	}
+
+	bt, err := conn.Get(conn.ctx, namespaced(key)).Bytes()
+	if err == redis.Nil {
+		return result, IsNil
+	} else if err != nil {
+		return result, err
+	}
+
+	err = decode(bt, &result)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+/**
+* GetOrLoad: Returns key as T or runs loader and stores its result for expiration.
+* Concurrent misses of the same key and type share a single loader call.
+* @params key string, expiration time.Duration, loader func() (T, error)
+* @return T, error
+**/
+func GetOrLoad[T any](key string, expiration time.Duration, loader func() (T, error)) (T, error) {
+	result, err := GetAs[T](key)
+	if err == nil {
+		return result, nil
+	}
+
+	/* Loads of the same key as different types must not share their result */
+	flight := fmt.Sprintf("%T:%s", *new(T), namespaced(key))
+	val, _, err := loads.do(flight, func() (interface{}, error) {
+		result, err := GetAs[T](key)
+		if err == nil {
+			return result, nil
+		}
+
+		result, err = loader()
+		if err != nil {
+			return result, err
+		}
+
+		if err := SetAs(key, result, expiration); err != nil {
+			logs.Alertf("GetOrLoad key:%s set error:%s", key, err.Error())
+		}
+		return result, nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	result, ok := val.(T)
+	if !ok {
+		return result, fmt.Errorf("GetOrLoad key:%s loaded %T, not %T", key, val, result)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type testItem struct {
+	Name  string
+	Price float64
+	Tags  []string
+}
+
+func TestCodecs(t *testing.T) {
+	defer SetCodec(JSON)
+	defer SetCompression(0)
+
+	item := testItem{Name: "item", Price: 9.5, Tags: []string{"a", "b"}}
+	tests := []struct {
+		name     string
+		codec    Codec
+		compress int
+		gzipped  bool
+	}{
+		{name: "json", codec: JSON},
+		{name: "msgpack", codec: Msgpack},
+		{name: "gob", codec: Gob},
+		{name: "json over the threshold", codec: JSON, compress: 1, gzipped: true},
+		{name: "json under the threshold", codec: JSON, compress: 1 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetCodec(tt.codec)
+			SetCompression(tt.compress)
+
+			bt, err := encode(item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.HasPrefix(bt, gzipMagic) != tt.gzipped {
+				t.Fatalf("gzipped = %v, want %v", !tt.gzipped, tt.gzipped)
+			}
+
+			var got testItem
+			if err := decode(bt, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != item.Name || got.Price != item.Price || len(got.Tags) != len(item.Tags) {
+				t.Fatalf("got %+v, want %+v", got, item)
+			}
+		})
+	}
+}
+
+func TestNamespaced(t *testing.T) {
+	defer SetPrefix(Prefix())
+
+	tests := []struct {
+		name   string
+		prefix string
+		key    string
+		want   string
+	}{
+		{"without prefix", "", "user:1", "user:1"},
+		{"with prefix", "orders", "user:1", "orders:user:1"},
+		{"already namespaced", "orders", "orders:user:1", "orders:user:1"},
+		{"similar prefix", "orders", "orders2:user:1", "orders:orders2:user:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetPrefix(tt.prefix)
+			if got := namespaced(tt.key); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	SetPrefix("orders")
+	if key := Key("user", 1); namespaced(key) != key {
+		t.Fatalf("Key result %q is namespaced twice", key)
+	}
+}
+
+func TestTypedAccessors(t *testing.T) {
+	loadTest(t)
+	defer SetPrefix(Prefix())
+
+	key := fmt.Sprintf("typed:%d", time.Now().UnixNano())
+	SetPrefix("service-a")
+	if err := SetAs(key, testItem{Name: "a"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	defer Delete("service-a:" + key)
+
+	/* Another service with the same key does not see the value */
+	SetPrefix("service-b")
+	if _, err := GetAs[testItem](key); !errors.Is(err, IsNil) {
+		t.Fatalf("service-b read err = %v, want IsNil", err)
+	}
+
+	calls := 0
+	loaded, err := GetOrLoad(key, time.Minute, func() (testItem, error) {
+		calls++
+		return testItem{Name: "b"}, nil
+	})
+	if err != nil || loaded.Name != "b" || calls != 1 {
+		t.Fatalf("GetOrLoad = %+v, %v after %d calls", loaded, err, calls)
+	}
+	defer Delete("service-b:" + key)
+
+	SetPrefix("service-a")
+	got, err := GetAs[testItem](key)
+	if err != nil || got.Name != "a" {
+		t.Fatalf("service-a read %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cgalvisleon/et/envar"
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/request"
+	"github.com/cgalvisleon/et/utility"
+)
+
+/**
+* Collector stub: receives OTLP/HTTP JSON on /v1/traces and /v1/metrics and logs
+* what arrives, to try the trace exporter without a real collector.
+**/
+func main() {
+	port := envar.SetIntByArg("-port", "PORT", 4318)
+
+	http.HandleFunc("/v1/traces", func(w http.ResponseWriter, r *http.Request) {
+		body, err := request.GetBody(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for _, rs := range body.ArrayJson("resourceSpans") {
+			service := rs.Json("resource").ToString()
+			for _, ss := range rs.ArrayJson("scopeSpans") {
+				for _, span := range ss.ArrayJson("spans") {
+					logs.Logf("span", "%s trace:%s span:%s parent:%s name:%s status:%s",
+						service, span.Str("traceId"), span.Str("spanId"), span.Str("parentSpanId"),
+						span.Str("name"), span.Json("status").ToString())
+				}
+			}
+		}
+
+		w.Write([]byte("{}"))
+	})
+
+	http.HandleFunc("/v1/metrics", func(w http.ResponseWriter, r *http.Request) {
+		body, err := request.GetBody(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for _, rm := range body.ArrayJson("resourceMetrics") {
+			for _, sm := range rm.ArrayJson("scopeMetrics") {
+				for _, metric := range sm.ArrayJson("metrics") {
+					points := metric.Json("histogram").ArrayJson("dataPoints")
+					logs.Logf("metric", "%s points:%d", metric.Str("name"), len(points))
+				}
+			}
+		}
+
+		w.Write([]byte("{}"))
+	})
+
+	go func() {
+		logs.Logf("collector", "listening on :%d", port)
+		err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+		if err != nil {
+			logs.Panic(err)
+		}
+	}()
+
+	utility.AppWait()
+}
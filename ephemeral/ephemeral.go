@@ -7,8 +7,10 @@ import (
 
 type Instance struct {
 	models     map[string]interface{}
+	deadlines  map[string]time.Time
+	timers     map[string]*time.Timer
 	expiration time.Duration
-	timer      *time.Timer
+	persist    []chan struct{}
 	mu         sync.Mutex
 }
 
@@ -20,11 +22,57 @@ type Instance struct {
 func NewInstance(expiration time.Duration) *Instance {
 	return &Instance{
 		models:     make(map[string]interface{}),
+		deadlines:  make(map[string]time.Time),
+		timers:     make(map[string]*time.Timer),
 		expiration: expiration,
-		timer:      nil,
 	}
 }
 
+/**
+* touch: Moves the deadline of key, resetting its timer, must be called holding mu.
+* @param key string, ttl time.Duration
+**/
+func (s *Instance) touch(key string, ttl time.Duration) {
+	s.deadlines[key] = time.Now().Add(ttl)
+	if timer, ok := s.timers[key]; ok {
+		timer.Reset(ttl)
+		return
+	}
+
+	s.timers[key] = time.AfterFunc(ttl, func() {
+		s.expire(key)
+	})
+}
+
+/**
+* forget: Drops key with its deadline and timer, must be called holding mu.
+* @param key string
+**/
+func (s *Instance) forget(key string) {
+	if timer, ok := s.timers[key]; ok {
+		timer.Stop()
+	}
+	delete(s.models, key)
+	delete(s.deadlines, key)
+	delete(s.timers, key)
+}
+
+/**
+* expire: Removes key once its last deadline has passed.
+* @param key string
+**/
+func (s *Instance) expire(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deadline, ok := s.deadlines[key]
+	if !ok || time.Now().Before(deadline) {
+		return
+	}
+
+	s.forget(key)
+}
+
 /**
 * Set
 * @param key string
@@ -34,12 +82,7 @@ func (s *Instance) Set(key string, value interface{}) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.models[key] = value
-
-	go func() {
-		s.timer = time.AfterFunc(s.expiration, func() {
-			s.Del(key)
-		})
-	}()
+	s.touch(key, s.expiration)
 }
 
 /**
@@ -49,7 +92,7 @@ func (s *Instance) Set(key string, value interface{}) {
 func (s *Instance) Del(key string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.models, key)
+	s.forget(key)
 }
 
 /**
@@ -66,15 +109,7 @@ func (s *Instance) Get(key string) (interface{}, bool) {
 		return nil, false
 	}
 
-	if s.timer != nil {
-		s.timer.Stop()
-	}
-
-	go func() {
-		s.timer = time.AfterFunc(s.expiration, func() {
-			s.Del(key)
-		})
-	}()
+	s.touch(key, s.expiration)
 
 	return result, true
 }
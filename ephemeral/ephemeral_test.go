@@ -0,0 +1,99 @@
+package ephemeral
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestExpiration(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  func(s *Instance)
+		exists bool
+	}{
+		{
+			name:   "expires after the ttl",
+			steps:  func(s *Instance) { s.Set("a", 1); time.Sleep(80 * time.Millisecond) },
+			exists: false,
+		},
+		{
+			name: "a read moves the deadline",
+			steps: func(s *Instance) {
+				s.Set("a", 1)
+				for i := 0; i < 4; i++ {
+					time.Sleep(20 * time.Millisecond)
+					s.Get("a")
+				}
+			},
+			exists: true,
+		},
+		{
+			name: "a write moves the deadline",
+			steps: func(s *Instance) {
+				s.Set("a", 1)
+				time.Sleep(30 * time.Millisecond)
+				s.Set("a", 2)
+				time.Sleep(30 * time.Millisecond)
+			},
+			exists: true,
+		},
+		{
+			name:   "delete",
+			steps:  func(s *Instance) { s.Set("a", 1); s.Del("a") },
+			exists: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewInstance(50 * time.Millisecond)
+			tt.steps(s)
+
+			s.mu.Lock()
+			_, exists := s.models["a"]
+			timers := len(s.timers)
+			s.mu.Unlock()
+			if exists != tt.exists {
+				t.Fatalf("exists = %v, want %v", exists, tt.exists)
+			}
+			if exists && timers != 1 || !exists && timers != 0 {
+				t.Fatalf("timers = %d with exists %v", timers, exists)
+			}
+		})
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	source := NewInstance(time.Hour)
+	source.Set("name", "model")
+	source.Set("model", map[string]interface{}{"id": "1"})
+
+	var buf bytes.Buffer
+	if err := source.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewInstance(time.Hour)
+	n, err := target.Restore(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("restored %d models, want 2", n)
+	}
+
+	if got, _ := target.Get("name"); got != "model" {
+		t.Errorf("name = %v", got)
+	}
+	model, _ := target.Get("model")
+	if m, ok := model.(map[string]interface{}); !ok || m["id"] != "1" {
+		t.Errorf("model = %v", model)
+	}
+
+	/* Expired models are not restored */
+	buf.Reset()
+	buf.WriteString(`{"key":"old","value":"1","expires_at":"2000-01-01T00:00:00Z"}` + "\n")
+	if n, err := NewInstance(time.Hour).Restore(&buf); err != nil || n != 0 {
+		t.Fatalf("restored %d expired models, err %v", n, err)
+	}
+}
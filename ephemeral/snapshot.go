@@ -0,0 +1,188 @@
+package ephemeral
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/utility"
+)
+
+/**
+* record: Line of a snapshot. Values are stored as JSON, so a restored value comes
+* back as its decoded JSON form (map, slice, string, float64 or bool).
+**/
+type record struct {
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+/**
+* Snapshot: Writes every model with its deadline to w.
+* @param w io.Writer
+* @return error
+**/
+func (s *Instance) Snapshot(w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enc := json.NewEncoder(w)
+	for key, value := range s.models {
+		bt, err := json.Marshal(value)
+		if err != nil {
+			logs.Alertf("ephemeral snapshot key:%s error:%s", key, err.Error())
+			continue
+		}
+
+		err = enc.Encode(record{
+			Key:       key,
+			Value:     bt,
+			ExpiresAt: s.deadlines[key],
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/**
+* Restore: Loads the models of a snapshot from r keeping their remaining time.
+* @param r io.Reader
+* @return int, error
+**/
+func (s *Instance) Restore(r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	result := 0
+	for {
+		var rec record
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return result, nil
+		} else if err != nil {
+			return result, err
+		}
+
+		ttl := time.Until(rec.ExpiresAt)
+		if ttl <= 0 {
+			continue
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(rec.Value, &value); err != nil {
+			return result, err
+		}
+
+		s.mu.Lock()
+		s.models[rec.Key] = value
+		s.touch(rec.Key, ttl)
+		s.mu.Unlock()
+		result++
+	}
+}
+
+/**
+* SnapshotFile: Writes a snapshot to path, replacing the previous one atomically.
+* @param path string
+* @return error
+**/
+func (s *Instance) SnapshotFile(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := s.Snapshot(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+/**
+* RestoreFile: Restores the snapshot at path, a missing file restores nothing.
+* @param path string
+* @return int, error
+**/
+func (s *Instance) RestoreFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return s.Restore(file)
+}
+
+/**
+* Persist: Restores path and then snapshots the instance to it every interval and on shutdown.
+* A zero interval only snapshots on shutdown.
+* @param path string, interval time.Duration
+* @return error
+**/
+func (s *Instance) Persist(path string, interval time.Duration) error {
+	if _, err := s.RestoreFile(path); err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	s.mu.Lock()
+	s.persist = append(s.persist, stop)
+	s.mu.Unlock()
+
+	if interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := s.SnapshotFile(path); err != nil {
+						logs.Alertf("ephemeral snapshot:%s error:%s", path, err.Error())
+					}
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	utility.OnShutdown(func() {
+		s.Close()
+		if err := s.SnapshotFile(path); err != nil {
+			logs.Alertf("ephemeral snapshot:%s error:%s", path, err.Error())
+		}
+	})
+
+	return nil
+}
+
+/**
+* Close: Stops the periodic snapshots.
+**/
+func (s *Instance) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stop := range s.persist {
+		close(stop)
+	}
+	s.persist = nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/cgalvisleon/et/middleware"
 	"github.com/cgalvisleon/et/request"
+	"github.com/cgalvisleon/et/trace"
 )
 
 var commonHeader = make(map[string]bool)
@@ -40,7 +41,7 @@ func (s *Server) handlerApiRest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	proxyReq.Header = resolver.Header
+	proxyReq.Header = trace.Outbound(r.Context(), resolver.Header)
 	res, err := s.client.Do(proxyReq)
 	if err != nil {
 		metric.HTTPError(rw, r, http.StatusBadGateway, err.Error())
@@ -19,6 +19,7 @@ import (
 	"github.com/cgalvisleon/et/msg"
 	"github.com/cgalvisleon/et/response"
 	rt "github.com/cgalvisleon/et/router"
+	"github.com/cgalvisleon/et/trace"
 	"github.com/cgalvisleon/et/utility"
 )
 
@@ -183,7 +184,7 @@ func (s *Server) handlerReverseProxy(w http.ResponseWriter, r *http.Request) {
 	/* Begin telemetry */
 	metric := middleware.NewMetric(r)
 	w.Header().Set("ServiceId", metric.ServiceId)
-	ctx := context.WithValue(r.Context(), MetricKey, metric)
+	ctx := metric.WithContext(r.Context())
 	r = r.WithContext(ctx)
 
 	request := et.Json{
@@ -217,6 +218,8 @@ func (s *Server) handlerReverseProxy(w http.ResponseWriter, r *http.Request) {
 	/* Call search time since begin */
 	metric.CallSearchTime()
 	metric.SetPath(proxy.Solver)
+	r = r.Clone(ctx)
+	trace.Inject(r.Header, metric.Span())
 	proxy.ServeHTTP(w, r)
 }
 
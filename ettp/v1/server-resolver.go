@@ -37,7 +37,7 @@ func (s *Server) handlerResolver(w http.ResponseWriter, r *http.Request) {
 	/* Begin telemetry */
 	metric := middleware.NewMetric(r)
 	w.Header().Set("ServiceId", metric.ServiceId)
-	ctx := context.WithValue(r.Context(), MetricKey, metric)
+	ctx := metric.WithContext(r.Context())
 	r = r.WithContext(ctx)
 
 	/* Check if over limit */
@@ -13,6 +13,7 @@ import (
 	"github.com/cgalvisleon/et/et"
 	"github.com/cgalvisleon/et/event"
 	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/middleware"
 	"github.com/cgalvisleon/et/strs"
 	"github.com/cgalvisleon/et/timezone"
 	"github.com/cgalvisleon/et/utility"
@@ -86,6 +87,9 @@ type Server struct {
 }
 
 func New(config Config) (*Server, error) {
+	/* Trace */
+	middleware.LoadTrace()
+
 	/* Cache */
 	err := cache.Load()
 	if err != nil {
@@ -0,0 +1,416 @@
+package ettp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/event"
+)
+
+const (
+	EVENT_BREAKER_STATUS = "event:apigateway:breaker:status"
+)
+
+var idempotent = map[string]bool{
+	GET:     true,
+	HEAD:    true,
+	OPTIONS: true,
+	PUT:     true,
+	DELETE:  true,
+}
+
+/**
+* parseDuration: Reads a duration string ("500ms", "2s") or a number of seconds.
+* @param params et.Json, key string
+* @return time.Duration
+**/
+func parseDuration(params et.Json, key string) time.Duration {
+	result, err := time.ParseDuration(params.Str(key))
+	if err != nil {
+		result = time.Duration(params.Num(key) * float64(time.Second))
+	}
+
+	return result
+}
+
+/**
+* Duration: time.Duration written as a duration string ("5s"), the form parseDuration
+* reads back. Numbers are taken as nanoseconds, as routes stored before were written.
+**/
+type Duration time.Duration
+
+/**
+* MarshalJSON
+* @return []byte, error
+**/
+func (s Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(s).String())
+}
+
+/**
+* UnmarshalJSON
+* @param data []byte
+* @return error
+**/
+func (s *Duration) UnmarshalJSON(data []byte) error {
+	var val interface{}
+	if err := json.Unmarshal(data, &val); err != nil {
+		return err
+	}
+
+	switch v := val.(type) {
+	case string:
+		result, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*s = Duration(result)
+	case float64:
+		*s = Duration(v)
+	default:
+		*s = 0
+	}
+
+	return nil
+}
+
+/**
+* RetryPolicy: Retries of a route. Only idempotent methods are retried, after a
+* transport error or one of Statuses, waiting Backoff doubled on every attempt.
+**/
+type RetryPolicy struct {
+	Attempts   int      `json:"attempts"`
+	Backoff    Duration `json:"backoff"`
+	MaxBackoff Duration `json:"max_backoff"`
+	Statuses   []int    `json:"statuses"`
+}
+
+/**
+* NewRetryPolicy: Builds a RetryPolicy from its JSON definition.
+* backoff and max_backoff accept a duration string or a number of seconds.
+* @param params et.Json
+* @return *RetryPolicy
+**/
+func NewRetryPolicy(params et.Json) *RetryPolicy {
+	if params.IsEmpty() {
+		return nil
+	}
+
+	statuses := []int{}
+	for _, val := range params.Array("statuses") {
+		switch v := val.(type) {
+		case float64:
+			statuses = append(statuses, int(v))
+		case int:
+			statuses = append(statuses, v)
+		}
+	}
+	if len(statuses) == 0 {
+		statuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+
+	backoff := parseDuration(params, "backoff")
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+
+	maxBackoff := parseDuration(params, "max_backoff")
+	if maxBackoff < backoff {
+		maxBackoff = 10 * backoff
+	}
+
+	return &RetryPolicy{
+		Attempts:   max(params.Int("attempts"), 1),
+		Backoff:    Duration(backoff),
+		MaxBackoff: Duration(maxBackoff),
+		Statuses:   statuses,
+	}
+}
+
+/**
+* attempts: Returns how many times method may be sent.
+* @param method string
+* @return int
+**/
+func (s *RetryPolicy) attempts(method string) int {
+	if s == nil || !idempotent[method] {
+		return 1
+	}
+
+	return max(s.Attempts, 1)
+}
+
+/**
+* retryStatus
+* @param status int
+* @return bool
+**/
+func (s *RetryPolicy) retryStatus(status int) bool {
+	return s != nil && slices.Contains(s.Statuses, status)
+}
+
+/**
+* wait: Sleeps the backoff of attempt, returning false when ctx ends first.
+* @param ctx context.Context, attempt int
+* @return bool
+**/
+func (s *RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	maxBackoff := time.Duration(s.MaxBackoff)
+	delay := time.Duration(s.Backoff) << (attempt - 1)
+	if delay <= 0 || delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+/**
+* BreakerConfig: Circuit breaker of a route. After Failures consecutive failures
+* the upstream is cut for Timeout, then it closes again after HalfOpen successful
+* trial requests, or opens on the first failed one.
+**/
+type BreakerConfig struct {
+	Failures int      `json:"failures"`
+	Timeout  Duration `json:"timeout"`
+	HalfOpen int      `json:"half_open"`
+}
+
+/**
+* NewBreakerConfig: Builds a BreakerConfig from its JSON definition.
+* timeout accepts a duration string or a number of seconds.
+* @param params et.Json
+* @return *BreakerConfig
+**/
+func NewBreakerConfig(params et.Json) *BreakerConfig {
+	if params.IsEmpty() {
+		return nil
+	}
+
+	timeout := parseDuration(params, "timeout")
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	return &BreakerConfig{
+		Failures: max(params.Int("failures"), 1),
+		Timeout:  Duration(timeout),
+		HalfOpen: max(params.Int("half_open"), 1),
+	}
+}
+
+/**
+* Breaker: Circuit state of one upstream of a Solver.
+**/
+type Breaker struct {
+	Solver    string         `json:"solver"`
+	Upstream  string         `json:"upstream"`
+	State     BreakerState   `json:"state"`
+	Failures  int            `json:"failures"`
+	OpenedAt  time.Time      `json:"opened_at"`
+	config    *BreakerConfig `json:"-"`
+	trials    int            `json:"-"`
+	successes int            `json:"-"`
+	mu        sync.Mutex     `json:"-"`
+}
+
+/**
+* upstreamOf: Identifies the upstream of an address by scheme and host.
+* @param address string
+* @return string
+**/
+func upstreamOf(address string) string {
+	u, err := url.Parse(address)
+	if err != nil {
+		return address
+	}
+
+	return u.Scheme + "://" + u.Host
+}
+
+/**
+* breaker: Returns the breaker of upstream, nil when the route has no circuit breaking.
+* @param upstream string
+* @return *Breaker
+**/
+func (s *Solver) breaker(upstream string) *Breaker {
+	if s.Breaker == nil {
+		return nil
+	}
+
+	s.muBreakers.Lock()
+	defer s.muBreakers.Unlock()
+
+	if s.breakers == nil {
+		s.breakers = map[string]*Breaker{}
+	}
+
+	result, ok := s.breakers[upstream]
+	if !ok {
+		result = &Breaker{
+			Solver:   s.ID,
+			Upstream: upstream,
+			State:    BreakerClosed,
+			config:   s.Breaker,
+		}
+		s.breakers[upstream] = result
+	}
+
+	return result
+}
+
+/**
+* Breakers: Returns the state of the circuits of the solver.
+* @return []et.Json
+**/
+func (s *Solver) Breakers() []et.Json {
+	s.muBreakers.Lock()
+	defer s.muBreakers.Unlock()
+
+	result := []et.Json{}
+	for _, b := range s.breakers {
+		result = append(result, b.ToJson())
+	}
+
+	return result
+}
+
+/**
+* ToJson
+* @return et.Json
+**/
+func (s *Breaker) ToJson() et.Json {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return et.Json{
+		"solver":    s.Solver,
+		"upstream":  s.Upstream,
+		"state":     s.State,
+		"failures":  s.Failures,
+		"opened_at": s.OpenedAt,
+	}
+}
+
+/**
+* Allow: Reports whether a request may go to the upstream. An open circuit turns
+* half open once its timeout passes and lets the trial requests through.
+* @return bool
+**/
+func (s *Breaker) Allow() bool {
+	if s == nil {
+		return true
+	}
+
+	s.mu.Lock()
+	changed := false
+	result := true
+	switch s.State {
+	case BreakerOpen:
+		if time.Since(s.OpenedAt) < time.Duration(s.config.Timeout) {
+			result = false
+			break
+		}
+		s.State = BreakerHalfOpen
+		s.trials = 1
+		s.successes = 0
+		changed = true
+	case BreakerHalfOpen:
+		if s.successes+s.trials >= s.config.HalfOpen {
+			result = false
+			break
+		}
+		s.trials++
+	}
+	s.mu.Unlock()
+
+	if changed {
+		s.publish()
+	}
+
+	return result
+}
+
+/**
+* Report: Feeds the circuit with the result of a request allowed through. A half open
+* circuit closes once HalfOpen trials succeeded.
+* @param failed bool
+**/
+func (s *Breaker) Report(failed bool) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	state := s.State
+	if !failed {
+		s.Failures = 0
+		if s.State == BreakerHalfOpen {
+			s.trials = max(s.trials-1, 0)
+			s.successes++
+			if s.successes >= s.config.HalfOpen {
+				s.State = BreakerClosed
+				s.trials = 0
+				s.successes = 0
+			}
+		}
+	} else {
+		s.Failures++
+		if s.State == BreakerHalfOpen || s.Failures >= s.config.Failures {
+			s.State = BreakerOpen
+			s.OpenedAt = time.Now()
+			s.trials = 0
+			s.successes = 0
+		}
+	}
+	changed := state != s.State
+	s.mu.Unlock()
+
+	if changed {
+		s.publish()
+	}
+}
+
+/**
+* release: Gives back a trial request that ended without a result.
+**/
+func (s *Breaker) release() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.State == BreakerHalfOpen && s.trials > 0 {
+		s.trials--
+	}
+}
+
+/**
+* publish: Announces a change of state of the circuit.
+**/
+func (s *Breaker) publish() {
+	event.Publish(EVENT_BREAKER_STATUS, s.ToJson())
+}
@@ -0,0 +1,148 @@
+package ettp
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+)
+
+func TestBreakerStates(t *testing.T) {
+	type step struct {
+		op    string
+		allow bool
+		state BreakerState
+	}
+
+	tests := []struct {
+		name   string
+		config BreakerConfig
+		steps  []step
+	}{
+		{
+			name:   "opens after consecutive failures",
+			config: BreakerConfig{Failures: 2, Timeout: Duration(time.Hour), HalfOpen: 1},
+			steps: []step{
+				{op: "fail", state: BreakerClosed},
+				{op: "fail", state: BreakerOpen},
+				{op: "allow", allow: false, state: BreakerOpen},
+			},
+		},
+		{
+			name:   "a success resets the failures",
+			config: BreakerConfig{Failures: 2, Timeout: Duration(time.Hour), HalfOpen: 1},
+			steps: []step{
+				{op: "fail", state: BreakerClosed},
+				{op: "success", state: BreakerClosed},
+				{op: "fail", state: BreakerClosed},
+			},
+		},
+		{
+			name:   "half open closes after HalfOpen successes",
+			config: BreakerConfig{Failures: 1, HalfOpen: 2},
+			steps: []step{
+				{op: "fail", state: BreakerOpen},
+				{op: "allow", allow: true, state: BreakerHalfOpen},
+				{op: "success", state: BreakerHalfOpen},
+				{op: "allow", allow: true, state: BreakerHalfOpen},
+				{op: "success", state: BreakerClosed},
+				{op: "allow", allow: true, state: BreakerClosed},
+			},
+		},
+		{
+			name:   "half open limits the trials",
+			config: BreakerConfig{Failures: 1, HalfOpen: 2},
+			steps: []step{
+				{op: "fail", state: BreakerOpen},
+				{op: "allow", allow: true, state: BreakerHalfOpen},
+				{op: "allow", allow: true, state: BreakerHalfOpen},
+				{op: "allow", allow: false, state: BreakerHalfOpen},
+				{op: "success", state: BreakerHalfOpen},
+				{op: "allow", allow: false, state: BreakerHalfOpen},
+			},
+		},
+		{
+			name:   "a failed trial opens again",
+			config: BreakerConfig{Failures: 1, HalfOpen: 2},
+			steps: []step{
+				{op: "fail", state: BreakerOpen},
+				{op: "allow", allow: true, state: BreakerHalfOpen},
+				{op: "success", state: BreakerHalfOpen},
+				{op: "allow", allow: true, state: BreakerHalfOpen},
+				{op: "fail", state: BreakerOpen},
+			},
+		},
+		{
+			name:   "a released trial is given back",
+			config: BreakerConfig{Failures: 1, HalfOpen: 1},
+			steps: []step{
+				{op: "fail", state: BreakerOpen},
+				{op: "allow", allow: true, state: BreakerHalfOpen},
+				{op: "allow", allow: false, state: BreakerHalfOpen},
+				{op: "release", state: BreakerHalfOpen},
+				{op: "allow", allow: true, state: BreakerHalfOpen},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			solver := &Solver{ID: "GET:/test", Breaker: &config}
+			breaker := solver.breaker("http://upstream")
+			for i, s := range tt.steps {
+				switch s.op {
+				case "allow":
+					if got := breaker.Allow(); got != s.allow {
+						t.Fatalf("step %d: allow = %v, want %v", i, got, s.allow)
+					}
+				case "fail":
+					breaker.Report(true)
+				case "success":
+					breaker.Report(false)
+				case "release":
+					breaker.release()
+				}
+
+				if breaker.State != s.state {
+					t.Fatalf("step %d %s: state = %s, want %s", i, s.op, breaker.State, s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want time.Duration
+	}{
+		{"duration string", `"1.5s"`, 1500 * time.Millisecond},
+		{"stored nanoseconds", `5000000000`, 5 * time.Second},
+		{"null", `null`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Duration
+			if err := json.Unmarshal([]byte(tt.data), &got); err != nil {
+				t.Fatal(err)
+			}
+			if time.Duration(got) != tt.want {
+				t.Fatalf("got %s, want %s", time.Duration(got), tt.want)
+			}
+		})
+	}
+
+	/* A route written by ToJson reads back the same */
+	policy := NewRetryPolicy(et.Json{"attempts": 3, "backoff": "250ms", "max_backoff": 2})
+	solver := &Solver{Timeout: Duration(3 * time.Second), Retry: policy}
+	data := solver.ToJson()
+	if got := parseDuration(data, "timeout"); got != 3*time.Second {
+		t.Errorf("timeout = %s, want 3s", got)
+	}
+	again := NewRetryPolicy(data.Json("retry"))
+	if again.Backoff != policy.Backoff || again.MaxBackoff != policy.MaxBackoff {
+		t.Errorf("retry = %v/%v, want %v/%v", again.Backoff, again.MaxBackoff, policy.Backoff, policy.MaxBackoff)
+	}
+}
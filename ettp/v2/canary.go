@@ -0,0 +1,366 @@
+package ettp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/event"
+	"github.com/cgalvisleon/et/middleware"
+	"github.com/cgalvisleon/et/msg"
+	"github.com/cgalvisleon/et/request"
+	"github.com/cgalvisleon/et/response"
+	"github.com/cgalvisleon/et/router"
+)
+
+const (
+	VersionHeader = "X-Api-Version"
+)
+
+/**
+* Variant: Version of a route taking Weight percent of its traffic, resolved by Solver.
+**/
+type Variant struct {
+	Version int    `json:"version"`
+	Solver  string `json:"solver"`
+	Weight  int    `json:"weight"`
+}
+
+/**
+* Split: Traffic split of a route between its stable version and the variants, which
+* take their weights and leave the rest to the stable one. Sticky is user, cookie:<name>
+* or header:<name>, so the same client stays on one version; without it every request
+* is drawn. The Override header, X-Api-Version by default, asks for a version directly.
+**/
+type Split struct {
+	Variants []*Variant `json:"variants"`
+	Sticky   string     `json:"sticky"`
+	Override string     `json:"override"`
+}
+
+/**
+* NewSplit: Builds a Split from its JSON definition, failing when the weights pass 100.
+* @param params et.Json
+* @return *Split, error
+**/
+func NewSplit(params et.Json) (*Split, error) {
+	if params.IsEmpty() {
+		return nil, nil
+	}
+
+	bt, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *Split
+	err = json.Unmarshal(bt, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, v := range result.Variants {
+		if v.Solver == "" {
+			return nil, fmt.Errorf(msg.MSG_RESOLVE_NOT_VALID, v.Solver)
+		}
+		if v.Weight < 0 {
+			return nil, fmt.Errorf(MSG_SPLIT_WEIGHT, v.Weight)
+		}
+		total += v.Weight
+	}
+	if total > 100 {
+		return nil, fmt.Errorf(MSG_SPLIT_WEIGHT, total)
+	}
+
+	if result.Override == "" {
+		result.Override = VersionHeader
+	}
+
+	return result, nil
+}
+
+/**
+* check: Validates the split against the route it goes on. A variant can not take the
+* stable version, as only the stable version goes through the pool of the route.
+* @param solver *Solver
+* @return error
+**/
+func (s *Split) check(solver *Solver) error {
+	if s == nil {
+		return nil
+	}
+
+	for _, v := range s.Variants {
+		if v.Version == solver.Version {
+			return fmt.Errorf(MSG_SPLIT_STABLE_VERSION, v.Version, solver.ID)
+		}
+	}
+
+	return nil
+}
+
+/**
+* stickyKey: Returns the value a sticky split assigns r by, empty when r lacks it.
+* @param r *http.Request
+* @return string
+**/
+func (s *Split) stickyKey(r *http.Request) string {
+	kind, name, _ := strings.Cut(s.Sticky, ":")
+	switch kind {
+	case "user":
+		if userId, ok := r.Context().Value(request.UserIdKey).(string); ok {
+			return userId
+		}
+		return claims(r).Str("userId")
+	case "cookie":
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	case "header":
+		return r.Header.Get(name)
+	default:
+		return ""
+	}
+}
+
+/**
+* variant: Picks the version of solver that serves r, returning its address and version.
+* @param solver *Solver, r *http.Request
+* @return string, int
+**/
+func (s *Split) variant(solver *Solver, r *http.Request) (string, int) {
+	if s == nil || len(s.Variants) == 0 {
+		return solver.Solver, solver.Version
+	}
+
+	if val := r.Header.Get(s.Override); val != "" {
+		version, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(val), "v"))
+		if err == nil {
+			for _, v := range s.Variants {
+				if v.Version == version {
+					return v.Solver, v.Version
+				}
+			}
+		}
+		return solver.Solver, solver.Version
+	}
+
+	bucket := rand.Intn(100)
+	if key := s.stickyKey(r); key != "" {
+		bucket = int(hashKey(solver.ID+":"+key) % 100)
+	}
+
+	for _, v := range s.Variants {
+		if bucket < v.Weight {
+			return v.Solver, v.Version
+		}
+		bucket -= v.Weight
+	}
+
+	return solver.Solver, solver.Version
+}
+
+/**
+* clone: Copies the stored definition of the solver.
+* @return *Solver, error
+**/
+func (s *Solver) clone() (*Solver, error) {
+	bt, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *Solver
+	err = json.Unmarshal(bt, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+/**
+* updateSolver: Replaces the route id with a copy changed by fn, so requests in flight
+* keep the solver they found.
+* @param id string, fn func(solver *Solver) error
+* @return *Solver, error
+**/
+func (s *Server) updateSolver(id string, fn func(solver *Solver) error) (*Solver, error) {
+	s.muRoutes.RLock()
+	current, ok := s.Solvers[id]
+	s.muRoutes.RUnlock()
+	if !ok || current.Kind == TpHandler {
+		return nil, fmt.Errorf(msg.MSG_SOLVER_NOT_FOUND, id)
+	}
+
+	solver, err := current.clone()
+	if err != nil {
+		return nil, err
+	}
+
+	err = fn(solver)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.loadSolver(solver)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Save()
+	return result, nil
+}
+
+/**
+* SetSplit: Splits the traffic of the route id between its versions.
+* @param id string, params et.Json
+* @return *Solver, error
+**/
+func (s *Server) SetSplit(id string, params et.Json) (*Solver, error) {
+	split, err := NewSplit(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.updateSolver(id, func(solver *Solver) error {
+		if err := split.check(solver); err != nil {
+			return err
+		}
+
+		solver.Split = split
+		return nil
+	})
+}
+
+/**
+* Promote: Makes version the stable version of the route id and ends its split.
+* Without version the only variant of the split is promoted. The pool of the route
+* served the old version, so the route leaves it and goes to the variant address.
+* @param id string, version int
+* @return *Solver, error
+**/
+func (s *Server) Promote(id string, version int) (*Solver, error) {
+	return s.updateSolver(id, func(solver *Solver) error {
+		if solver.Split == nil {
+			return fmt.Errorf(MSG_VERSION_NOT_FOUND, version, id)
+		}
+
+		var found *Variant
+		for _, v := range solver.Split.Variants {
+			if v.Version == version || (version == 0 && len(solver.Split.Variants) == 1) {
+				found = v
+				break
+			}
+		}
+		if found == nil {
+			return fmt.Errorf(MSG_VERSION_NOT_FOUND, version, id)
+		}
+
+		solver.Solver = found.Solver
+		solver.Version = found.Version
+		solver.Upstreams = nil
+		solver.Split = nil
+		return nil
+	})
+}
+
+/**
+* Rollback: Ends the split of the route id, sending all its traffic to the stable version.
+* @param id string
+* @return *Solver, error
+**/
+func (s *Server) Rollback(id string) (*Solver, error) {
+	return s.updateSolver(id, func(solver *Solver) error {
+		if solver.Split == nil {
+			return errors.New(MSG_SPLIT_NOT_FOUND)
+		}
+
+		solver.Split = nil
+		return nil
+	})
+}
+
+/**
+* publishRoute: Sends the route to the other replicas of the gateway.
+* @param solver *Solver
+**/
+func publishRoute(solver *Solver) {
+	event.Publish(router.EVENT_SET_ROUTER, et.Json{
+		"route": solver.ToJson(),
+	})
+}
+
+/**
+* canaryResult: Answers an admin canary operation and propagates its result.
+* @param w http.ResponseWriter, r *http.Request, solver *Solver, err error
+**/
+func canaryResult(w http.ResponseWriter, r *http.Request, solver *Solver, err error) {
+	metric := middleware.GetMetrics(r)
+	if err != nil {
+		metric.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	publishRoute(solver)
+	metric.ITEM(w, r, http.StatusOK, et.Item{
+		Ok:     true,
+		Result: solver.ToJson(),
+	})
+}
+
+/**
+* setSplit: Sets the split in the body, {"id": "GET:/users", "split": {...}}
+* @params w http.ResponseWriter
+* @params r *http.Request
+**/
+func (s *Server) setSplit(w http.ResponseWriter, r *http.Request) {
+	body, err := response.ScanBody(r.Body)
+	if err != nil {
+		canaryResult(w, r, nil, err)
+		return
+	}
+
+	solver, err := s.SetSplit(body.Str("id"), body.Json("split"))
+	canaryResult(w, r, solver, err)
+}
+
+/**
+* promoteVersion: Promotes the version in the body, {"id": "GET:/users", "version": 2}
+* @params w http.ResponseWriter
+* @params r *http.Request
+**/
+func (s *Server) promoteVersion(w http.ResponseWriter, r *http.Request) {
+	body, err := response.ScanBody(r.Body)
+	if err != nil {
+		canaryResult(w, r, nil, err)
+		return
+	}
+
+	solver, err := s.Promote(body.Str("id"), body.Int("version"))
+	canaryResult(w, r, solver, err)
+}
+
+/**
+* rollbackVersion: Ends the split of the route in the body, {"id": "GET:/users"}
+* @params w http.ResponseWriter
+* @params r *http.Request
+**/
+func (s *Server) rollbackVersion(w http.ResponseWriter, r *http.Request) {
+	body, err := response.ScanBody(r.Body)
+	if err != nil {
+		canaryResult(w, r, nil, err)
+		return
+	}
+
+	solver, err := s.Rollback(body.Str("id"))
+	canaryResult(w, r, solver, err)
+}
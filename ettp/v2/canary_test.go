@@ -0,0 +1,138 @@
+package ettp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cgalvisleon/et/et"
+)
+
+func TestSplitVariant(t *testing.T) {
+	solver := &Solver{ID: "GET:/items", Solver: "http://stable", Version: 1}
+	canary := func(weight int) *Split {
+		return &Split{
+			Variants: []*Variant{{Version: 2, Solver: "http://canary", Weight: weight}},
+			Sticky:   "header:X-User",
+			Override: VersionHeader,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		split   *Split
+		header  map[string]string
+		url     string
+		version int
+	}{
+		{name: "without split", split: nil, url: "http://stable", version: 1},
+		{name: "without variants", split: &Split{}, url: "http://stable", version: 1},
+		{name: "all the traffic", split: canary(100), url: "http://canary", version: 2},
+		{name: "none of the traffic", split: canary(0), url: "http://stable", version: 1},
+		{name: "override asks for the variant", split: canary(0), header: map[string]string{VersionHeader: "v2"}, url: "http://canary", version: 2},
+		{name: "override asks for the stable", split: canary(100), header: map[string]string{VersionHeader: "1"}, url: "http://stable", version: 1},
+		{name: "override of an unknown version", split: canary(100), header: map[string]string{VersionHeader: "9"}, url: "http://stable", version: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(GET, "/items", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+
+			url, version := tt.split.variant(solver, r)
+			if url != tt.url || version != tt.version {
+				t.Fatalf("got %s v%d, want %s v%d", url, version, tt.url, tt.version)
+			}
+		})
+	}
+
+	/* A sticky client stays on the version it was given */
+	split := canary(50)
+	for _, user := range []string{"a", "b", "c", "d", "e"} {
+		r := httptest.NewRequest(GET, "/items", nil)
+		r.Header.Set("X-User", user)
+		_, first := split.variant(solver, r)
+		for i := 0; i < 10; i++ {
+			if _, version := split.variant(solver, r); version != first {
+				t.Fatalf("user %s moved from v%d to v%d", user, first, version)
+			}
+		}
+	}
+}
+
+func TestSplitCheck(t *testing.T) {
+	solver := &Solver{ID: "GET:/items", Solver: "http://stable", Version: 1}
+	tests := []struct {
+		name    string
+		version int
+		fails   bool
+	}{
+		{"new version", 2, false},
+		{"stable version", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			split := &Split{Variants: []*Variant{{Version: tt.version, Solver: "http://canary", Weight: 10}}}
+			if err := split.check(solver); (err != nil) != tt.fails {
+				t.Fatalf("err = %v, want fail %v", err, tt.fails)
+			}
+		})
+	}
+}
+
+func TestPromotePooled(t *testing.T) {
+	upstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	stable := upstream("stable")
+	defer stable.Close()
+	variant := upstream("variant")
+	defer variant.Close()
+
+	s := newTestServer("gateway")
+
+	if _, err := s.SetRouter(GET, "/items", stable.URL+"/items", int(TpKeepHeader), et.Json{}, []string{}, 1, "items", false); err != nil {
+		t.Fatal(err)
+	}
+	id := "GET:/items"
+	if _, err := s.updateSolver(id, func(solver *Solver) error {
+		solver.Upstreams = NewUpstreams(et.Json{"targets": []et.Json{{"url": stable.URL}}})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetSplit(id, et.Json{"variants": []et.Json{{"version": 2, "solver": variant.URL + "/items", "weight": 0}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	reach := func() string {
+		r := httptest.NewRequest(GET, "/items", nil)
+		resolver, err := newResolver(r, s.Solvers[id], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, release, _, err := s.send(resolver, r, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer release()
+
+		bt, _ := io.ReadAll(res.Body)
+		return string(bt)
+	}
+
+	if got := reach(); got != "stable" {
+		t.Fatalf("before promote reached %s, want stable", got)
+	}
+
+	if _, err := s.Promote(id, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := reach(); got != "variant" {
+		t.Fatalf("after promote reached %s, want variant", got)
+	}
+}
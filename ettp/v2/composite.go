@@ -0,0 +1,539 @@
+package ettp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/middleware"
+	"github.com/cgalvisleon/et/trace"
+)
+
+type FailurePolicy string
+
+const (
+	FailPartial FailurePolicy = "partial"
+	FailAll     FailurePolicy = "fail"
+)
+
+var refRegex = regexp.MustCompile(`\{([\w\-]+(?:\.[\w\-]+)*)\}`)
+
+/**
+* Call: One upstream call of a composite route. URL, Header and the strings of Body are
+* templates where {name} is a param of the route, {query.name} a query value,
+* {body.path} a field of the client body, {header.name} a header of the client and
+* {call.path} a field of the result of an earlier call, which makes this call wait for it.
+* Only the trace context and the headers set in Header reach the call. Into is the dotted path the result
+* takes in the response, the name of the call by default.
+**/
+type Call struct {
+	Name     string                 `json:"name"`
+	Method   string                 `json:"method"`
+	URL      string                 `json:"url"`
+	Header   map[string]string      `json:"header"`
+	Body     map[string]interface{} `json:"body"`
+	Depends  []string               `json:"depends"`
+	Into     string                 `json:"into"`
+	Timeout  Duration               `json:"timeout"`
+	Required bool                   `json:"required"`
+	deps     []string               `json:"-"`
+}
+
+/**
+* Composite: Calls a route makes to build one response. Calls run in parallel unless
+* they depend on each other. With the partial policy failed calls are reported under
+* errors and the rest answered, unless a required one failed; with fail any failure
+* fails the request.
+**/
+type Composite struct {
+	Calls   []*Call       `json:"calls"`
+	Timeout Duration      `json:"timeout"`
+	Policy  FailurePolicy `json:"policy"`
+}
+
+/**
+* callResult
+**/
+type callResult struct {
+	value interface{}
+	err   error
+}
+
+/**
+* NewComposite: Builds a Composite from its JSON definition.
+* timeout of the composite and of its calls accept a duration string or a number of seconds.
+* @param params et.Json
+* @return *Composite
+**/
+func NewComposite(params et.Json) *Composite {
+	if params.IsEmpty() {
+		return nil
+	}
+
+	result := &Composite{
+		Timeout: Duration(parseDuration(params, "timeout")),
+		Policy:  FailurePolicy(params.Str("policy")),
+		Calls:   []*Call{},
+	}
+
+	for _, item := range params.ArrayJson("calls") {
+		header := map[string]string{}
+		for k, v := range item.Json("header") {
+			header[k] = fmt.Sprintf("%v", v)
+		}
+
+		result.Calls = append(result.Calls, &Call{
+			Name:     item.Str("name"),
+			Method:   strings.ToUpper(item.Str("method")),
+			URL:      item.Str("url"),
+			Header:   header,
+			Body:     item.Json("body"),
+			Depends:  item.ArrayStr("depends"),
+			Into:     item.Str("into"),
+			Timeout:  Duration(parseDuration(item, "timeout")),
+			Required: item.Bool("required"),
+		})
+	}
+
+	return result
+}
+
+/**
+* refs: Returns the references of the templates of the call.
+* @return []string
+**/
+func (s *Call) refs() []string {
+	result := []string{}
+	add := func(template string) {
+		for _, match := range refRegex.FindAllStringSubmatch(template, -1) {
+			result = append(result, match[1])
+		}
+	}
+
+	add(s.URL)
+	for _, v := range s.Header {
+		add(v)
+	}
+
+	var walk func(val interface{})
+	walk = func(val interface{}) {
+		switch v := val.(type) {
+		case string:
+			add(v)
+		case map[string]interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(s.Body)
+
+	return result
+}
+
+/**
+* prepare: Checks the calls and works out what each one waits for, failing on unknown
+* or cyclic dependencies.
+* @return error
+**/
+func (s *Composite) prepare() error {
+	if len(s.Calls) == 0 {
+		return errors.New(MSG_COMPOSITE_REQUIRED)
+	}
+
+	if s.Policy == "" {
+		s.Policy = FailPartial
+	}
+
+	calls := map[string]*Call{}
+	for _, call := range s.Calls {
+		if call.Name == "" || call.Name == "query" || call.Name == "body" || call.Name == "header" || calls[call.Name] != nil {
+			return fmt.Errorf(MSG_CALL_NAME_INVALID, call.Name)
+		}
+		if call.URL == "" {
+			return fmt.Errorf(MSG_CALL_URL_REQUIRED, call.Name)
+		}
+		if call.Method == "" {
+			call.Method = GET
+		}
+		calls[call.Name] = call
+	}
+
+	for _, call := range s.Calls {
+		deps := map[string]bool{}
+		for _, dep := range call.Depends {
+			if calls[dep] == nil {
+				return fmt.Errorf(MSG_CALL_DEPENDENCY, dep, call.Name)
+			}
+			deps[dep] = true
+		}
+
+		for _, ref := range call.refs() {
+			name, _, ok := strings.Cut(ref, ".")
+			if ok && calls[name] != nil {
+				deps[name] = true
+			}
+		}
+
+		call.deps = []string{}
+		for dep := range deps {
+			call.deps = append(call.deps, dep)
+		}
+	}
+
+	/* Depth first search, a call met again while being visited closes a cycle */
+	state := map[string]int{}
+	var visit func(call *Call) error
+	visit = func(call *Call) error {
+		switch state[call.Name] {
+		case 1:
+			return fmt.Errorf(MSG_CALL_CYCLE, call.Name)
+		case 2:
+			return nil
+		}
+
+		state[call.Name] = 1
+		for _, dep := range call.deps {
+			if err := visit(calls[dep]); err != nil {
+				return err
+			}
+		}
+		state[call.Name] = 2
+
+		return nil
+	}
+
+	for _, call := range s.Calls {
+		if err := visit(call); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/**
+* composition: State of one composite request, the sources its templates read from.
+**/
+type composition struct {
+	r       *http.Request
+	body    map[string]interface{}
+	results map[string]*callResult
+	fatal   error
+	mu      sync.Mutex
+}
+
+/**
+* lookup: Resolves a template reference.
+* @param ref string
+* @return interface{}, bool
+**/
+func (s *composition) lookup(ref string) (interface{}, bool) {
+	name, path, ok := strings.Cut(ref, ".")
+	if !ok {
+		val := s.r.PathValue(ref)
+		return val, val != ""
+	}
+
+	switch name {
+	case "query":
+		values, ok := s.r.URL.Query()[path]
+		if !ok || len(values) == 0 {
+			return nil, false
+		}
+		return values[0], true
+	case "body":
+		if s.body == nil {
+			return nil, false
+		}
+		return getField(s.body, path)
+	case "header":
+		val := s.r.Header.Get(path)
+		return val, val != ""
+	}
+
+	s.mu.Lock()
+	result, ok := s.results[name]
+	s.mu.Unlock()
+	if !ok || result.err != nil {
+		return nil, false
+	}
+
+	data, ok := asMap(result.value)
+	if !ok {
+		return nil, false
+	}
+
+	return getField(data, path)
+}
+
+/**
+* render: Fills the references of template, escaping the values when they go in a url.
+* @param template string, escape bool
+* @return string
+**/
+func (s *composition) render(template string, escape bool) string {
+	return refRegex.ReplaceAllStringFunc(template, func(tag string) string {
+		val, ok := s.lookup(strings.Trim(tag, "{}"))
+		if !ok {
+			return ""
+		}
+
+		result := fmt.Sprintf("%v", val)
+		if n, ok := val.(float64); ok && n == math.Trunc(n) {
+			result = strconv.FormatFloat(n, 'f', -1, 64)
+		}
+		if escape {
+			return url.PathEscape(result)
+		}
+		return result
+	})
+}
+
+/**
+* renderValue: Fills the templates of a body. A string made of a single reference takes
+* the referenced value as it is, keeping its type.
+* @param val interface{}
+* @return interface{}
+**/
+func (s *composition) renderValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case string:
+		if match := refRegex.FindStringSubmatch(v); match != nil && match[0] == v {
+			result, _ := s.lookup(match[1])
+			return result
+		}
+		return s.render(v, false)
+	case map[string]interface{}:
+		result := map[string]interface{}{}
+		for k, item := range v {
+			result[k] = s.renderValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = s.renderValue(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+/**
+* call: Makes one call of the composition.
+* @param ctx context.Context, comp *composition, call *Call, timeout time.Duration
+* @return interface{}, error
+**/
+func (s *Server) call(ctx context.Context, comp *composition, call *Call, timeout time.Duration) (interface{}, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var body io.Reader
+	if len(call.Body) > 0 {
+		bt, err := json.Marshal(comp.renderValue(call.Body))
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(bt)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, call.Method, comp.render(call.URL, true), body)
+	if err != nil {
+		return nil, err
+	}
+
+	/* Client credentials must not leak to every call, they go only when Header asks for them */
+	req.Header = trace.Outbound(comp.r.Context(), http.Header{})
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range call.Header {
+		req.Header.Set(k, comp.render(v, false))
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	bt, fits, err := readLimited(res.Body, transformMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	if !fits {
+		return nil, fmt.Errorf(MSG_BODY_TOO_LARGE, transformMaxSize)
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf(MSG_CALL_FAILED, call.Name, res.StatusCode)
+	}
+
+	return decodeBody(bt), nil
+}
+
+/**
+* compose: Runs the calls of the composite, each one as soon as the ones it depends on
+* finish, and merges their results.
+* @param resolver *Resolver, r *http.Request
+* @return et.Json, int, error
+**/
+func (s *Server) compose(resolver *Resolver, r *http.Request) (et.Json, int, error) {
+	composite := resolver.solver.Composite
+	comp := &composition{
+		r:       r,
+		results: map[string]*callResult{},
+	}
+
+	if r.Body != nil && r.Body != http.NoBody && isJson(r.Header) {
+		bt, err := io.ReadAll(r.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, http.StatusRequestEntityTooLarge, fmt.Errorf(MSG_BODY_TOO_LARGE, transformMaxSize)
+		} else if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+
+		if len(bt) > 0 {
+			if err := json.Unmarshal(bt, &comp.body); err != nil {
+				return nil, http.StatusBadRequest, errors.New(MSG_BODY_INVALID)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	done := map[string]chan struct{}{}
+	for _, call := range composite.Calls {
+		done[call.Name] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+	for _, call := range composite.Calls {
+		wg.Add(1)
+		go func(call *Call) {
+			defer wg.Done()
+			defer close(done[call.Name])
+
+			var value interface{}
+			var err error
+			for _, dep := range call.deps {
+				select {
+				case <-ctx.Done():
+				case <-done[dep]:
+				}
+
+				comp.mu.Lock()
+				result, ok := comp.results[dep]
+				comp.mu.Unlock()
+				if !ok || result.err != nil {
+					err = fmt.Errorf(MSG_CALL_SKIPPED, call.Name, dep)
+					break
+				}
+			}
+
+			if err == nil {
+				timeout := call.Timeout
+				if timeout <= 0 {
+					timeout = composite.Timeout
+				}
+				if timeout <= 0 {
+					timeout = resolver.solver.Timeout
+				}
+				value, err = s.call(ctx, comp, call, time.Duration(timeout))
+			}
+
+			/* The first fatal failure is the one reported, the rest follow from cancelling */
+			fatal := err != nil && (composite.Policy == FailAll || call.Required)
+			comp.mu.Lock()
+			comp.results[call.Name] = &callResult{value: value, err: err}
+			if fatal && comp.fatal == nil {
+				comp.fatal = err
+			}
+			comp.mu.Unlock()
+
+			if fatal {
+				cancel()
+			}
+		}(call)
+	}
+	wg.Wait()
+
+	if comp.fatal != nil {
+		if errors.Is(comp.fatal, context.DeadlineExceeded) {
+			return nil, http.StatusGatewayTimeout, comp.fatal
+		}
+		return nil, http.StatusBadGateway, comp.fatal
+	}
+
+	result := et.Json{}
+	failures := et.Json{}
+	for _, call := range composite.Calls {
+		item := comp.results[call.Name]
+		if item.err != nil {
+			failures[call.Name] = item.err.Error()
+			continue
+		}
+
+		into := call.Into
+		if into == "" {
+			into = call.Name
+		}
+		setField(result, into, item.value)
+	}
+
+	if len(failures) > 0 {
+		result["errors"] = failures
+	}
+
+	return result, http.StatusOK, nil
+}
+
+/**
+* handlerComposite: Answers a composite route with the merged results of its calls.
+* @params w http.ResponseWriter, r *http.Request
+**/
+func (s *Server) handlerComposite(w http.ResponseWriter, r *http.Request) {
+	metric := middleware.GetMetrics(r)
+	resolver, ok := r.Context().Value(ResoluteKey).(*Resolver)
+	if !ok || resolver.solver.Composite == nil {
+		s.HTTPError(resolver, metric, w, r, http.StatusInternalServerError, "resolver not found")
+		return
+	}
+
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, transformMaxSize)
+	}
+
+	result, status, err := s.compose(resolver, r)
+	if err != nil {
+		s.HTTPError(resolver, metric, w, r, status, err.Error())
+		return
+	}
+
+	resolver.setStatus(TpStatusSuccess)
+	s.deleteRequest(resolver.ID)
+	metric.JSON(w, r, status, result)
+}
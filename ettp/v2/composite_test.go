@@ -0,0 +1,131 @@
+package ettp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cgalvisleon/et/trace"
+)
+
+/**
+* compositeRequest: Runs the calls of composite for a request with body and header.
+* @param t *testing.T, composite *Composite, body string, header map[string]string
+* @return map[string]interface{}, int, error
+**/
+func compositeRequest(t *testing.T, composite *Composite, body string, header map[string]string) (map[string]interface{}, int, error) {
+	t.Helper()
+	if err := composite.prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(POST, "/orders/7", strings.NewReader(body))
+	r.SetPathValue("id", "7")
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	r = r.WithContext(trace.WithContext(r.Context(), trace.New()))
+	r.Body = http.MaxBytesReader(httptest.NewRecorder(), r.Body, transformMaxSize)
+
+	server := &Server{client: &http.Client{}}
+	result, status, err := server.compose(&Resolver{solver: &Solver{Composite: composite}}, r)
+	if err != nil {
+		return nil, status, err
+	}
+
+	bt, _ := json.Marshal(result)
+	data := map[string]interface{}{}
+	json.Unmarshal(bt, &data)
+	return data, status, nil
+}
+
+func TestComposeHeaders(t *testing.T) {
+	var received http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"7"}`))
+	}))
+	defer upstream.Close()
+
+	composite := &Composite{Calls: []*Call{{
+		Name:   "order",
+		URL:    upstream.URL + "/orders/{id}",
+		Header: map[string]string{"X-User": "{header.X-User}"},
+	}}}
+	_, _, err := compositeRequest(t, composite, `{}`, map[string]string{
+		"Authorization": "Bearer secret",
+		"Cookie":        "session=1",
+		"X-Api-Key":     "key",
+		"X-User":        "ana",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"Authorization", "Cookie", "X-Api-Key"} {
+		if received.Get(name) != "" {
+			t.Errorf("%s reached the call", name)
+		}
+	}
+	if received.Get("X-User") != "ana" {
+		t.Errorf("X-User = %q, want ana", received.Get("X-User"))
+	}
+	if received.Get("Traceparent") == "" {
+		t.Error("traceparent did not reach the call")
+	}
+}
+
+func TestComposeBodies(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/large" {
+			w.Write([]byte(`"` + strings.Repeat("a", transformMaxSize) + `"`))
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer upstream.Close()
+
+	calls := func() *Composite {
+		return &Composite{Calls: []*Call{
+			{Name: "echo", Method: POST, URL: upstream.URL + "/echo", Body: map[string]interface{}{"qty": "{body.qty}"}},
+			{Name: "large", URL: upstream.URL + "/large"},
+		}}
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "valid body", body: `{"qty":2}`, status: http.StatusOK},
+		{name: "invalid body", body: `{"qty":`, status: http.StatusBadRequest},
+		{name: "body over the limit", body: `{"qty":"` + strings.Repeat("a", transformMaxSize) + `"}`, status: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, status, err := compositeRequest(t, calls(), tt.body, nil)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d, err %v", status, tt.status, err)
+			}
+			if err != nil {
+				return
+			}
+
+			echo, _ := data["echo"].(map[string]interface{})
+			if echo["qty"] != float64(2) {
+				t.Errorf("echo = %v", data["echo"])
+			}
+			failures, _ := data["errors"].(map[string]interface{})
+			if failures["large"] == nil {
+				t.Errorf("large response was not rejected, got %v", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,553 @@
+package ettp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cgalvisleon/et/cache"
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/event"
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/middleware"
+	"github.com/cgalvisleon/et/reg"
+	"github.com/cgalvisleon/et/request"
+	"github.com/cgalvisleon/et/response"
+	"github.com/cgalvisleon/et/utility"
+)
+
+const (
+	ConsumerKey            request.ContextKey = "consumer"
+	ConsumerHeader                            = "X-Consumer-Id"
+	EVENT_SET_CONSUMER                        = "event:apigateway:set:consumer"
+	EVENT_REMOVE_CONSUMER                     = "event:apigateway:remove:consumer"
+	dailyUsageExpiration                      = 35 * 24 * time.Hour
+	monthlyUsageExpiration                    = 400 * 24 * time.Hour
+)
+
+/**
+* Consumer: Partner calling the gateway with an API key. The key is <id>.<secret> and
+* only the hash of the secret is kept. Routes holds route ids and Packages package
+* names the consumer may call, any of them when both are empty. Daily and Monthly are
+* request quotas, zero for no limit.
+**/
+type Consumer struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Scopes    []string  `json:"scopes"`
+	Routes    []string  `json:"routes"`
+	Packages  []string  `json:"packages"`
+	Daily     int64     `json:"daily"`
+	Monthly   int64     `json:"monthly"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+/**
+* ToJson: Describes the consumer without the hash of its key.
+* @return et.Json
+**/
+func (s *Consumer) ToJson() et.Json {
+	return et.Json{
+		"id":         s.ID,
+		"name":       s.Name,
+		"scopes":     s.Scopes,
+		"routes":     s.Routes,
+		"packages":   s.Packages,
+		"daily":      s.Daily,
+		"monthly":    s.Monthly,
+		"disabled":   s.Disabled,
+		"created_at": s.CreatedAt,
+		"updated_at": s.UpdatedAt,
+	}
+}
+
+/**
+* allows: Reports whether the consumer may call solver.
+* @param solver *Solver
+* @return bool
+**/
+func (s *Consumer) allows(solver *Solver) bool {
+	if len(s.Routes) == 0 && len(s.Packages) == 0 {
+		return true
+	}
+
+	return slices.Contains(s.Routes, solver.ID) || slices.Contains(s.Packages, solver.PackageName)
+}
+
+/**
+* hasScopes: Reports whether the consumer holds every scope.
+* @param scopes []string
+* @return bool
+**/
+func (s *Consumer) hasScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(s.Scopes, scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/**
+* newSecret
+* @return string, error
+**/
+func newSecret() (string, error) {
+	bt := make([]byte, 24)
+	if _, err := rand.Read(bt); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(bt), nil
+}
+
+/**
+* usageKey: Cache key of the requests of consumer id in the period, a day as 20060102
+* or a month as 200601.
+* @param id, period string
+* @return string
+**/
+func usageKey(id, period string) string {
+	return fmt.Sprintf("apigateway:usage:%s:%s", id, period)
+}
+
+/**
+* consumers: Registry of the API keys of the gateway.
+**/
+type consumers struct {
+	items    map[string]*Consumer
+	verified sync.Map
+	mu       sync.RWMutex
+}
+
+/**
+* newConsumers
+* @return *consumers
+**/
+func newConsumers() *consumers {
+	return &consumers{
+		items: map[string]*Consumer{},
+	}
+}
+
+/**
+* list: Returns the consumers sorted by id.
+* @return []*Consumer
+**/
+func (s *consumers) list() []*Consumer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*Consumer, 0, len(s.items))
+	for _, item := range s.items {
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result
+}
+
+/**
+* get
+* @param id string
+* @return *Consumer, bool
+**/
+func (s *consumers) get(id string) (*Consumer, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result, ok := s.items[id]
+	return result, ok
+}
+
+/**
+* set: Stores consumer, forgetting the keys verified so far.
+* @param consumer *Consumer
+**/
+func (s *consumers) set(consumer *Consumer) {
+	s.mu.Lock()
+	s.items[consumer.ID] = consumer
+	s.mu.Unlock()
+	s.verified.Clear()
+}
+
+/**
+* remove
+* @param id string
+* @return bool
+**/
+func (s *consumers) remove(id string) bool {
+	s.mu.Lock()
+	_, ok := s.items[id]
+	delete(s.items, id)
+	s.mu.Unlock()
+	s.verified.Clear()
+
+	return ok
+}
+
+/**
+* verify: Returns the consumer of key. Keys already checked skip the hash comparison.
+* @param key string
+* @return *Consumer, error
+**/
+func (s *consumers) verify(key string) (*Consumer, error) {
+	id, secret, ok := strings.Cut(key, ".")
+	if !ok {
+		return nil, errors.New(MSG_API_KEY_INVALID)
+	}
+
+	result, ok := s.get(id)
+	if !ok || result.Disabled {
+		return nil, errors.New(MSG_API_KEY_INVALID)
+	}
+
+	digest := utility.Sha256(key)
+	if _, ok := s.verified.Load(digest); ok {
+		return result, nil
+	}
+
+	if !utility.Match(result.Hash, secret) {
+		return nil, errors.New(MSG_API_KEY_INVALID)
+	}
+	s.verified.Store(digest, true)
+
+	return result, nil
+}
+
+/**
+* SetConsumer: Creates or updates a consumer from its JSON definition. The API key is
+* returned when the consumer is created or rotate is true, it cannot be read again.
+* @param params et.Json
+* @return *Consumer, string, error
+**/
+func (s *Server) SetConsumer(params et.Json) (*Consumer, string, error) {
+	now := utility.Now()
+	id := params.Str("id")
+	current, ok := s.consumers.get(id)
+	if id != "" && !ok {
+		return nil, "", fmt.Errorf(MSG_CONSUMER_NOT_FOUND, id)
+	}
+
+	result := &Consumer{
+		ID:        reg.ULID(),
+		CreatedAt: now,
+	}
+	if ok {
+		result.ID = current.ID
+		result.Hash = current.Hash
+		result.CreatedAt = current.CreatedAt
+	}
+	result.Name = params.Str("name")
+	result.Scopes = params.ArrayStr("scopes")
+	result.Routes = params.ArrayStr("routes")
+	result.Packages = params.ArrayStr("packages")
+	result.Daily = params.Int64("daily")
+	result.Monthly = params.Int64("monthly")
+	result.Disabled = params.Bool("disabled")
+	result.UpdatedAt = now
+
+	key := ""
+	if !ok || params.Bool("rotate") {
+		secret, err := newSecret()
+		if err != nil {
+			return nil, "", err
+		}
+
+		hash, err := utility.Hash(secret)
+		if err != nil {
+			return nil, "", err
+		}
+		result.Hash = hash
+		key = result.ID + "." + secret
+	}
+
+	s.consumers.set(result)
+	s.Save()
+	event.Publish(EVENT_SET_CONSUMER, et.Json{"consumer": result})
+
+	return result, key, nil
+}
+
+/**
+* DeleteConsumer
+* @param id string
+* @return error
+**/
+func (s *Server) DeleteConsumer(id string) error {
+	if !s.consumers.remove(id) {
+		return fmt.Errorf(MSG_CONSUMER_NOT_FOUND, id)
+	}
+
+	s.Save()
+	event.Publish(EVENT_REMOVE_CONSUMER, et.Json{"id": id})
+
+	return nil
+}
+
+/**
+* Usage: Requests of the consumer id this month, by day.
+* @param id string
+* @return et.Json, error
+**/
+func (s *Server) Usage(id string) (et.Json, error) {
+	consumer, ok := s.consumers.get(id)
+	if !ok {
+		return nil, fmt.Errorf(MSG_CONSUMER_NOT_FOUND, id)
+	}
+
+	now := utility.Now()
+	days := et.Json{}
+	for day := 1; day <= now.Day(); day++ {
+		date := time.Date(now.Year(), now.Month(), day, 0, 0, 0, 0, now.Location()).Format("20060102")
+		val, _ := cache.Get(usageKey(id, date), "0")
+		days[date], _ = strconv.ParseInt(val, 10, 64)
+	}
+
+	month, _ := cache.Get(usageKey(id, now.Format("200601")), "0")
+	monthly, _ := strconv.ParseInt(month, 10, 64)
+
+	return et.Json{
+		"consumer": consumer.ToJson(),
+		"month":    now.Format("200601"),
+		"monthly":  monthly,
+		"days":     days,
+	}, nil
+}
+
+/**
+* quota: Counts one request of consumer in the period and writes the quota headers,
+* returning the seconds until the period ends when the quota is exhausted. Fails open
+* when the cache service is not available.
+* @param w http.ResponseWriter, consumer *Consumer, name, period string, limit int64, reset time.Time, expiration time.Duration
+* @return int64, bool
+**/
+func quota(w http.ResponseWriter, consumer *Consumer, name, period string, limit int64, reset time.Time, expiration time.Duration) (int64, bool) {
+	key := usageKey(consumer.ID, period)
+	used := cache.Incr(key, expiration)
+	if limit <= 0 || used == 0 {
+		return 0, true
+	}
+
+	retry := int64(time.Until(reset).Seconds()) + 1
+	header := w.Header()
+	header.Set(fmt.Sprintf("X-Quota-%s-Limit", name), strconv.FormatInt(limit, 10))
+	header.Set(fmt.Sprintf("X-Quota-%s-Remaining", name), strconv.FormatInt(max(limit-used, 0), 10))
+	header.Set(fmt.Sprintf("X-Quota-%s-Reset", name), strconv.FormatInt(retry, 10))
+	if used > limit {
+		/* A rejected request does not count as usage */
+		cache.Decr(key)
+		return retry, false
+	}
+
+	return 0, true
+}
+
+/**
+* consume: Wraps the route handler with the API key check of the Solver, if it asks for one.
+* The consumer must hold the scopes of the route, be allowed to call it and have quota
+* left; the upstream gets its id instead of the key.
+* @param resolver *Resolver, h http.HandlerFunc
+* @return http.HandlerFunc
+**/
+func (s *Server) consume(resolver *Resolver, h http.HandlerFunc) http.HandlerFunc {
+	solver := resolver.solver
+	if solver == nil || !solver.ApiKey {
+		return h
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		metric := middleware.GetMetrics(r)
+		consumer, err := s.consumers.verify(r.Header.Get(middleware.ApiKeyHeader))
+		if err != nil {
+			s.HTTPError(resolver, metric, w, r, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if !consumer.allows(solver) || !consumer.hasScopes(solver.Scopes) {
+			s.HTTPError(resolver, metric, w, r, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+			return
+		}
+
+		now := utility.Now()
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		retry, ok := quota(w, consumer, "Daily", now.Format("20060102"), consumer.Daily, day.AddDate(0, 0, 1), dailyUsageExpiration)
+		if ok {
+			month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+			retry, ok = quota(w, consumer, "Monthly", now.Format("200601"), consumer.Monthly, month.AddDate(0, 1, 0), monthlyUsageExpiration)
+			if !ok {
+				/* The day gave its request back, the month refused it */
+				cache.Decr(usageKey(consumer.ID, now.Format("20060102")))
+			}
+		}
+		if !ok {
+			w.Header().Set("Retry-After", strconv.FormatInt(retry, 10))
+			s.HTTPError(resolver, metric, w, r, http.StatusTooManyRequests, MSG_QUOTA_EXCEEDED)
+			return
+		}
+
+		r.Header.Del(middleware.ApiKeyHeader)
+		r.Header.Set(ConsumerHeader, consumer.ID)
+		ctx := context.WithValue(r.Context(), ConsumerKey, consumer)
+		h(w, r.WithContext(ctx))
+	}
+}
+
+/**
+* eventSetConsumer
+* @param m event.Message
+**/
+func (s *Server) eventSetConsumer(m event.Message) {
+	if m.Myself {
+		return
+	}
+
+	bt, err := json.Marshal(m.Data.Json("consumer"))
+	if err != nil {
+		logs.Alertf(`eventSetConsumer error:%s`, err.Error())
+		return
+	}
+
+	var consumer *Consumer
+	err = json.Unmarshal(bt, &consumer)
+	if err != nil || consumer == nil || consumer.ID == "" {
+		logs.Alertf(`eventSetConsumer error:%v`, err)
+		return
+	}
+
+	s.consumers.set(consumer)
+}
+
+/**
+* eventRemoveConsumer
+* @param m event.Message
+**/
+func (s *Server) eventRemoveConsumer(m event.Message) {
+	if m.Myself {
+		return
+	}
+
+	s.consumers.remove(m.Data.Str("id"))
+}
+
+/**
+* getConsumers: Lists the consumers, or one with ?id=
+* @params w http.ResponseWriter
+* @params r *http.Request
+**/
+func (s *Server) getConsumers(w http.ResponseWriter, r *http.Request) {
+	metric := middleware.GetMetrics(r)
+
+	id := r.URL.Query().Get("id")
+	if id != "" {
+		consumer, ok := s.consumers.get(id)
+		if !ok {
+			metric.HTTPError(w, r, http.StatusNotFound, fmt.Sprintf(MSG_CONSUMER_NOT_FOUND, id))
+			return
+		}
+
+		metric.ITEM(w, r, http.StatusOK, et.Item{Ok: true, Result: consumer.ToJson()})
+		return
+	}
+
+	result := et.Items{Result: []et.Json{}}
+	for _, consumer := range s.consumers.list() {
+		result.Add(consumer.ToJson())
+	}
+
+	metric.ITEMS(w, r, http.StatusOK, result)
+}
+
+/**
+* upsetConsumer: Creates or updates the consumer in the body. The response holds the
+* api_key when one was issued.
+* @params w http.ResponseWriter
+* @params r *http.Request
+**/
+func (s *Server) upsetConsumer(w http.ResponseWriter, r *http.Request) {
+	metric := middleware.GetMetrics(r)
+
+	body, err := response.ScanBody(r.Body)
+	if err != nil {
+		metric.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	consumer, key, err := s.SetConsumer(body)
+	if err != nil {
+		metric.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result := consumer.ToJson()
+	if key != "" {
+		result["api_key"] = key
+	}
+
+	metric.ITEM(w, r, http.StatusOK, et.Item{Ok: true, Result: result})
+}
+
+/**
+* deleteConsumer
+* @params w http.ResponseWriter
+* @params r *http.Request
+**/
+func (s *Server) deleteConsumer(w http.ResponseWriter, r *http.Request) {
+	metric := middleware.GetMetrics(r)
+
+	err := s.DeleteConsumer(r.PathValue("id"))
+	if err != nil {
+		metric.HTTPError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	metric.ITEM(w, r, http.StatusOK, et.Item{
+		Ok: true,
+		Result: et.Json{
+			"message": MSG_CONSUMER_DELETE,
+		}})
+}
+
+/**
+* getUsage: Reports the usage of every consumer this month, or of one with ?id=
+* @params w http.ResponseWriter
+* @params r *http.Request
+**/
+func (s *Server) getUsage(w http.ResponseWriter, r *http.Request) {
+	metric := middleware.GetMetrics(r)
+
+	ids := []string{}
+	if id := r.URL.Query().Get("id"); id != "" {
+		ids = append(ids, id)
+	} else {
+		for _, consumer := range s.consumers.list() {
+			ids = append(ids, consumer.ID)
+		}
+	}
+
+	result := et.Items{Result: []et.Json{}}
+	for _, id := range ids {
+		usage, err := s.Usage(id)
+		if err != nil {
+			metric.HTTPError(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		result.Add(usage)
+	}
+
+	metric.ITEMS(w, r, http.StatusOK, result)
+}
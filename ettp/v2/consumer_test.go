@@ -0,0 +1,76 @@
+package ettp
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cgalvisleon/et/cache"
+	"github.com/cgalvisleon/et/envar"
+)
+
+func TestConsumerAllows(t *testing.T) {
+	solver := &Solver{ID: "GET:/items", PackageName: "items", Scopes: []string{"items:read"}}
+	tests := []struct {
+		name     string
+		consumer *Consumer
+		allowed  bool
+	}{
+		{name: "any route", consumer: &Consumer{Scopes: []string{"items:read"}}, allowed: true},
+		{name: "allowed route", consumer: &Consumer{Routes: []string{"GET:/items"}, Scopes: []string{"items:read", "orders:read"}}, allowed: true},
+		{name: "allowed package", consumer: &Consumer{Packages: []string{"items"}, Scopes: []string{"items:read"}}, allowed: true},
+		{name: "other routes", consumer: &Consumer{Routes: []string{"GET:/orders"}, Packages: []string{"orders"}, Scopes: []string{"items:read"}}},
+		{name: "missing scope", consumer: &Consumer{Scopes: []string{"orders:read"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.consumer.allows(solver) && tt.consumer.hasScopes(solver.Scopes)
+			if got != tt.allowed {
+				t.Fatalf("allowed = %v, want %v", got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestQuota(t *testing.T) {
+	if envar.GetStr("REDIS_HOST", "") == "" {
+		t.Skip("REDIS_HOST not set, the quota is counted in Redis")
+	}
+	if err := cache.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		limit     int64
+		calls     int
+		allowed   []bool
+		remaining string
+	}{
+		{name: "without limit", limit: 0, calls: 3, allowed: []bool{true, true, true}},
+		{name: "within the limit", limit: 3, calls: 2, allowed: []bool{true, true}, remaining: "1"},
+		{name: "past the limit", limit: 2, calls: 3, allowed: []bool{true, true, false}, remaining: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consumer := &Consumer{ID: fmt.Sprintf("test-%d", time.Now().UnixNano())}
+			reset := time.Now().Add(time.Hour)
+			var w *httptest.ResponseRecorder
+			for i := 0; i < tt.calls; i++ {
+				w = httptest.NewRecorder()
+				retry, ok := quota(w, consumer, "Daily", "test", tt.limit, reset, time.Minute)
+				if ok != tt.allowed[i] {
+					t.Fatalf("call %d: allowed = %v, want %v", i, ok, tt.allowed[i])
+				}
+				if !ok && retry <= 0 {
+					t.Errorf("call %d: retry = %d, want the seconds to reset", i, retry)
+				}
+			}
+
+			if got := w.Header().Get("X-Quota-Daily-Remaining"); got != tt.remaining {
+				t.Errorf("remaining = %q, want %q", got, tt.remaining)
+			}
+		})
+	}
+}
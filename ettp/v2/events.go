@@ -1,6 +1,9 @@
 package ettp
 
 import (
+	"encoding/json"
+
+	"github.com/cgalvisleon/et/et"
 	"github.com/cgalvisleon/et/event"
 	"github.com/cgalvisleon/et/logs"
 	"github.com/cgalvisleon/et/router"
@@ -31,6 +34,16 @@ func (s *Server) initEvents() error {
 		return err
 	}
 
+	err = event.Subscribe(EVENT_SET_CONSUMER, s.eventSetConsumer)
+	if err != nil {
+		return err
+	}
+
+	err = event.Subscribe(EVENT_REMOVE_CONSUMER, s.eventRemoveConsumer)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -45,7 +58,7 @@ func (s *Server) eventSetResolve(m event.Message) {
 
 	data := m.Data
 	method := data.Str("method")
-	path := data.Str("path")
+	path := routePath(data.Str("host"), data.Str("path"))
 	resolve := data.Str("resolve")
 	header := data.Json("header")
 	typeHeader := data.Int("tp_header")
@@ -68,18 +81,63 @@ func (s *Server) eventSetRouter(m event.Message) {
 	}
 
 	data := m.Data
+	if route := data.Json("route"); !route.IsEmpty() {
+		s.eventSetSolver(route)
+		return
+	}
+
 	method := data.Str("method")
-	path := data.Str("path")
+	path := routePath(data.Str("host"), data.Str("path"))
 	resolve := data.Str("resolve")
 	typeHeader := data.Int("type_header")
 	header := data.Json("header")
 	excludeHeader := data.ArrayStr("exclude_header")
 	version := data.Int("version")
 	packageName := data.Str("package_name")
-	_, err := s.SetRouter(method, path, resolve, typeHeader, header, excludeHeader, version, packageName, true)
+	var result *Solver
+	var err error
+	switch StringToTypeRouter(data.Str("kind")) {
+	case TpComposite:
+		result, err = s.SetComposite(method, path, data.Json("composite"), version, packageName, false)
+	case TpRpc:
+		result, err = s.SetRpc(method, path, resolve, version, packageName, false)
+	default:
+		result, err = s.SetRouter(method, path, resolve, typeHeader, header, excludeHeader, version, packageName, false)
+	}
 	if err != nil {
 		logs.Alertf(`eventSetRouter error:%s`, err.Error())
+		return
 	}
+
+	result.setConfig(data)
+	s.Save()
+}
+
+/**
+* eventSetSolver: Sets a route sent by another replica as it is stored.
+* @param route et.Json
+**/
+func (s *Server) eventSetSolver(route et.Json) {
+	bt, err := json.Marshal(route)
+	if err != nil {
+		logs.Alertf(`eventSetRouter error:%s`, err.Error())
+		return
+	}
+
+	var solver *Solver
+	err = json.Unmarshal(bt, &solver)
+	if err != nil {
+		logs.Alertf(`eventSetRouter error:%s`, err.Error())
+		return
+	}
+
+	_, err = s.loadSolver(solver)
+	if err != nil {
+		logs.Alertf(`eventSetRouter error:%s`, err.Error())
+		return
+	}
+
+	s.Save()
 }
 
 /**
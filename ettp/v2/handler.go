@@ -1,13 +1,20 @@
 package ettp
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/cgalvisleon/et/logs"
 	"github.com/cgalvisleon/et/middleware"
+	"github.com/cgalvisleon/et/msg"
 	"github.com/cgalvisleon/et/request"
+	"github.com/cgalvisleon/et/trace"
 )
 
 var commonHeader = make(map[string]bool)
@@ -49,6 +56,41 @@ func (s *Server) HTTPSuccess(resolver *Resolver, metric *middleware.Metrics, rw
 	metric.DoneHTTP(rw)
 }
 
+/**
+* setHeader: Copies the upstream headers to the client, skipping the ones the
+* gateway sets itself and values too long to forward.
+* @param w http.ResponseWriter, header http.Header
+**/
+func setHeader(w http.ResponseWriter, header http.Header) {
+	for key, values := range header {
+		joinedValues := ""
+		for _, value := range values {
+			if commonHeader[key] {
+				continue
+			} else if len(value) > 255 {
+				continue
+			}
+			if len(joinedValues) > 0 {
+				joinedValues += ", "
+			}
+			joinedValues += value
+		}
+		if joinedValues != "" {
+			w.Header().Set(key, joinedValues)
+		}
+	}
+}
+
+/**
+* setCookie
+* @param w http.ResponseWriter, cookies []*http.Cookie
+**/
+func setCookie(w http.ResponseWriter, cookies []*http.Cookie) {
+	for _, cookie := range cookies {
+		w.Header().Add("Set-Cookie", cookie.String())
+	}
+}
+
 /**
 * applyMiddlewares
 * @params handler http.Handler, middlewares []func(http.Handler) http.Handler
@@ -62,6 +104,30 @@ func (s *Server) applyMiddlewares(handler http.Handler, middlewares []func(http.
 	return handler
 }
 
+/**
+* rateLimit: Wraps the route handler with the Solver rate limit, if any.
+* It runs inside the route middlewares so user keys see the authenticated context.
+* @param resolver *Resolver, h http.HandlerFunc
+* @return http.Handler
+**/
+func (s *Server) rateLimit(resolver *Resolver, h http.HandlerFunc) http.Handler {
+	if resolver.solver == nil || resolver.solver.RateLimit == nil {
+		return h
+	}
+
+	config := resolver.solver.RateLimit
+	scope := resolver.solver.ID
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !config.Allow(w, r, scope) {
+			metric := middleware.GetMetrics(r)
+			s.HTTPError(resolver, metric, w, r, http.StatusTooManyRequests, msg.MSG_RATE_LIMIT_EXCEEDED)
+			return
+		}
+
+		h(w, r)
+	})
+}
+
 /**
 * handler
 * @param w http.ResponseWriter
@@ -70,7 +136,7 @@ func (s *Server) applyMiddlewares(handler http.Handler, middlewares []func(http.
 func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
 	/* Begin telemetry */
 	metric := middleware.GetMetrics(r)
-	ctx := context.WithValue(r.Context(), middleware.MetricKey, metric)
+	ctx := metric.WithContext(r.Context())
 	r = r.WithContext(ctx)
 
 	/* Check if over limit */
@@ -92,6 +158,9 @@ func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
 
 	/* Call search time since begin */
 	w.Header().Set("ServiceId", resolver.ID)
+	if resolver.solver.Split != nil {
+		w.Header().Set(VersionHeader, strconv.Itoa(resolver.Version))
+	}
 	metric.CallSearchTime()
 	metric.SetPath(resolver.Path)
 
@@ -103,18 +172,151 @@ func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		handler := s.applyMiddlewares(http.HandlerFunc(h), resolver.middlewares)
+		handler := s.applyMiddlewares(s.rateLimit(resolver, s.consume(resolver, h)), resolver.middlewares)
 		handler.ServeHTTP(w, r)
 		return
 	}
 
 	/* If API REST is handler */
 	h := s.handlerApi
+	switch resolver.Kind {
+	case TpComposite:
+		h = s.handlerComposite
+	case TpRpc:
+		h = s.handlerRpc
+	}
 	ctx = context.WithValue(ctx, ResoluteKey, resolver)
-	handler := s.applyMiddlewares(http.HandlerFunc(h), resolver.middlewares)
+	handler := s.applyMiddlewares(s.rateLimit(resolver, s.consume(resolver, h)), resolver.middlewares)
 	handler.ServeHTTP(w, r.WithContext(ctx))
 }
 
+/**
+* send: Makes one attempt against the upstream of the route, choosing the target of
+* the pool and honoring its circuit. release must be called once the response is read.
+* @param resolver *Resolver, r *http.Request, body []byte, replay bool
+* @return *http.Response, func(), int, error
+**/
+func (s *Server) send(resolver *Resolver, r *http.Request, body []byte, replay bool) (*http.Response, func(), int, error) {
+	solver := resolver.solver
+	address := resolver.URL
+	upstreams := solver.Upstreams
+	var target *Target
+	/* The pool serves the stable version, a variant of the split goes to its own address */
+	if upstreams != nil && resolver.Version == solver.Version {
+		var err error
+		target, err = upstreams.Next(r)
+		if err != nil {
+			return nil, nil, http.StatusServiceUnavailable, err
+		}
+		address = upstreams.URL(target, address)
+	}
+
+	done := func(err error, status int) {
+		if target != nil {
+			upstreams.Done(target, err, status)
+		}
+	}
+
+	upstream := upstreamOf(address)
+	breaker := solver.breaker(upstream)
+	if !breaker.Allow() {
+		done(nil, 0)
+		return nil, nil, http.StatusServiceUnavailable, fmt.Errorf(MSG_CIRCUIT_OPEN, upstream)
+	}
+
+	ctx := r.Context()
+	cancel := func() {}
+	if solver.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(solver.Timeout))
+	}
+
+	var reader io.Reader = r.Body
+	if replay {
+		reader = bytes.NewReader(body)
+	}
+
+	proxyReq, err := http.NewRequestWithContext(ctx, resolver.Method, address, reader)
+	if err != nil {
+		cancel()
+		done(nil, 0)
+		return nil, nil, http.StatusInternalServerError, err
+	}
+
+	proxyReq.Header = trace.Outbound(r.Context(), resolver.Header)
+	client := s.client
+	if solver.Stream || acceptsStream(r) {
+		client = s.streamer
+	}
+
+	res, err := client.Do(proxyReq)
+	if err != nil {
+		cancel()
+		if r.Context().Err() != nil {
+			breaker.release()
+			done(nil, 0)
+			return nil, nil, http.StatusBadGateway, err
+		}
+
+		breaker.Report(true)
+		done(err, 0)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, nil, http.StatusGatewayTimeout, err
+		}
+		return nil, nil, http.StatusBadGateway, err
+	}
+
+	breaker.Report(res.StatusCode >= http.StatusInternalServerError)
+	release := func() {
+		cancel()
+		done(nil, res.StatusCode)
+	}
+
+	return res, release, res.StatusCode, nil
+}
+
+/**
+* forward: Sends the request to the upstream, retrying idempotent methods as the
+* route policy says. The body is buffered only when it may be sent again.
+* @param resolver *Resolver, r *http.Request
+* @return *http.Response, func(), int, error
+**/
+func (s *Server) forward(resolver *Resolver, r *http.Request) (*http.Response, func(), int, error) {
+	retry := resolver.solver.Retry
+	attempts := retry.attempts(resolver.Method)
+	replay := attempts > 1
+	var body []byte
+	if replay && r.Body != nil {
+		bt, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, nil, http.StatusBadRequest, err
+		}
+		body = bt
+	}
+
+	for attempt := 1; ; attempt++ {
+		res, release, status, err := s.send(resolver, r, body, replay)
+		if attempt >= attempts || (err == nil && !retry.retryStatus(status)) {
+			if err == nil {
+				if err := resolver.solver.Transform.response(resolver, res); err != nil {
+					release()
+					return nil, nil, http.StatusBadGateway, err
+				}
+			}
+			return res, release, status, err
+		}
+
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+			release()
+		}
+
+		if !retry.wait(r.Context(), attempt) {
+			return nil, nil, http.StatusBadGateway, r.Context().Err()
+		}
+	}
+}
+
 /**
 * handlerApi
 * @params w http.ResponseWriter, r *http.Request
@@ -140,51 +342,34 @@ func (s *Server) handlerApi(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	proxyReq, err := http.NewRequestWithContext(r.Context(), resolver.Method, resolver.URL, r.Body)
+	status, err := resolver.solver.Transform.request(resolver, r)
 	if err != nil {
-		s.HTTPError(resolver, metric, rw, r, http.StatusInternalServerError, err.Error())
+		s.HTTPError(resolver, metric, rw, r, status, err.Error())
 		return
 	}
 
-	proxyReq.Header = resolver.Header
-	res, err := s.client.Do(proxyReq)
-	if err != nil {
-		s.HTTPError(resolver, metric, rw, r, http.StatusBadGateway, err.Error())
+	if isUpgrade(r) {
+		s.handlerUpgrade(resolver, metric, rw, r)
 		return
 	}
-	defer res.Body.Close()
 
-	setHeader := func(header http.Header) {
-		for key, values := range header {
-			joinedValues := ""
-			for _, value := range values {
-				if commonHeader[key] {
-					continue
-				} else if len(value) > 255 {
-					continue
-				}
-				if len(joinedValues) > 0 {
-					joinedValues += ", "
-				}
-				joinedValues += value
-			}
-			if joinedValues != "" {
-				rw.Header().Set(key, joinedValues)
-			}
-		}
+	if s.handlerCached(resolver, metric, rw, r) {
+		return
 	}
 
-	setCookie := func(cookies []*http.Cookie) {
-		for _, cookie := range cookies {
-			rw.Header().Add("Set-Cookie", cookie.String())
-		}
+	res, release, status, err := s.forward(resolver, r)
+	if err != nil {
+		s.HTTPError(resolver, metric, rw, r, status, err.Error())
+		return
 	}
+	defer release()
+	defer res.Body.Close()
 
-	setHeader(res.Header)
-	setCookie(res.Cookies())
+	setHeader(rw, res.Header)
+	setCookie(rw, res.Cookies())
 	rw.WriteHeader(res.StatusCode)
 
-	_, err = io.Copy(rw, res.Body)
+	err = copyBody(rw, res.Body, resolver.solver.streams(res))
 	if err != nil {
 		s.HTTPError(resolver, metric, rw, r, http.StatusInternalServerError, err.Error())
 	}
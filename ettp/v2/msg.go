@@ -1,8 +1,37 @@
 package ettp
 
 const (
-	MSG_ROUTE_NOT_FOUND = "Route not found"
-	MSG_ROUTE_DELETE    = "Route deleted"
-	MSG_RESET_ROUTES    = "Reset server routes"
-	MSG_PACKAGE_DELETE  = "Package deleted"
+	MSG_ROUTE_NOT_FOUND           = "Route not found"
+	MSG_ROUTE_DELETE              = "Route deleted"
+	MSG_RESET_ROUTES              = "Reset server routes"
+	MSG_PACKAGE_DELETE            = "Package deleted"
+	MSG_UPSTREAM_NOT_AVAILABLE    = "No upstream available for %s"
+	MSG_CIRCUIT_OPEN              = "Circuit open for %s"
+	MSG_PATTERN_INVALID           = "Invalid route pattern %s"
+	MSG_CACHE_PURGED              = "Cached responses purged"
+	MSG_UPGRADE_NOT_SUPPORTED     = "Upstream connection does not support upgrades"
+	MSG_COMPOSITE_REQUIRED        = "Composite route requires calls"
+	MSG_CALL_NAME_INVALID         = "Invalid call name %s"
+	MSG_CALL_URL_REQUIRED         = "Call %s requires url"
+	MSG_CALL_DEPENDENCY           = "Unknown dependency %s of call %s"
+	MSG_CALL_CYCLE                = "Calls form a cycle at %s"
+	MSG_CALL_FAILED               = "Call %s failed with status %d"
+	MSG_CALL_SKIPPED              = "Call %s skipped, dependency %s failed"
+	MSG_OPENAPI_INVALID           = "OpenAPI document without paths"
+	MSG_OPENAPI_UPSTREAM_REQUIRED = "Upstream is required, as argument or as the first server of the document"
+	MSG_SPLIT_WEIGHT              = "Invalid split weight %d"
+	MSG_SPLIT_NOT_FOUND           = "Route has no split"
+	MSG_SPLIT_STABLE_VERSION      = "Variant version %d is the stable version of %s"
+	MSG_VERSION_NOT_FOUND         = "Version %d not found in the split of %s"
+	MSG_API_KEY_INVALID           = "Invalid API key"
+	MSG_CONSUMER_NOT_FOUND        = "Consumer %s not found"
+	MSG_CONSUMER_DELETE           = "Consumer deleted"
+	MSG_RPC_PARAMS_INVALID        = "Params must be an object or an array holding one"
+	MSG_RPC_INVALID_REQUEST       = "Invalid Request"
+	MSG_RPC_PARSE_ERROR           = "Parse error"
+	MSG_RPC_METHOD_NOT_FOUND      = "Method not found %s"
+	MSG_RPC_BATCH_TOO_LARGE       = "Batch larger than %d requests"
+	MSG_QUOTA_EXCEEDED            = "Quota exceeded"
+	MSG_BODY_TOO_LARGE            = "Body larger than %d bytes"
+	MSG_BODY_INVALID              = "Invalid JSON body"
 )
@@ -0,0 +1,357 @@
+package ettp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/middleware"
+	"github.com/cgalvisleon/et/response"
+)
+
+const (
+	OpenAPIVersion = "3.1.0"
+	bearerScheme   = "bearerAuth"
+	apiKeyScheme   = "apiKeyAuth"
+)
+
+var (
+	operationRegex = regexp.MustCompile(`[^A-Za-z0-9]+`)
+	anyMethods     = []string{GET, POST, PUT, PATCH, DELETE}
+)
+
+/**
+* openAPIPath: Turns a route path into an OpenAPI path and its params. {name:regex} keeps
+* its expression as the pattern of the param and the catch-all *name becomes {name}.
+* @param path string
+* @return string, []et.Json
+**/
+func openAPIPath(path string) (string, []et.Json) {
+	params := []et.Json{}
+	tags := strings.Split(path, "/")
+	for i, tag := range tags {
+		name := ""
+		schema := et.Json{"type": "string"}
+		switch {
+		case strings.HasPrefix(tag, "*"):
+			name = tag[1:]
+			schema["x-catch-all"] = true
+		case paramRegex.MatchString(tag):
+			var expr string
+			var ok bool
+			name, expr, ok = strings.Cut(strings.Trim(tag, "{}"), ":")
+			if ok {
+				schema["pattern"] = "^(?:" + expr + ")$"
+			}
+		default:
+			continue
+		}
+
+		tags[i] = "{" + name + "}"
+		params = append(params, et.Json{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+
+	return strings.Join(tags, "/"), params
+}
+
+/**
+* operationId: Builds an operation id from the method and path of a route.
+* @param method, path string
+* @return string
+**/
+func operationId(method, path string) string {
+	return strings.ToLower(method) + strings.TrimSuffix(operationRegex.ReplaceAllString(path, "_"), "_")
+}
+
+/**
+* operation: Describes one method of the solver.
+* @param method, path string, params []et.Json
+* @return et.Json
+**/
+func (s *Solver) operation(method, path string, params []et.Json) et.Json {
+	result := et.Json{
+		"operationId": operationId(method, path),
+		"tags":        []string{s.PackageName},
+		"responses": et.Json{
+			"default": et.Json{"description": "Response"},
+		},
+	}
+	if s.Summary != "" {
+		result["summary"] = s.Summary
+	}
+	if s.Description != "" {
+		result["description"] = s.Description
+	}
+	if len(params) > 0 {
+		result["parameters"] = params
+	}
+	security := et.Json{}
+	if s.Private {
+		security[bearerScheme] = []string{}
+	}
+	if s.ApiKey {
+		security[apiKeyScheme] = []string{}
+	}
+	if len(security) > 0 {
+		result["security"] = []et.Json{security}
+	}
+	if s.Host != "" {
+		result["x-host"] = s.Host
+	}
+	if s.Kind == TpComposite {
+		result["x-composite"] = true
+	}
+
+	return result
+}
+
+/**
+* OpenAPI: Describes the registered routes as an OpenAPI document, one tag per package.
+* Upstream addresses stay out of it. When several routes share a method and path, the
+* first by id is described.
+* @param server string
+* @return et.Json
+**/
+func (s *Server) OpenAPI(server string) et.Json {
+	s.muRoutes.RLock()
+	solvers := make([]*Solver, 0, len(s.Solvers))
+	for _, solver := range s.Solvers {
+		solvers = append(solvers, solver)
+	}
+	s.muRoutes.RUnlock()
+	sort.Slice(solvers, func(i, j int) bool { return solvers[i].ID < solvers[j].ID })
+
+	paths := et.Json{}
+	packages := map[string]bool{}
+	for _, solver := range solvers {
+		if solver.Method == RPC {
+			continue
+		}
+
+		methods := []string{solver.Method}
+		if solver.Method == ANY {
+			methods = anyMethods
+			if len(solver.Methods) > 0 {
+				methods = solver.Methods
+			}
+		}
+
+		_, route := splitPattern(solver.Path)
+		path, params := openAPIPath(route)
+		item, ok := paths[path].(et.Json)
+		if !ok {
+			item = et.Json{}
+			paths[path] = item
+		}
+
+		for _, method := range methods {
+			key := strings.ToLower(method)
+			if _, ok := item[key]; ok {
+				continue
+			}
+			item[key] = solver.operation(method, path, params)
+		}
+		packages[solver.PackageName] = true
+	}
+
+	tags := []et.Json{}
+	for name := range packages {
+		tags = append(tags, et.Json{"name": name})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Str("name") < tags[j].Str("name") })
+
+	result := et.Json{
+		"openapi": OpenAPIVersion,
+		"info": et.Json{
+			"title":   s.Name,
+			"version": s.Version,
+		},
+		"tags":  tags,
+		"paths": paths,
+		"components": et.Json{
+			"securitySchemes": et.Json{
+				bearerScheme: et.Json{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+				apiKeyScheme: et.Json{
+					"type": "apiKey",
+					"in":   "header",
+					"name": middleware.ApiKeyHeader,
+				},
+			},
+		},
+	}
+	if server != "" {
+		result["servers"] = []et.Json{{"url": server}}
+	}
+
+	return result
+}
+
+/**
+* ImportOpenAPI: Creates a route for every operation of doc, resolved against upstream.
+* The routes go in the package named as the title of doc and keep the summary and
+* description of each operation.
+* @param doc et.Json, upstream string
+* @return []*Solver, error
+**/
+func (s *Server) ImportOpenAPI(doc et.Json, upstream string) ([]*Solver, error) {
+	paths := doc.Json("paths")
+	if paths.IsEmpty() {
+		return nil, errors.New(MSG_OPENAPI_INVALID)
+	}
+
+	if upstream == "" {
+		servers := doc.ArrayJson("servers")
+		if len(servers) > 0 {
+			upstream = servers[0].Str("url")
+		}
+	}
+	if u, err := url.Parse(upstream); err != nil || u.Host == "" {
+		return nil, errors.New(MSG_OPENAPI_UPSTREAM_REQUIRED)
+	}
+	upstream = strings.TrimSuffix(upstream, "/")
+
+	packageName := doc.Json("info").Str("title")
+	if packageName == "" {
+		packageName = upstream
+	}
+
+	names := make([]string, 0, len(paths))
+	for path := range paths {
+		names = append(names, path)
+	}
+	sort.Strings(names)
+
+	/* Routes created before a failure are kept and saved */
+	result := []*Solver{}
+	var err error
+	for _, path := range names {
+		item := paths.Json(path)
+		for _, method := range []string{GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS} {
+			key := strings.ToLower(method)
+			if _, ok := item[key]; !ok {
+				continue
+			}
+			operation := item.Json(key)
+
+			var solver *Solver
+			solver, err = s.SetRouter(method, path, upstream+path, int(TpKeepHeader), et.Json{}, []string{}, 0, packageName, false)
+			if err != nil {
+				break
+			}
+			solver.Summary = operation.Str("summary")
+			solver.Description = operation.Str("description")
+			result = append(result, solver)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if len(result) > 0 {
+		s.Save()
+	}
+
+	return result, err
+}
+
+/**
+* getOpenAPI: Serves the OpenAPI document of the routes
+* @params w http.ResponseWriter
+* @params r *http.Request
+**/
+func (s *Server) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	metric := middleware.GetMetrics(r)
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	bt, err := json.Marshal(s.OpenAPI(fmt.Sprintf("%s://%s", scheme, r.Host)))
+	if err != nil {
+		metric.HTTPError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	metric.WriteResponse(w, r, http.StatusOK, bt)
+}
+
+/**
+* importOpenAPI: Creates the routes of the spec in the body, {"upstream": "...", "spec": {...}}
+* @params w http.ResponseWriter
+* @params r *http.Request
+**/
+func (s *Server) importOpenAPI(w http.ResponseWriter, r *http.Request) {
+	metric := middleware.GetMetrics(r)
+
+	body, err := response.ScanBody(r.Body)
+	if err != nil {
+		metric.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	solvers, err := s.ImportOpenAPI(body.Json("spec"), body.Str("upstream"))
+	if err != nil {
+		metric.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result := et.Items{Result: []et.Json{}}
+	for _, solver := range solvers {
+		result.Add(solver.ToJson())
+	}
+
+	metric.ITEMS(w, r, http.StatusOK, result)
+}
+
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8" />
+  <title>%s</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css" />
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>`
+
+/**
+* getDocs: Serves a Swagger UI page over the OpenAPI document
+* @params w http.ResponseWriter
+* @params r *http.Request
+**/
+func (s *Server) getDocs(w http.ResponseWriter, r *http.Request) {
+	metric := middleware.GetMetrics(r)
+
+	rw := &middleware.ResponseWriterWrapper{ResponseWriter: w, StatusCode: http.StatusOK}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprintf(rw, swaggerUI, html.EscapeString(s.Name))
+	metric.DoneHTTP(rw)
+}
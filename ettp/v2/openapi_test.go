@@ -0,0 +1,90 @@
+package ettp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cgalvisleon/et/et"
+)
+
+/**
+* newTestServer: Server holding only the routes, with an authenticator letting everything
+* through. It saves to the cache, which without connection keeps nothing instead of writing
+* apigateway.json.
+* @param name string
+* @return *Server
+**/
+func newTestServer(name string) *Server {
+	return &Server{
+		Name:          name,
+		Solvers:       map[string]*Solver{},
+		Packages:      map[string]*Package{},
+		Requests:      map[string]*Resolver{},
+		router:        map[string]*Router{},
+		client:        &http.Client{},
+		responses:     newResponseCache(),
+		consumers:     newConsumers(),
+		authenticator: func(next http.Handler) http.Handler { return next },
+		useCache:      true,
+	}
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	s := newTestServer("gateway")
+	if err := s.basicRoutes(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"GET:/openapi.json", "GET:/docs"} {
+		solver, ok := s.Solvers[key]
+		if !ok {
+			t.Fatalf("%s not registered", key)
+		}
+		if !solver.Private {
+			t.Errorf("%s is public", key)
+		}
+	}
+}
+
+func TestOpenAPISecurity(t *testing.T) {
+	s := newTestServer("gateway")
+	if _, err := s.Public(GET, "/status", nil, "public"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Private(GET, "/users/{id}", nil, "users"); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := s.OpenAPI("").Json("paths")
+	tests := []struct {
+		path     string
+		security bool
+	}{
+		{"/status", false},
+		{"/users/{id}", true},
+	}
+	for _, tt := range tests {
+		operation := paths.Json(tt.path).Json("get")
+		if operation.IsEmpty() {
+			t.Fatalf("%s not described", tt.path)
+		}
+		if _, ok := operation["security"].([]et.Json); ok != tt.security {
+			t.Errorf("%s security = %v, want %v", tt.path, ok, tt.security)
+		}
+	}
+}
+
+func TestDocsEscapesName(t *testing.T) {
+	s := newTestServer(`</title><script>alert(1)</script>`)
+	w := httptest.NewRecorder()
+	s.getDocs(w, httptest.NewRequest(GET, "/docs", nil))
+
+	if strings.Contains(w.Body.String(), "<script>alert") {
+		t.Fatal("server name written into the page without escaping")
+	}
+	if !strings.Contains(w.Body.String(), "&lt;script&gt;") {
+		t.Error("escaped server name missing from the page")
+	}
+}
@@ -48,8 +48,10 @@ type Resolver struct {
 	URL         string                            `json:"url"`
 	Path        string                            `json:"path"`
 	Kind        TypeRouter                        `json:"kind"`
+	Version     int                               `json:"version"`
 	middlewares []func(http.Handler) http.Handler `json:"-"`
 	handlerFn   http.HandlerFunc                  `json:"-"`
+	solver      *Solver                           `json:"-"`
 	timer       *time.Timer                       `json:"-"`
 }
 
@@ -70,7 +72,7 @@ func newResolver(r *http.Request, solver *Solver, params map[string]string) (*Re
 	}
 
 	now := utility.Now()
-	url := solver.Solver
+	url, version := solver.Split.variant(solver, r)
 	for k, v := range params {
 		name := strings.Trim(k, "{}")
 		r.SetPathValue(name, v)
@@ -117,8 +119,10 @@ func newResolver(r *http.Request, solver *Solver, params map[string]string) (*Re
 		URL:         url,
 		Path:        solver.Path,
 		Kind:        solver.Kind,
+		Version:     version,
 		middlewares: solver.middlewares,
 		handlerFn:   solver.handlerFn,
+		solver:      solver,
 	}
 	result.setStatus(TpStatusPending)
 
@@ -137,6 +141,7 @@ func (r *Resolver) ToJson() et.Json {
 		"id":         r.ID,
 		"url":        r.URL,
 		"kind":       r.Kind.String(),
+		"version":    r.Version,
 	}
 }
 
@@ -0,0 +1,594 @@
+package ettp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cgalvisleon/et/cache"
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/middleware"
+)
+
+const (
+	CacheHeader  = "X-Cache"
+	responsesKey = "apigateway:response:"
+	cacheMaxSize = 1 << 20
+	cacheHit     = "HIT"
+	cacheMiss    = "MISS"
+	cacheStale   = "STALE"
+	cacheRefresh = "REVALIDATED"
+)
+
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+/**
+* CacheConfig: Response cache of a route. TTL is the default freshness, overridden by
+* max-age or s-maxage of the response, and Stale how long an expired response is still
+* served while it is revalidated in background. Headers and Query select what goes in
+* the key besides method and path; without Query the whole query string does.
+**/
+type CacheConfig struct {
+	TTL     Duration `json:"ttl"`
+	Stale   Duration `json:"stale"`
+	Headers []string `json:"headers"`
+	Query   []string `json:"query"`
+	MaxSize int      `json:"max_size"`
+}
+
+/**
+* NewCacheConfig: Builds a CacheConfig from its JSON definition.
+* ttl and stale accept a duration string or a number of seconds.
+* @param params et.Json
+* @return *CacheConfig
+**/
+func NewCacheConfig(params et.Json) *CacheConfig {
+	if params.IsEmpty() {
+		return nil
+	}
+
+	ttl := parseDuration(params, "ttl")
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	headers := []string{}
+	for _, name := range params.ArrayStr("headers") {
+		headers = append(headers, http.CanonicalHeaderKey(name))
+	}
+	sort.Strings(headers)
+
+	query := params.ArrayStr("query")
+	sort.Strings(query)
+
+	maxSize := params.Int("max_size")
+	if maxSize <= 0 {
+		maxSize = cacheMaxSize
+	}
+
+	return &CacheConfig{
+		TTL:     Duration(ttl),
+		Stale:   Duration(max(parseDuration(params, "stale"), 0)),
+		Headers: headers,
+		Query:   query,
+		MaxSize: maxSize,
+	}
+}
+
+/**
+* cachedResponse: Stored response with the request header values its Vary depends on.
+**/
+type cachedResponse struct {
+	Status     int               `json:"status"`
+	Header     http.Header       `json:"header"`
+	Body       []byte            `json:"body"`
+	ETag       string            `json:"etag"`
+	Vary       map[string]string `json:"vary"`
+	StoredAt   time.Time         `json:"stored_at"`
+	FreshUntil time.Time         `json:"fresh_until"`
+	StaleUntil time.Time         `json:"stale_until"`
+}
+
+/**
+* cacheControl: Parses a Cache-Control header into its directives.
+* @param header http.Header
+* @return map[string]string
+**/
+func cacheControl(header http.Header) map[string]string {
+	result := map[string]string{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if k != "" {
+				result[strings.ToLower(k)] = strings.Trim(v, `"`)
+			}
+		}
+	}
+
+	return result
+}
+
+/**
+* seconds: Reads a directive holding seconds.
+* @param directives map[string]string, name string
+* @return time.Duration, bool
+**/
+func seconds(directives map[string]string, name string) (time.Duration, bool) {
+	val, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	return time.Duration(n) * time.Second, true
+}
+
+/**
+* hashOf
+* @param val string
+* @return string
+**/
+func hashOf(val string) string {
+	sum := sha1.Sum([]byte(val))
+	return hex.EncodeToString(sum[:])
+}
+
+/**
+* routePrefix: Key prefix of every response cached for the route id.
+* @param id string
+* @return string
+**/
+func routePrefix(id string) string {
+	return responsesKey + hashOf(id)[:16] + ":"
+}
+
+/**
+* key: Builds the cache key of r from method, path, the version the split chose and
+* the selected query and headers. Routes behind an API key keep the responses of each
+* consumer apart.
+* @param resolver *Resolver, r *http.Request
+* @return string
+**/
+func (s *CacheConfig) key(resolver *Resolver, r *http.Request) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "v%d ", resolver.Version)
+	b.WriteString(r.Method)
+	b.WriteString(" ")
+	b.WriteString(r.Host)
+	b.WriteString(r.URL.Path)
+
+	values := r.URL.Query()
+	if len(s.Query) == 0 {
+		b.WriteString("?")
+		b.WriteString(values.Encode())
+	} else {
+		for _, name := range s.Query {
+			fmt.Fprintf(&b, "&%s=%s", name, strings.Join(values[name], ","))
+		}
+	}
+
+	for _, name := range s.Headers {
+		fmt.Fprintf(&b, "\n%s:%s", name, strings.Join(r.Header.Values(name), ","))
+	}
+
+	if resolver.solver.ApiKey {
+		fmt.Fprintf(&b, "\n%s:%s", ConsumerHeader, r.Header.Get(ConsumerHeader))
+	}
+
+	return routePrefix(resolver.solver.ID) + hashOf(b.String())
+}
+
+/**
+* responseCache: Entry point of the response cache of the gateway. It stores in the
+* cache package, which keeps a local mem tier and falls back to it without Redis.
+**/
+type responseCache struct {
+	store      *cache.Tiered
+	refreshing sync.Map
+}
+
+/**
+* newResponseCache
+* @return *responseCache
+**/
+func newResponseCache() *responseCache {
+	return &responseCache{
+		store: cache.NewTiered("apigateway:response", 0),
+	}
+}
+
+/**
+* get: Returns the entry of key if the Vary headers of r match the stored ones.
+* @param key string, r *http.Request
+* @return *cachedResponse, bool
+**/
+func (s *responseCache) get(key string, r *http.Request) (*cachedResponse, bool) {
+	val, exists, err := s.store.Get(key)
+	if err != nil || !exists {
+		return nil, false
+	}
+
+	var result *cachedResponse
+	if err := json.Unmarshal([]byte(val), &result); err != nil || result == nil {
+		return nil, false
+	}
+
+	for name, value := range result.Vary {
+		if strings.Join(r.Header.Values(name), ",") != value {
+			return nil, false
+		}
+	}
+
+	return result, true
+}
+
+/**
+* set: Stores entry, keeping it past its stale window when it can be revalidated by ETag.
+* @param key string, entry *cachedResponse
+**/
+func (s *responseCache) set(key string, entry *cachedResponse) {
+	ttl := time.Until(entry.StaleUntil)
+	if entry.ETag != "" {
+		ttl += entry.FreshUntil.Sub(entry.StoredAt)
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	if err := s.store.Set(key, entry, ttl); err != nil {
+		logs.Alertf("response cache set key:%s error:%s", key, err.Error())
+	}
+}
+
+/**
+* purge: Removes the responses of the route id, all of them when id is empty.
+* @param id string
+* @return error
+**/
+func (s *responseCache) purge(id string) error {
+	prefix := responsesKey
+	if id != "" {
+		prefix = routePrefix(id)
+	}
+
+	return s.store.Purge(prefix)
+}
+
+/**
+* newEntry: Turns an upstream response into a cache entry, nil when it may not be stored.
+* @param config *CacheConfig, r *http.Request, res *http.Response, body []byte
+* @return *cachedResponse
+**/
+func newEntry(config *CacheConfig, r *http.Request, res *http.Response, body []byte) *cachedResponse {
+	if !cacheableStatus[res.StatusCode] || len(res.Header.Values("Set-Cookie")) > 0 || isStreaming(res) {
+		return nil
+	}
+
+	directives := cacheControl(res.Header)
+	for _, name := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[name]; ok {
+			return nil
+		}
+	}
+
+	_, public := directives["public"]
+	_, shared := directives["s-maxage"]
+	if r.Header.Get("Authorization") != "" && !public && !shared {
+		return nil
+	}
+
+	ttl := time.Duration(config.TTL)
+	if val, ok := seconds(directives, "max-age"); ok {
+		ttl = val
+	}
+	if val, ok := seconds(directives, "s-maxage"); ok {
+		ttl = val
+	}
+
+	stale := time.Duration(config.Stale)
+	if val, ok := seconds(directives, "stale-while-revalidate"); ok {
+		stale = val
+	}
+
+	vary := map[string]string{}
+	for _, value := range res.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return nil
+			}
+			if name != "" {
+				vary[name] = strings.Join(r.Header.Values(name), ",")
+			}
+		}
+	}
+
+	header := res.Header.Clone()
+	header.Del("Set-Cookie")
+	now := time.Now()
+	return &cachedResponse{
+		Status:     res.StatusCode,
+		Header:     header,
+		Body:       body,
+		ETag:       res.Header.Get("ETag"),
+		Vary:       vary,
+		StoredAt:   now,
+		FreshUntil: now.Add(ttl),
+		StaleUntil: now.Add(ttl + stale),
+	}
+}
+
+/**
+* refresh: Extends a stored entry after the upstream answered 304 to its revalidation.
+* @param config *CacheConfig, res *http.Response
+**/
+func (s *cachedResponse) refresh(config *CacheConfig, res *http.Response) {
+	ttl := s.FreshUntil.Sub(s.StoredAt)
+	stale := s.StaleUntil.Sub(s.FreshUntil)
+	directives := cacheControl(res.Header)
+	if val, ok := seconds(directives, "max-age"); ok {
+		ttl = val
+	}
+	if val, ok := seconds(directives, "s-maxage"); ok {
+		ttl = val
+	}
+
+	now := time.Now()
+	s.StoredAt = now
+	s.FreshUntil = now.Add(ttl)
+	s.StaleUntil = now.Add(ttl + stale)
+}
+
+/**
+* notModified: Reports whether the If-None-Match of r matches etag.
+* @param r *http.Request, etag string
+* @return bool
+**/
+func notModified(r *http.Request, etag string) bool {
+	match := r.Header.Get("If-None-Match")
+	if match == "" || etag == "" {
+		return false
+	}
+
+	if strings.TrimSpace(match) == "*" {
+		return true
+	}
+
+	weak := func(val string) string {
+		return strings.TrimPrefix(strings.TrimSpace(val), "W/")
+	}
+
+	return slices.ContainsFunc(strings.Split(match, ","), func(val string) bool {
+		return weak(val) == weak(etag)
+	})
+}
+
+/**
+* cacheable: Reports whether r may be answered from the cache of the route.
+* @param resolver *Resolver, r *http.Request
+* @return *CacheConfig, bool
+**/
+func (s *Server) cacheable(resolver *Resolver, r *http.Request) (*CacheConfig, bool) {
+	config := resolver.solver.Cache
+	if config == nil || s.responses == nil {
+		return nil, false
+	}
+
+	if r.Method != GET && r.Method != HEAD {
+		return nil, false
+	}
+
+	if _, ok := cacheControl(r.Header)["no-store"]; ok {
+		return nil, false
+	}
+
+	return config, true
+}
+
+/**
+* serveCached: Writes entry to the client, answering 304 when its ETag is already known.
+* @param resolver *Resolver, metric *middleware.Metrics, rw *middleware.ResponseWriterWrapper, r *http.Request, entry *cachedResponse, status string
+**/
+func (s *Server) serveCached(resolver *Resolver, metric *middleware.Metrics, rw *middleware.ResponseWriterWrapper, r *http.Request, entry *cachedResponse, status string) {
+	setHeader(rw, entry.Header)
+	rw.Header().Set(CacheHeader, status)
+	rw.Header().Set("Age", strconv.Itoa(int(time.Since(entry.StoredAt).Seconds())))
+
+	if notModified(r, entry.ETag) {
+		rw.WriteHeader(http.StatusNotModified)
+		s.HTTPSuccess(resolver, metric, rw)
+		return
+	}
+
+	rw.Header().Set("Content-Length", strconv.Itoa(len(entry.Body)))
+	rw.WriteHeader(entry.Status)
+	if r.Method != HEAD {
+		rw.Write(entry.Body)
+	}
+
+	s.HTTPSuccess(resolver, metric, rw)
+}
+
+/**
+* revalidate: Asks the upstream for key again, conditionally when entry has an ETag,
+* and stores the result. Returns the entry to serve and the response when the upstream
+* sent a new one, which the caller must release.
+* @param resolver *Resolver, r *http.Request, config *CacheConfig, key string, entry *cachedResponse
+* @return *cachedResponse, *http.Response, func(), int, error
+**/
+func (s *Server) revalidate(resolver *Resolver, r *http.Request, config *CacheConfig, key string, entry *cachedResponse) (*cachedResponse, *http.Response, func(), int, error) {
+	req := r
+	if entry != nil && entry.ETag != "" {
+		req = r.Clone(r.Context())
+		req.Header.Set("If-None-Match", entry.ETag)
+		rv := *resolver
+		rv.Request = req
+		resolver = &rv
+	}
+
+	res, release, status, err := s.forward(resolver, req)
+	if err != nil {
+		return nil, nil, nil, status, err
+	}
+
+	if entry != nil && res.StatusCode == http.StatusNotModified && req != r {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		release()
+		entry.refresh(config, res)
+		s.responses.set(key, entry)
+		return entry, nil, nil, http.StatusOK, nil
+	}
+
+	return nil, res, release, status, nil
+}
+
+/**
+* refreshInBackground: Revalidates key once at a time while a stale entry is being served.
+* @param resolver *Resolver, r *http.Request, config *CacheConfig, key string, entry *cachedResponse
+**/
+func (s *Server) refreshInBackground(resolver *Resolver, r *http.Request, config *CacheConfig, key string, entry *cachedResponse) {
+	if _, loaded := s.responses.refreshing.LoadOrStore(key, true); loaded {
+		return
+	}
+
+	req := r.Clone(context.WithoutCancel(r.Context()))
+	req.Body = http.NoBody
+	rv := *resolver
+	rv.Request = req
+
+	go func() {
+		defer s.responses.refreshing.Delete(key)
+
+		_, res, release, _, err := s.revalidate(&rv, req, config, key, entry)
+		if err != nil || res == nil {
+			return
+		}
+		defer release()
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(io.LimitReader(res.Body, int64(config.MaxSize)+1))
+		if err != nil || len(body) > config.MaxSize {
+			return
+		}
+
+		if fresh := newEntry(config, req, res, body); fresh != nil {
+			s.responses.set(key, fresh)
+		}
+	}()
+}
+
+/**
+* handlerCached: Answers r through the response cache of the route: fresh entries are
+* served as they are, stale ones inside their window are served while revalidated in
+* background and the rest go to the upstream, conditionally when they carry an ETag.
+* Returns false when the route does not cache r, so the caller proxies it as usual.
+* @param resolver *Resolver, metric *middleware.Metrics, rw *middleware.ResponseWriterWrapper, r *http.Request
+* @return bool
+**/
+func (s *Server) handlerCached(resolver *Resolver, metric *middleware.Metrics, rw *middleware.ResponseWriterWrapper, r *http.Request) bool {
+	config, ok := s.cacheable(resolver, r)
+	if !ok {
+		return false
+	}
+
+	key := config.key(resolver, r)
+	_, noCache := cacheControl(r.Header)["no-cache"]
+	var entry *cachedResponse
+	if !noCache {
+		entry, _ = s.responses.get(key, r)
+	}
+
+	now := time.Now()
+	if entry != nil && now.Before(entry.FreshUntil) {
+		s.serveCached(resolver, metric, rw, r, entry, cacheHit)
+		return true
+	}
+
+	if entry != nil && now.Before(entry.StaleUntil) {
+		s.refreshInBackground(resolver, r, config, key, entry)
+		s.serveCached(resolver, metric, rw, r, entry, cacheStale)
+		return true
+	}
+
+	refreshed, res, release, status, err := s.revalidate(resolver, r, config, key, entry)
+	if err != nil {
+		s.HTTPError(resolver, metric, rw, r, status, err.Error())
+		return true
+	}
+
+	if refreshed != nil {
+		s.serveCached(resolver, metric, rw, r, refreshed, cacheRefresh)
+		return true
+	}
+	defer release()
+	defer res.Body.Close()
+
+	/* The body is kept while it fits in MaxSize, past it the response is only streamed */
+	var buf bytes.Buffer
+	body := io.TeeReader(res.Body, &limitedBuffer{buf: &buf, max: config.MaxSize})
+	setHeader(rw, res.Header)
+	setCookie(rw, res.Cookies())
+	rw.Header().Set(CacheHeader, cacheMiss)
+	rw.WriteHeader(res.StatusCode)
+
+	err = copyBody(rw, body, resolver.solver.streams(res))
+	if err != nil {
+		s.HTTPError(resolver, metric, rw, r, http.StatusInternalServerError, err.Error())
+		return true
+	}
+
+	if buf.Len() <= config.MaxSize {
+		if fresh := newEntry(config, r, res, buf.Bytes()); fresh != nil {
+			s.responses.set(key, fresh)
+		}
+	}
+
+	s.HTTPSuccess(resolver, metric, rw)
+	return true
+}
+
+/**
+* limitedBuffer: Writer that stops keeping bytes once past max, leaving the buffer one
+* byte over so the caller knows it was cut.
+**/
+type limitedBuffer struct {
+	buf *bytes.Buffer
+	max int
+}
+
+/**
+* Write
+* @param p []byte
+* @return int, error
+**/
+func (s *limitedBuffer) Write(p []byte) (int, error) {
+	if room := s.max + 1 - s.buf.Len(); room > 0 {
+		s.buf.Write(p[:min(room, len(p))])
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,153 @@
+package ettp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheConfigKey(t *testing.T) {
+	solver := &Solver{ID: "GET:/items"}
+	private := &Solver{ID: "GET:/items", ApiKey: true}
+	request := func(target string, header map[string]string) *http.Request {
+		r := httptest.NewRequest(GET, target, nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		config CacheConfig
+		solver *Solver
+		a, b   *http.Request
+		va, vb int
+		same   bool
+	}{
+		{
+			name:   "same request",
+			solver: solver,
+			a:      request("/items?page=1", nil),
+			b:      request("/items?page=1", nil),
+			same:   true,
+		},
+		{
+			name:   "whole query by default",
+			solver: solver,
+			a:      request("/items?page=1", nil),
+			b:      request("/items?page=2", nil),
+		},
+		{
+			name:   "only the selected query",
+			config: CacheConfig{Query: []string{"page"}},
+			solver: solver,
+			a:      request("/items?page=1&utm=a", nil),
+			b:      request("/items?page=1&utm=b", nil),
+			same:   true,
+		},
+		{
+			name:   "selected headers",
+			config: CacheConfig{Headers: []string{"Accept-Language"}},
+			solver: solver,
+			a:      request("/items", map[string]string{"Accept-Language": "es"}),
+			b:      request("/items", map[string]string{"Accept-Language": "en"}),
+		},
+		{
+			name:   "other headers are ignored",
+			solver: solver,
+			a:      request("/items", map[string]string{"Accept-Language": "es"}),
+			b:      request("/items", map[string]string{"Accept-Language": "en"}),
+			same:   true,
+		},
+		{
+			name:   "versions of a split",
+			solver: solver,
+			a:      request("/items", nil),
+			b:      request("/items", nil),
+			va:     1,
+			vb:     2,
+		},
+		{
+			name:   "consumers of an API key route",
+			solver: private,
+			a:      request("/items", map[string]string{ConsumerHeader: "a"}),
+			b:      request("/items", map[string]string{ConsumerHeader: "b"}),
+		},
+		{
+			name:   "consumers of a public route",
+			solver: solver,
+			a:      request("/items", map[string]string{ConsumerHeader: "a"}),
+			b:      request("/items", map[string]string{ConsumerHeader: "b"}),
+			same:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.config.key(&Resolver{solver: tt.solver, Version: tt.va}, tt.a)
+			b := tt.config.key(&Resolver{solver: tt.solver, Version: tt.vb}, tt.b)
+			if (a == b) != tt.same {
+				t.Fatalf("same key = %v, want %v", a == b, tt.same)
+			}
+		})
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+	config := &CacheConfig{TTL: Duration(time.Minute), Stale: Duration(time.Second)}
+	tests := []struct {
+		name    string
+		status  int
+		header  map[string]string
+		request map[string]string
+		length  int64
+		stored  bool
+		ttl     time.Duration
+	}{
+		{name: "ok response", status: http.StatusOK, stored: true, ttl: time.Minute},
+		{name: "chunked body", status: http.StatusOK, length: -1, stored: true, ttl: time.Minute},
+		{name: "max-age overrides the ttl", status: http.StatusOK, header: map[string]string{"Cache-Control": "max-age=10"}, stored: true, ttl: 10 * time.Second},
+		{name: "s-maxage wins", status: http.StatusOK, header: map[string]string{"Cache-Control": "max-age=10, s-maxage=20"}, stored: true, ttl: 20 * time.Second},
+		{name: "server error", status: http.StatusInternalServerError},
+		{name: "cookies", status: http.StatusOK, header: map[string]string{"Set-Cookie": "id=1"}},
+		{name: "no-store", status: http.StatusOK, header: map[string]string{"Cache-Control": "no-store"}},
+		{name: "private", status: http.StatusOK, header: map[string]string{"Cache-Control": "private"}},
+		{name: "authorized request", status: http.StatusOK, request: map[string]string{"Authorization": "Bearer x"}},
+		{name: "authorized public response", status: http.StatusOK, request: map[string]string{"Authorization": "Bearer x"}, header: map[string]string{"Cache-Control": "public"}, stored: true, ttl: time.Minute},
+		{name: "vary on everything", status: http.StatusOK, header: map[string]string{"Vary": "*"}},
+		{name: "event stream", status: http.StatusOK, header: map[string]string{"Content-Type": "text/event-stream"}, length: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(GET, "/items", nil)
+			for k, v := range tt.request {
+				r.Header.Set(k, v)
+			}
+			res := &http.Response{
+				StatusCode:    tt.status,
+				Header:        http.Header{},
+				ContentLength: tt.length,
+				Request:       r,
+			}
+			for k, v := range tt.header {
+				res.Header.Set(k, v)
+			}
+
+			entry := newEntry(config, r, res, []byte(`{}`))
+			if (entry != nil) != tt.stored {
+				t.Fatalf("stored = %v, want %v", entry != nil, tt.stored)
+			}
+			if entry == nil {
+				return
+			}
+
+			if got := entry.FreshUntil.Sub(entry.StoredAt); got != tt.ttl {
+				t.Errorf("ttl = %s, want %s", got, tt.ttl)
+			}
+			if entry.Header.Get("Set-Cookie") != "" {
+				t.Error("entry keeps Set-Cookie")
+			}
+		})
+	}
+}
@@ -3,8 +3,10 @@ package ettp
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/cgalvisleon/et/et"
@@ -20,6 +22,7 @@ const (
 	HEAD    = "HEAD"
 	OPTIONS = "OPTIONS"
 	RPC     = "RPC"
+	ANY     = "ANY"
 )
 
 var paramRegex = regexp.MustCompile(`^\{.*\}$`)
@@ -33,14 +36,26 @@ var methods = map[string]bool{
 	HEAD:    true,
 	OPTIONS: true,
 	RPC:     true,
+	ANY:     true,
 }
 
 type Router struct {
-	Tag    string             `json:"tag"`
-	Param  string             `json:"param"`
-	Solver *Solver            `json:"solver"`
-	Router map[string]*Router `json:"router"`
-	owner  *Router            `json:"-"`
+	Tag      string             `json:"tag"`
+	Param    string             `json:"param"`
+	Solvers  []*Solver          `json:"solvers"`
+	Router   map[string]*Router `json:"router"`
+	pattern  *regexp.Regexp     `json:"-"`
+	params   []*Router          `json:"-"`
+	wildcard *Router            `json:"-"`
+	owner    *Router            `json:"-"`
+}
+
+/**
+* match: Best solver found while walking the routers of a request.
+**/
+type match struct {
+	solver *Solver
+	params map[string]string
 }
 
 /**
@@ -50,8 +65,9 @@ type Router struct {
 **/
 func newRouter(tag string) *Router {
 	return &Router{
-		Tag:    tag,
-		Router: make(map[string]*Router),
+		Tag:     tag,
+		Solvers: make([]*Solver, 0),
+		Router:  make(map[string]*Router),
 	}
 }
 
@@ -75,15 +91,108 @@ func (s *Router) ToJson() et.Json {
 }
 
 /**
-* add
+* splitPattern: Separates the host of a route from its path. As in http.ServeMux,
+* a pattern that does not begin with / starts with the host, like {tenant}.example.com/api.
+* @param pattern string
+* @return string, string
+**/
+func splitPattern(pattern string) (string, string) {
+	if strings.HasPrefix(pattern, "/") {
+		return "", pattern
+	}
+
+	idx := strings.Index(pattern, "/")
+	if idx == -1 {
+		return pattern, "/"
+	}
+
+	return pattern[:idx], pattern[idx:]
+}
+
+/**
+* routePath: Joins the optional host of a route definition to its path.
+* @param host, path string
+* @return string
+**/
+func routePath(host, path string) string {
+	if host == "" || !strings.HasPrefix(path, "/") {
+		return path
+	}
+
+	return host + path
+}
+
+/**
+* compileHost: Builds the matcher of a host pattern, where {name} captures a label
+* and * matches any label.
+* @param host string
+* @return *regexp.Regexp, error
+**/
+func compileHost(host string) (*regexp.Regexp, error) {
+	if host == "" {
+		return nil, nil
+	}
+
+	labels := strings.Split(strings.ToLower(host), ".")
+	for i, label := range labels {
+		switch {
+		case label == "*":
+			labels[i] = `[^.]+`
+		case paramRegex.MatchString(label):
+			labels[i] = fmt.Sprintf(`(?P<%s>[^.]+)`, strings.Trim(label, "{}"))
+		default:
+			labels[i] = regexp.QuoteMeta(label)
+		}
+	}
+
+	result, err := regexp.Compile(`^` + strings.Join(labels, `\.`) + `$`)
+	if err != nil {
+		return nil, fmt.Errorf(MSG_PATTERN_INVALID, host)
+	}
+
+	return result, nil
+}
+
+/**
+* add: Creates the child of tag. {name} is a param, {name:regex} a param constrained
+* by regex and *name a catch-all of the rest of the path.
 * @param tag string
-* @return *Router
+* @return *Router, error
 **/
-func (s *Router) add(tag string) *Router {
+func (s *Router) add(tag string) (*Router, error) {
 	router := newRouter(tag)
 	router.owner = s
+	switch {
+	case strings.HasPrefix(tag, "*"):
+		if s.wildcard != nil {
+			return nil, fmt.Errorf(MSG_PATTERN_INVALID, tag)
+		}
+		router.Param = tag[1:]
+		s.wildcard = router
+	case paramRegex.MatchString(tag):
+		name, expr, ok := strings.Cut(strings.Trim(tag, "{}"), ":")
+		router.Param = name
+		if ok {
+			pattern, err := regexp.Compile(`^(?:` + expr + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf(MSG_PATTERN_INVALID, tag)
+			}
+			router.pattern = pattern
+		}
+
+		/* Constrained params are tried before the free ones */
+		idx := len(s.params)
+		if router.pattern != nil {
+			idx = slices.IndexFunc(s.params, func(r *Router) bool { return r.pattern == nil })
+			if idx == -1 {
+				idx = len(s.params)
+			}
+		}
+		s.params = slices.Insert(s.params, idx, router)
+	}
+
 	s.Router[router.Tag] = router
-	return router
+	return router, nil
 }
 
 /**
@@ -92,166 +201,190 @@ func (s *Router) add(tag string) *Router {
 * @return *Solver, error
 **/
 func (s *Router) set(kind TypeRouter, method, path, solver string, typeHeader TpHeader, header map[string]string, excludeHeader []string, version int) (*Solver, error) {
-	tags := strings.Split(path, "/")
-	if len(tags) == 0 {
-		return nil, fmt.Errorf("path %s is invalid", path)
-	}
-
-	isParam := func(tag string) bool {
-		return paramRegex.MatchString(tag)
+	host, route := splitPattern(path)
+	hostPattern, err := compileHost(host)
+	if err != nil {
+		return nil, err
 	}
 
+	tags := strings.Split(strings.Trim(route, "/"), "/")
 	target := s
 	for i, tag := range tags {
 		if tag == "" {
 			continue
 		}
 
+		if strings.HasPrefix(tag, "*") && i != len(tags)-1 {
+			return nil, fmt.Errorf(MSG_PATTERN_INVALID, path)
+		}
+
 		router, ok := target.Router[tag]
 		if !ok {
-			if isParam(tag) {
-				target.Param = tag
+			router, err = target.add(tag)
+			if err != nil {
+				return nil, err
 			}
-			router = target.add(tag)
 		}
 
 		target = router
-		if i == len(tags)-1 {
-			target.Solver = newSolver(method, path)
-			target.Solver.Kind = kind
-			target.Solver.Solver = solver
-			target.Solver.TypeHeader = typeHeader
-			target.Solver.Header = header
-			target.Solver.ExcludeHeader = excludeHeader
-			target.Solver.Version = version
-		}
 	}
 
-	if target.Solver == nil {
+	if target == s {
 		return nil, fmt.Errorf(msg.MSG_SOLVER_NOT_BUILD, path)
 	}
 
-	return target.Solver, nil
+	result := newSolver(method, path)
+	result.Kind = kind
+	result.Solver = solver
+	result.TypeHeader = typeHeader
+	result.Header = header
+	result.ExcludeHeader = excludeHeader
+	result.Version = version
+	result.Host = host
+	result.host = hostPattern
+	result.node = target
+
+	idx := slices.IndexFunc(target.Solvers, func(item *Solver) bool { return item.ID == result.ID })
+	if idx == -1 {
+		target.Solvers = append(target.Solvers, result)
+	} else {
+		target.Solvers[idx] = result
+	}
+
+	return result, nil
 }
 
 /**
-* find
-* @param path string
-* @return *Router, map[string]string, error
+* withParam: Copies params adding name, so sibling branches do not share captures.
+* @param params map[string]string, name, value string
+* @return map[string]string
 **/
-func (s *Router) find(path string) (*Router, map[string]string, error) {
-	tags := strings.Split(path, "/")
-	if len(tags) == 0 {
-		return nil, nil, fmt.Errorf(msg.MSG_PATH_INVALID, path)
+func withParam(params map[string]string, name, value string) map[string]string {
+	result := make(map[string]string, len(params)+1)
+	for k, v := range params {
+		result[k] = v
 	}
+	result[fmt.Sprintf("{%s}", name)] = value
+
+	return result
+}
 
-	params := make(map[string]string)
-	result := s
-	for _, tag := range tags {
-		if len(tag) == 0 {
+/**
+* consider: Keeps the solver of the router that matches r if it ranks above the best so far.
+* Priority decides first, then the route with more rules; on a tie the route found
+* first, the one with the most specific path, stays.
+* @param r *http.Request, host string, params map[string]string, onlyGet bool, best *match
+**/
+func (s *Router) consider(r *http.Request, host string, params map[string]string, onlyGet bool, best *match) {
+	for _, solver := range s.Solvers {
+		if onlyGet && solver.Method != GET {
 			continue
 		}
 
-		router, ok := result.Router[tag]
-		if ok {
-			result = router
+		captures, ok := solver.matches(r, host)
+		if !ok {
 			continue
 		}
 
-		querys := strings.Split(tag, "?")
-		if len(querys) > 1 {
-			query := querys[0]
-			router, ok := result.Router[query]
-			if ok {
-				result = router
-			}
-
-			if result.Solver == nil {
-				return nil, nil, fmt.Errorf(msg.MSG_SOLVER_NOT_FOUND, path)
+		if best.solver != nil {
+			if solver.Priority < best.solver.Priority {
+				continue
 			}
-
-			if result.Solver.Method != GET {
-				return nil, nil, fmt.Errorf(msg.MSG_SOLVER_NOT_FOUND, path)
+			if solver.Priority == best.solver.Priority && solver.specificity() <= best.solver.specificity() {
+				continue
 			}
-
-			break
 		}
 
-		matrix := strings.Split(tag, ";")
-		if len(matrix) > 1 {
-			segment := matrix[0]
-			router, ok := result.Router[segment]
-			if ok {
-				result = router
-			}
-
-			if result.Solver == nil {
-				return nil, nil, fmt.Errorf(msg.MSG_SOLVER_NOT_FOUND, path)
-			}
-
-			if result.Solver.Method != GET {
-				return nil, nil, fmt.Errorf(msg.MSG_SOLVER_NOT_FOUND, path)
-			}
+		result := params
+		for k, v := range captures {
+			result = withParam(result, k, v)
+		}
+		best.solver = solver
+		best.params = result
+	}
+}
 
-			break
+/**
+* walk: Visits every router matching tags from i, exact segments first, then regex
+* params, free params and the catch-all. A segment with ; or ? ends the path and
+* only GET routes take it.
+* @param r *http.Request, host string, tags []string, i int, params map[string]string, best *match
+**/
+func (s *Router) walk(r *http.Request, host string, tags []string, i int, params map[string]string, best *match) {
+	if i == len(tags) {
+		s.consider(r, host, params, false, best)
+		if s.wildcard != nil {
+			s.wildcard.consider(r, host, withParam(params, s.wildcard.Param, ""), false, best)
 		}
+		return
+	}
 
-		if result.Param != "" {
-			paramKey := result.Param
-			router, ok := result.Router[paramKey]
-			if ok {
-				result = router
-				params[paramKey] = tag
-				continue
-			}
+	tag := tags[i]
+	last := false
+	if idx := strings.IndexAny(tag, "?;"); idx != -1 {
+		tag = tag[:idx]
+		last = true
+	}
+
+	next := func(router *Router, params map[string]string) {
+		if last {
+			router.consider(r, host, params, true, best)
+			return
 		}
+		router.walk(r, host, tags, i+1, params, best)
+	}
 
-		return nil, nil, fmt.Errorf(msg.MSG_SOLVER_NOT_FOUND, path)
+	if router, ok := s.Router[tag]; ok && router.Param == "" {
+		next(router, params)
 	}
 
-	if result.Solver == nil {
-		return nil, nil, fmt.Errorf(msg.MSG_SOLVER_NOT_FOUND, path)
+	for _, router := range s.params {
+		if router.pattern != nil && !router.pattern.MatchString(tag) {
+			continue
+		}
+		next(router, withParam(params, router.Param, tag))
 	}
 
-	return result, params, nil
+	if s.wildcard != nil && !last {
+		s.wildcard.consider(r, host, withParam(params, s.wildcard.Param, strings.Join(tags[i:], "/")), false, best)
+	}
 }
 
 /**
-* findResolver
-* @param r *http.Request
-* @return *Resolver, error
+* find: Looks for the solver of r below the router, keeping the best in result.
+* @param r *http.Request, result *match
 **/
-func (s *Router) findResolver(req *http.Request) (*Resolver, error) {
-	path := req.URL.Path
-	target, params, err := s.find(path)
-	if err != nil {
-		return nil, err
+func (s *Router) find(r *http.Request, result *match) {
+	tags := []string{}
+	for _, tag := range strings.Split(r.URL.Path, "/") {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
 	}
 
-	return newResolver(req, target.Solver, params)
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	s.walk(r, strings.ToLower(host), tags, 0, map[string]string{}, result)
 }
 
 /**
-* delete
-* @param path string
-* @return bool, error
+* remove: Takes solver out of the router, pruning the routers left empty.
+* @param solver *Solver
 **/
-func (s *Router) delete(path string) (bool, error) {
-	target, _, err := s.find(path)
-	if err != nil {
-		return false, err
-	}
+func (s *Router) remove(solver *Solver) {
+	s.Solvers = slices.DeleteFunc(s.Solvers, func(item *Solver) bool { return item == solver })
 
-	ok := target.owner != nil
-	for ok {
+	target := s
+	for target.owner != nil && len(target.Solvers) == 0 && len(target.Router) == 0 {
 		owner := target.owner
 		delete(owner.Router, target.Tag)
-		if len(owner.Router) > 0 {
-			break
+		owner.params = slices.DeleteFunc(owner.params, func(item *Router) bool { return item == target })
+		if owner.wildcard == target {
+			owner.wildcard = nil
 		}
 		target = owner
-		ok = target.owner != nil
 	}
-
-	return true, nil
 }
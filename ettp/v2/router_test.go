@@ -0,0 +1,76 @@
+package ettp
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterFind(t *testing.T) {
+	root := newRouter(GET)
+	routes := []struct {
+		path     string
+		solver   string
+		priority int
+	}{
+		{"/users/me", "me", 0},
+		{"/users/{id}", "user", 0},
+		{"/items/{id:[0-9]+}", "item-id", 0},
+		{"/items/{name}", "item-name", 0},
+		{"/files/*path", "files", 0},
+		{"/docs/{page}", "docs", 0},
+		{"api.example.com/status", "status-host", 0},
+		{"/status", "status", 0},
+		{"api.example.com/ping", "ping-host", 0},
+		{"/ping", "ping", 1},
+	}
+	for _, route := range routes {
+		solver, err := root.set(TpApiRest, GET, route.path, route.solver, TpKeepHeader, nil, nil, 1)
+		if err != nil {
+			t.Fatalf("set %s: %v", route.path, err)
+		}
+		solver.Priority = route.priority
+	}
+
+	tests := []struct {
+		name   string
+		host   string
+		path   string
+		want   string
+		params map[string]string
+	}{
+		{"exact before param", "", "/users/me", "me", nil},
+		{"free param", "", "/users/42", "user", map[string]string{"{id}": "42"}},
+		{"constrained param first", "", "/items/12", "item-id", map[string]string{"{id}": "12"}},
+		{"free param when constraint fails", "", "/items/abc", "item-name", map[string]string{"{name}": "abc"}},
+		{"catch-all takes the rest", "", "/files/a/b.txt", "files", map[string]string{"{path}": "a/b.txt"}},
+		{"matrix param ends the path", "", "/docs/intro;v=1", "docs", map[string]string{"{page}": "intro"}},
+		{"host route is more specific", "api.example.com", "/status", "status-host", nil},
+		{"other host takes the plain route", "other.com", "/status", "status", nil},
+		{"priority beats specificity", "api.example.com:8080", "/ping", "ping", nil},
+		{"no route", "", "/nothing", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(GET, tt.path, nil)
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+
+			var best match
+			root.find(r, &best)
+			got := ""
+			if best.solver != nil {
+				got = best.solver.Solver
+			}
+			if got != tt.want {
+				t.Fatalf("solver = %q, want %q", got, tt.want)
+			}
+
+			for k, v := range tt.params {
+				if best.params[k] != v {
+					t.Errorf("param %s = %q, want %q", k, best.params[k], v)
+				}
+			}
+		})
+	}
+}
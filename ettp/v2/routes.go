@@ -36,6 +36,15 @@ func (s *Server) basicRoutes() error {
 	s.Private(GET, "/routes", s.getRouter, s.Name)
 	s.Private(POST, "/routes", s.upsetRouter, s.Name)
 	s.Private(DELETE, "/routes/{id}", s.deleteRouteById, s.Name)
+	s.Private(GET, "/breakers", s.getBreakers, s.Name)
+	s.Private(POST, "/routes/split", s.setSplit, s.Name)
+	s.Private(POST, "/routes/promote", s.promoteVersion, s.Name)
+	s.Private(POST, "/routes/rollback", s.rollbackVersion, s.Name)
+	// Consumers
+	s.Private(GET, "/consumers", s.getConsumers, s.Name)
+	s.Private(POST, "/consumers", s.upsetConsumer, s.Name)
+	s.Private(DELETE, "/consumers/{id}", s.deleteConsumer, s.Name)
+	s.Private(GET, "/consumers/usage", s.getUsage, s.Name)
 	// Packages
 	s.Private(GET, "/packages", s.getPackages, s.Name)
 	s.Private(DELETE, "/packages/{name}", s.deletePackage, s.Name)
@@ -43,6 +52,13 @@ func (s *Server) basicRoutes() error {
 	s.Private(GET, "/cache", s.listCache, s.Name)
 	s.Private(GET, "/cache/{key}", s.getCache, s.Name)
 	s.Private(DELETE, "/cache", s.emptyCache, s.Name)
+	s.Private(DELETE, "/cache/responses", s.purgeResponses, s.Name)
+	// OpenAPI
+	s.Private(GET, "/openapi.json", s.getOpenAPI, s.Name)
+	s.Private(GET, "/docs", s.getDocs, s.Name)
+	s.Private(POST, "/openapi", s.importOpenAPI, s.Name)
+	// JSON-RPC
+	s.Private(POST, "/jsonrpc", s.handlerJsonRpc, s.Name)
 
 	return nil
 }
@@ -192,26 +208,40 @@ func (s *Server) upsetRouter(w http.ResponseWriter, r *http.Request) {
 	for i := 0; i < n; i++ {
 		item := body[i]
 		method := item.Str("method")
-		path := item.Str("path")
+		path := routePath(item.Str("host"), item.Str("path"))
 		resolve := item.Str("resolve")
 		header := item.Json("header")
 		tpHeader := item.Int("tp_header")
 		excludeHeader := item.ArrayStr("exclude_header")
 		version := item.Int("version")
 		packageName := item.Str("package_name")
-		router, err := s.SetRouter(method, path, resolve, tpHeader, header, excludeHeader, version, packageName, true)
+		var router *Solver
+		var err error
+		switch StringToTypeRouter(item.Str("kind")) {
+		case TpComposite:
+			router, err = s.SetComposite(method, path, item.Json("composite"), version, packageName, false)
+		case TpRpc:
+			router, err = s.SetRpc(method, path, resolve, version, packageName, false)
+		default:
+			router, err = s.SetRouter(method, path, resolve, tpHeader, header, excludeHeader, version, packageName, false)
+		}
 		if err != nil {
 			failed = append(failed, et.Json{
-				"method":  method,
-				"path":    path,
-				"error":   err.Error(),
+				"method": method,
+				"path":   path,
+				"error":  err.Error(),
 			})
 			continue
 		}
 
+		router.setConfig(item)
 		succeeded.Add(router.ToJson())
 	}
 
+	if succeeded.Count > 0 {
+		s.Save()
+	}
+
 	if len(failed) > 0 {
 		metric.JSON(w, r, http.StatusMultiStatus, et.Json{
 			"succeeded": succeeded,
@@ -249,6 +279,28 @@ func (s *Server) deleteRouteById(w http.ResponseWriter, r *http.Request) {
 		}})
 }
 
+/**
+* getBreakers: Lists the circuit of every upstream, filtered by route with ?id=
+* @params w http.ResponseWriter, r *http.Request
+**/
+func (s *Server) getBreakers(w http.ResponseWriter, r *http.Request) {
+	metric := middleware.GetMetrics(r)
+
+	id := r.URL.Query().Get("id")
+	result := et.Items{Result: []et.Json{}}
+	s.muRoutes.RLock()
+	for key, solver := range s.Solvers {
+		if id != "" && key != id {
+			continue
+		}
+
+		result.AddMany(solver.Breakers())
+	}
+	s.muRoutes.RUnlock()
+
+	metric.ITEMS(w, r, http.StatusOK, result)
+}
+
 /**
 * getPackages
 * @params w http.ResponseWriter, r *http.Request
@@ -307,6 +359,10 @@ func (s *Server) deletePackage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	for id := range result.Routes {
+		if solver, ok := s.Solvers[id]; ok {
+			solver.close()
+			solver.node.remove(solver)
+		}
 		delete(s.Solvers, id)
 	}
 	delete(s.Packages, name)
@@ -393,6 +449,34 @@ func (s *Server) emptyCache(w http.ResponseWriter, r *http.Request) {
 	metric.JSON(w, r, http.StatusOK, et.Json{"message": "Cache empty"})
 }
 
+/**
+* purgeResponses: Removes the cached responses of the route ?id=, all of them without it
+* @params w http.ResponseWriter
+* @params r *http.Request
+**/
+func (s *Server) purgeResponses(w http.ResponseWriter, r *http.Request) {
+	metric := middleware.GetMetrics(r)
+
+	id := r.URL.Query().Get("id")
+	if id != "" {
+		s.muRoutes.RLock()
+		_, ok := s.Solvers[id]
+		s.muRoutes.RUnlock()
+		if !ok {
+			metric.HTTPError(w, r, http.StatusNotFound, MSG_ROUTE_NOT_FOUND)
+			return
+		}
+	}
+
+	err := s.responses.purge(id)
+	if err != nil {
+		metric.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	metric.JSON(w, r, http.StatusOK, et.Json{"message": MSG_CACHE_PURGED})
+}
+
 /**
 * getCache
 * @params w http.ResponseWriter
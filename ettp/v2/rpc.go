@@ -0,0 +1,400 @@
+package ettp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/rpc"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/jrpc"
+	"github.com/cgalvisleon/et/middleware"
+)
+
+const (
+	JsonRpcVersion = "2.0"
+	/* Error codes of the JSON-RPC 2.0 specification */
+	RpcParseError     = -32700
+	RpcInvalidRequest = -32600
+	RpcMethodNotFound = -32601
+	RpcInvalidParams  = -32602
+	RpcInternalError  = -32603
+	RpcServerError    = -32000
+)
+
+/* Largest number of requests a batch may hold, the body is capped at transformMaxSize */
+const rpcMaxBatch = 100
+
+var errRpcTimeout = errors.New(http.StatusText(http.StatusGatewayTimeout))
+
+/**
+* invokeRpc: Calls the jrpc method decoding the reply as the type the method declares,
+* as gob cannot decode it into an interface.
+* @param method string, args et.Json
+* @return any, error
+**/
+func invokeRpc(method string, args et.Json) (any, error) {
+	solver, err := jrpc.GetSolver(method)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := ""
+	if n := len(solver.Inputs); n > 0 {
+		reply = solver.Inputs[n-1]
+	}
+
+	switch reply {
+	case "*et.Item":
+		return jrpc.CallItem(method, args)
+	case "*et.Items":
+		return jrpc.CallItems(method, args)
+	case "*et.Json":
+		return jrpc.CallJson(method, args)
+	default:
+		return jrpc.Call(method, args)
+	}
+}
+
+/**
+* callRpc: Calls the jrpc method with args, giving up after timeout when it is set.
+* @param method string, args et.Json, timeout time.Duration
+* @return any, error
+**/
+func callRpc(method string, args et.Json, timeout time.Duration) (any, error) {
+	if timeout <= 0 {
+		return invokeRpc(method, args)
+	}
+
+	type reply struct {
+		result any
+		err    error
+	}
+
+	ch := make(chan reply, 1)
+	go func() {
+		result, err := invokeRpc(method, args)
+		ch <- reply{result, err}
+	}()
+
+	select {
+	case res := <-ch:
+		return res.result, res.err
+	case <-time.After(timeout):
+		return nil, errRpcTimeout
+	}
+}
+
+/**
+* rpcArgs: Builds the args of the jrpc method of solver from r. The fields of a JSON body
+* come first, then the query and last the path params; a body that is not an object
+* goes in body.
+* @param solver *Solver, r *http.Request
+* @return et.Json, error
+**/
+func rpcArgs(solver *Solver, r *http.Request) (et.Json, error) {
+	result := et.Json{}
+	if r.Body != nil {
+		bt, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(bt) > 0 {
+			var body interface{}
+			if err := json.Unmarshal(bt, &body); err != nil {
+				return nil, err
+			}
+
+			if data, ok := asMap(body); ok {
+				for k, v := range data {
+					result[k] = v
+				}
+			} else {
+				result["body"] = body
+			}
+		}
+	}
+
+	for k, values := range r.URL.Query() {
+		if len(values) == 1 {
+			result[k] = values[0]
+			continue
+		}
+		result[k] = values
+	}
+
+	_, route := splitPattern(solver.Path)
+	_, params := openAPIPath(route)
+	for _, param := range params {
+		name := param.Str("name")
+		result[name] = r.PathValue(name)
+	}
+
+	return result, nil
+}
+
+/**
+* rpcStatus: Returns the HTTP status of an error of a jrpc call. The rpc_status of the
+* route maps texts contained in the error to a status; otherwise a method that is not
+* mounted is 502, an unreachable one 503, a slow one 504 and an error of the method 500.
+* @param solver *Solver, err error
+* @return int
+**/
+func rpcStatus(solver *Solver, err error) int {
+	for text, status := range solver.RpcStatus {
+		if strings.Contains(err.Error(), text) {
+			return status
+		}
+	}
+
+	switch {
+	case errors.Is(err, jrpc.ErrorSolverNotFound):
+		return http.StatusBadGateway
+	case errors.Is(err, jrpc.ErrorRpcNotConnected):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, errRpcTimeout):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+/**
+* handlerRpc: Answers a REST route with the jrpc method of its solver. An et.Item
+* that is not ok is answered as not found.
+* @params w http.ResponseWriter, r *http.Request
+**/
+func (s *Server) handlerRpc(w http.ResponseWriter, r *http.Request) {
+	metric := middleware.GetMetrics(r)
+	resolver, ok := r.Context().Value(ResoluteKey).(*Resolver)
+	if !ok {
+		s.HTTPError(resolver, metric, w, r, http.StatusInternalServerError, "resolver not found")
+		return
+	}
+
+	solver := resolver.solver
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, transformMaxSize)
+	}
+
+	args, err := rpcArgs(solver, r)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		s.HTTPError(resolver, metric, w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf(MSG_BODY_TOO_LARGE, transformMaxSize))
+		return
+	} else if err != nil {
+		s.HTTPError(resolver, metric, w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := callRpc(resolver.URL, jrpc.WithTrace(r.Context(), args), time.Duration(solver.Timeout))
+	if err != nil {
+		s.HTTPError(resolver, metric, w, r, rpcStatus(solver, err), err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if item, ok := result.(et.Item); ok && !item.Ok {
+		status = http.StatusNotFound
+	}
+
+	bt, err := json.Marshal(result)
+	if err != nil {
+		s.HTTPError(resolver, metric, w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resolver.setStatus(TpStatusSuccess)
+	s.deleteRequest(resolver.ID)
+	metric.WriteResponse(w, r, status, bt)
+}
+
+/**
+* RpcError: Error object of a JSON-RPC 2.0 response.
+**/
+type RpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+/**
+* RpcRequest: JSON-RPC 2.0 request; without id it is a notification and gets no response.
+**/
+type RpcRequest struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+/**
+* RpcResponse: JSON-RPC 2.0 response, holding either a result or an error.
+**/
+type RpcResponse struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+/**
+* params: Returns the params of the request as the args of a jrpc method, an object or an
+* array holding only one.
+* @return et.Json, error
+**/
+func (s *RpcRequest) params() (et.Json, error) {
+	if len(s.Params) == 0 || string(s.Params) == "null" {
+		return et.Json{}, nil
+	}
+
+	var result et.Json
+	if err := json.Unmarshal(s.Params, &result); err == nil {
+		return result, nil
+	}
+
+	var list []et.Json
+	if err := json.Unmarshal(s.Params, &list); err != nil || len(list) != 1 {
+		return nil, errors.New(MSG_RPC_PARAMS_INVALID)
+	}
+
+	return list[0], nil
+}
+
+/**
+* dispatchRpc: Calls the jrpc method of one JSON-RPC request, returning nil for notifications.
+* @param r *http.Request, raw json.RawMessage
+* @return *RpcResponse
+**/
+func (s *Server) dispatchRpc(r *http.Request, raw json.RawMessage) *RpcResponse {
+	var req RpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.JsonRpc != JsonRpcVersion || req.Method == "" {
+		return &RpcResponse{
+			JsonRpc: JsonRpcVersion,
+			Error:   &RpcError{Code: RpcInvalidRequest, Message: MSG_RPC_INVALID_REQUEST},
+			ID:      json.RawMessage("null"),
+		}
+	}
+
+	result := &RpcResponse{
+		JsonRpc: JsonRpcVersion,
+		ID:      req.ID,
+	}
+	args, err := req.params()
+	if err != nil {
+		result.Error = &RpcError{Code: RpcInvalidParams, Message: err.Error()}
+	} else if reply, err := invokeRpc(req.Method, jrpc.WithTrace(r.Context(), args)); err != nil {
+		var serverError rpc.ServerError
+		switch {
+		case errors.Is(err, jrpc.ErrorSolverNotFound):
+			result.Error = &RpcError{Code: RpcMethodNotFound, Message: fmt.Sprintf(MSG_RPC_METHOD_NOT_FOUND, req.Method)}
+		case errors.As(err, &serverError):
+			result.Error = &RpcError{Code: RpcServerError, Message: err.Error()}
+		default:
+			result.Error = &RpcError{Code: RpcInternalError, Message: err.Error()}
+		}
+	} else if result.Result, err = json.Marshal(reply); err != nil {
+		result.Error = &RpcError{Code: RpcInternalError, Message: err.Error()}
+	}
+
+	if len(req.ID) == 0 {
+		return nil
+	}
+
+	return result
+}
+
+/**
+* handlerJsonRpc: JSON-RPC 2.0 over HTTP dispatching to the mounted jrpc packages. The
+* requests of a batch run in parallel and answer in the same order.
+* @params w http.ResponseWriter
+* @params r *http.Request
+**/
+func (s *Server) handlerJsonRpc(w http.ResponseWriter, r *http.Request) {
+	metric := middleware.GetMetrics(r)
+
+	write := func(result any) {
+		bt, err := json.Marshal(result)
+		if err != nil {
+			metric.HTTPError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		metric.WriteResponse(w, r, http.StatusOK, bt)
+	}
+
+	bt, err := io.ReadAll(http.MaxBytesReader(w, r.Body, transformMaxSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		metric.HTTPError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf(MSG_BODY_TOO_LARGE, transformMaxSize))
+		return
+	}
+
+	var raw json.RawMessage
+	if err == nil {
+		err = json.Unmarshal(bt, &raw)
+	}
+	if err != nil {
+		write(&RpcResponse{
+			JsonRpc: JsonRpcVersion,
+			Error:   &RpcError{Code: RpcParseError, Message: MSG_RPC_PARSE_ERROR},
+			ID:      json.RawMessage("null"),
+		})
+		return
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(raw, &batch); err != nil {
+		result := s.dispatchRpc(r, raw)
+		if result == nil {
+			metric.WriteResponse(w, r, http.StatusNoContent, nil)
+			return
+		}
+		write(result)
+		return
+	}
+
+	if len(batch) == 0 {
+		write(s.dispatchRpc(r, nil))
+		return
+	}
+
+	if len(batch) > rpcMaxBatch {
+		write(&RpcResponse{
+			JsonRpc: JsonRpcVersion,
+			Error:   &RpcError{Code: RpcInvalidRequest, Message: fmt.Sprintf(MSG_RPC_BATCH_TOO_LARGE, rpcMaxBatch)},
+			ID:      json.RawMessage("null"),
+		})
+		return
+	}
+
+	responses := make([]*RpcResponse, len(batch))
+	var wg sync.WaitGroup
+	for i, item := range batch {
+		wg.Add(1)
+		go func(i int, item json.RawMessage) {
+			defer wg.Done()
+			responses[i] = s.dispatchRpc(r, item)
+		}(i, item)
+	}
+	wg.Wait()
+
+	result := []*RpcResponse{}
+	for _, item := range responses {
+		if item != nil {
+			result = append(result, item)
+		}
+	}
+
+	/* A batch of notifications gets no response */
+	if len(result) == 0 {
+		metric.WriteResponse(w, r, http.StatusNoContent, nil)
+		return
+	}
+
+	write(result)
+}
@@ -0,0 +1,131 @@
+package ettp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDispatchRpc(t *testing.T) {
+	s := &Server{}
+	tests := []struct {
+		name string
+		raw  string
+		code int
+		id   string
+		none bool
+	}{
+		{name: "not an object", raw: `"call"`, code: RpcInvalidRequest, id: "null"},
+		{name: "wrong version", raw: `{"jsonrpc":"1.0","method":"a","id":1}`, code: RpcInvalidRequest, id: "null"},
+		{name: "without method", raw: `{"jsonrpc":"2.0","id":1}`, code: RpcInvalidRequest, id: "null"},
+		{name: "unknown method", raw: `{"jsonrpc":"2.0","method":"a.b","id":1}`, code: RpcMethodNotFound, id: "1"},
+		{name: "string id", raw: `{"jsonrpc":"2.0","method":"a.b","id":"x"}`, code: RpcMethodNotFound, id: `"x"`},
+		{name: "params of one object", raw: `{"jsonrpc":"2.0","method":"a.b","params":[{"a":1}],"id":2}`, code: RpcMethodNotFound, id: "2"},
+		{name: "params of several", raw: `{"jsonrpc":"2.0","method":"a.b","params":[1,2],"id":3}`, code: RpcInvalidParams, id: "3"},
+		{name: "notification", raw: `{"jsonrpc":"2.0","method":"a.b"}`, none: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/jsonrpc", nil)
+			got := s.dispatchRpc(r, json.RawMessage(tt.raw))
+			if tt.none {
+				if got != nil {
+					t.Fatalf("notification answered with %+v", got)
+				}
+				return
+			}
+
+			if got == nil || got.Error == nil {
+				t.Fatalf("got %+v, want error %d", got, tt.code)
+			}
+			if got.Error.Code != tt.code {
+				t.Errorf("code = %d, want %d", got.Error.Code, tt.code)
+			}
+			if string(got.ID) != tt.id {
+				t.Errorf("id = %s, want %s", got.ID, tt.id)
+			}
+		})
+	}
+}
+
+/**
+* rpcBatch: Batch of n calls.
+* @param n int
+* @return string
+**/
+func rpcBatch(n int) string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"jsonrpc":"2.0","method":"a","id":%d}`, i)
+	}
+
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+func TestHandlerJsonRpc(t *testing.T) {
+	s := &Server{}
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		ids    []string
+		code   int
+	}{
+		{name: "parse error", body: `{`, status: http.StatusOK, ids: []string{"null"}, code: RpcParseError},
+		{name: "empty batch", body: `[]`, status: http.StatusOK, ids: []string{"null"}, code: RpcInvalidRequest},
+		{name: "single request", body: `{"jsonrpc":"2.0","method":"a","id":1}`, status: http.StatusOK, ids: []string{"1"}, code: RpcMethodNotFound},
+		{name: "single notification", body: `{"jsonrpc":"2.0","method":"a"}`, status: http.StatusNoContent},
+		{
+			name:   "batch keeps the order and skips notifications",
+			body:   `[{"jsonrpc":"2.0","method":"a","id":1},{"jsonrpc":"2.0","method":"b"},{"jsonrpc":"2.0","method":"c","id":"x"}]`,
+			status: http.StatusOK,
+			ids:    []string{"1", `"x"`},
+			code:   RpcMethodNotFound,
+		},
+		{name: "batch of notifications", body: `[{"jsonrpc":"2.0","method":"a"},{"jsonrpc":"2.0","method":"b"}]`, status: http.StatusNoContent},
+		{name: "batch over the limit", body: rpcBatch(rpcMaxBatch + 1), status: http.StatusOK, ids: []string{"null"}, code: RpcInvalidRequest},
+		{name: "body over the limit", body: `{"jsonrpc":"2.0","method":"a","params":{"data":"` + strings.Repeat("a", transformMaxSize) + `"},"id":1}`, status: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/jsonrpc", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			s.handlerJsonRpc(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if len(tt.ids) == 0 {
+				return
+			}
+
+			body := strings.TrimSpace(w.Body.String())
+			responses := []*RpcResponse{}
+			if strings.HasPrefix(body, "[") {
+				if err := json.Unmarshal([]byte(body), &responses); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				var single RpcResponse
+				if err := json.Unmarshal([]byte(body), &single); err != nil {
+					t.Fatal(err)
+				}
+				responses = append(responses, &single)
+			}
+
+			if len(responses) != len(tt.ids) {
+				t.Fatalf("got %d responses, want %d", len(responses), len(tt.ids))
+			}
+			for i, res := range responses {
+				if string(res.ID) != tt.ids[i] {
+					t.Errorf("response %d id = %s, want %s", i, res.ID, tt.ids[i])
+				}
+				if res.Error == nil || res.Error.Code != tt.code {
+					t.Errorf("response %d error = %+v, want code %d", i, res.Error, tt.code)
+				}
+			}
+		})
+	}
+}
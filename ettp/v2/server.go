@@ -74,6 +74,9 @@ type Server struct {
 	mux           *http.ServeMux                    `json:"-"`
 	svr           *http.Server                      `json:"-"`
 	client        *http.Client                      `json:"-"`
+	streamer      *http.Client                      `json:"-"`
+	responses     *responseCache                    `json:"-"`
+	consumers     *consumers                        `json:"-"`
 	pipe          net.Listener                      `json:"-"`
 	middlewares   []func(http.Handler) http.Handler `json:"-"`
 	authenticator func(http.Handler) http.Handler   `json:"-"`
@@ -94,6 +97,7 @@ type Server struct {
 * @return (*Server, error)
 **/
 func New(name string, config *Config) (*Server, error) {
+	middleware.LoadTrace()
 	now := timezone.Now()
 	host, _ := os.Hostname()
 	result := &Server{
@@ -108,6 +112,8 @@ func New(name string, config *Config) (*Server, error) {
 		router:        make(map[string]*Router),
 		Requests:      make(map[string]*Resolver),
 		Version:       Version,
+		responses:     newResponseCache(),
+		consumers:     newConsumers(),
 		mux:           http.NewServeMux(),
 		middlewares:   make([]func(http.Handler) http.Handler, 0),
 		authenticator: middleware.Authenticate,
@@ -161,6 +167,11 @@ func New(name string, config *Config) (*Server, error) {
 		Transport: transport,
 	}
 
+	/* Streams can last longer than any client timeout, their deadline is the route timeout */
+	result.streamer = &http.Client{
+		Transport: transport,
+	}
+
 	result.mux.HandleFunc("/", result.handler)
 
 	if config.UseCache {
@@ -274,7 +285,7 @@ func (s *Server) setSolver(kind TypeRouter, method, path, solver string, typeHea
 
 	action := "Create"
 	key := fmt.Sprintf("%s:%s", method, path)
-	result, ok := s.Solvers[key]
+	prev, ok := s.Solvers[key]
 	if ok {
 		action = "Update"
 	}
@@ -285,6 +296,12 @@ func (s *Server) setSolver(kind TypeRouter, method, path, solver string, typeHea
 		return nil, err
 	}
 
+	/* The route keeps its settings, its pool stops with the old solver and starts again with the new one */
+	if prev != nil {
+		prev.close()
+		result.copyConfig(prev)
+	}
+
 	if result.PackageName != packageName {
 		old, ok := s.Packages[result.PackageName]
 		if ok {
@@ -404,6 +421,57 @@ func (s *Server) SetRouter(method, path, resolve string, typeHeader int, header
 	return result, nil
 }
 
+/**
+* SetComposite: Sets a route answered by composing several upstream calls.
+* @param method, path string, composite et.Json, version int, packageName string, saved bool
+* @return *Solver, error
+**/
+func (s *Server) SetComposite(method, path string, composite et.Json, version int, packageName string, saved bool) (*Solver, error) {
+	config := NewComposite(composite)
+	if config == nil {
+		return nil, errors.New(MSG_COMPOSITE_REQUIRED)
+	}
+
+	err := config.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.setSolver(TpComposite, method, path, "", TpKeepHeader, map[string]string{}, []string{}, version, packageName, false)
+	if err != nil {
+		return nil, err
+	}
+	result.Composite = config
+
+	if saved {
+		s.Save()
+	}
+
+	return result, nil
+}
+
+/**
+* SetRpc: Sets a REST route answered by the jrpc method, named as Struct.Method.
+* @param method, path, rpcMethod string, version int, packageName string, saved bool
+* @return *Solver, error
+**/
+func (s *Server) SetRpc(method, path, rpcMethod string, version int, packageName string, saved bool) (*Solver, error) {
+	if rpcMethod == "" {
+		return nil, fmt.Errorf(msg.MSG_RESOLVE_NOT_VALID, rpcMethod)
+	}
+
+	result, err := s.setSolver(TpRpc, method, path, rpcMethod, TpKeepHeader, map[string]string{}, []string{}, version, packageName, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if saved {
+		s.Save()
+	}
+
+	return result, nil
+}
+
 /**
 * Public
 * @param method, path string, handlerFn http.HandlerFunc, packageName string
@@ -424,6 +492,7 @@ func (s *Server) Private(method, path string, handlerFn http.HandlerFunc, packag
 
 	if s.authenticator != nil {
 		result.middlewares = append(result.middlewares, s.authenticator)
+		result.Private = true
 	}
 
 	return result, nil
@@ -455,11 +524,13 @@ func (s *Server) Authenticator(middleware func(http.Handler) http.Handler) *Serv
 **/
 func (s *Server) RemoveRouterById(id string, save bool) error {
 	s.muRoutes.Lock()
-	_, ok := s.Solvers[id]
+	result, ok := s.Solvers[id]
 	if !ok {
 		s.muRoutes.Unlock()
 		return fmt.Errorf(msg.MSG_SOLVER_NOT_FOUND, id)
 	}
+	result.close()
+	result.node.remove(result)
 	delete(s.Solvers, id)
 	s.muRoutes.Unlock()
 
@@ -476,17 +547,27 @@ func (s *Server) RemoveRouterById(id string, save bool) error {
 * @return *Request, error
 **/
 func (s *Server) FindResolver(r *http.Request) (*Resolver, error) {
-	method := r.Method
-
+	found := false
+	best := &match{}
 	s.muRoutes.RLock()
-	router, ok := s.router[method]
+	for _, method := range []string{r.Method, ANY} {
+		router, ok := s.router[method]
+		if ok {
+			found = true
+			router.find(r, best)
+		}
+	}
 	s.muRoutes.RUnlock()
 
-	if !ok {
+	if !found {
 		return nil, errors.New("router not found")
 	}
 
-	result, err := router.findResolver(r)
+	if best.solver == nil {
+		return nil, fmt.Errorf(msg.MSG_SOLVER_NOT_FOUND, r.URL.Path)
+	}
+
+	result, err := newResolver(r, best.solver, best.params)
 	if err != nil {
 		return nil, err
 	}
@@ -556,6 +637,9 @@ func (s *Server) Close() {
 **/
 func (s *Server) Reset() {
 	s.muRoutes.Lock()
+	for _, solver := range s.Solvers {
+		solver.close()
+	}
 	s.router = make(map[string]*Router)
 	s.Solvers = make(map[string]*Solver)
 	s.Packages = make(map[string]*Package)
@@ -0,0 +1,47 @@
+package ettp
+
+import (
+	"testing"
+
+	"github.com/cgalvisleon/et/et"
+)
+
+func TestSetSolverKeepsConfig(t *testing.T) {
+	s := newTestServer("gateway")
+	id := "GET:/items"
+	if _, err := s.SetRouter(GET, "/items", "http://localhost:3000/items", int(TpKeepHeader), et.Json{}, []string{}, 1, "items", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.updateSolver(id, func(solver *Solver) error {
+		solver.ApiKey = true
+		solver.Scopes = []string{"items:read"}
+		solver.Upstreams = NewUpstreams(et.Json{
+			"targets":      []et.Json{{"url": "http://localhost:3001"}},
+			"health_check": et.Json{"path": "/health", "interval": 60},
+		})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	prev := s.Solvers[id]
+
+	/* A replica announcing the route only sends its address */
+	result, err := s.SetRouter(GET, "/items", "http://localhost:3002/items", int(TpKeepHeader), et.Json{}, []string{}, 1, "items", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer result.close()
+
+	if result.Solver != "http://localhost:3002/items" {
+		t.Errorf("solver = %s", result.Solver)
+	}
+	if !result.ApiKey || len(result.Scopes) != 1 {
+		t.Errorf("api key settings lost: api_key %v scopes %v", result.ApiKey, result.Scopes)
+	}
+	if result.Upstreams == nil || result.Upstreams != prev.Upstreams {
+		t.Fatal("upstream pool lost")
+	}
+	if result.Upstreams.stop == nil {
+		t.Error("health checks of the pool stopped")
+	}
+}
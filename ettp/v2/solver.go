@@ -4,8 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/middleware"
 )
 
 type TypeRouter int
@@ -13,6 +19,8 @@ type TypeRouter int
 const (
 	TpHandler TypeRouter = iota + 1
 	TpApiRest
+	TpComposite
+	TpRpc
 )
 
 func (t TypeRouter) String() string {
@@ -21,6 +29,10 @@ func (t TypeRouter) String() string {
 		return "handler"
 	case TpApiRest:
 		return "app"
+	case TpComposite:
+		return "composite"
+	case TpRpc:
+		return "rpc"
 	default:
 		return "Unknown"
 	}
@@ -30,6 +42,10 @@ func StringToTypeRouter(s string) TypeRouter {
 	switch s {
 	case "api":
 		return TpApiRest
+	case "composite":
+		return TpComposite
+	case "rpc":
+		return TpRpc
 	default:
 		return TpHandler
 	}
@@ -71,8 +87,32 @@ type Solver struct {
 	ExcludeHeader []string                          `json:"exclude_header"`
 	Version       int                               `json:"version"`
 	PackageName   string                            `json:"package_name"`
+	RateLimit     *middleware.RateLimitConfig       `json:"rate_limit"`
+	Upstreams     *Upstreams                        `json:"upstreams,omitempty"`
+	Timeout       Duration                          `json:"timeout"`
+	Retry         *RetryPolicy                      `json:"retry,omitempty"`
+	Breaker       *BreakerConfig                    `json:"breaker,omitempty"`
+	Host          string                            `json:"host"`
+	MatchHeader   map[string]string                 `json:"match_header"`
+	Methods       []string                          `json:"methods"`
+	Priority      int                               `json:"priority"`
+	Cache         *CacheConfig                      `json:"cache,omitempty"`
+	Transform     *Transform                        `json:"transform,omitempty"`
+	Composite     *Composite                        `json:"composite,omitempty"`
+	Private       bool                              `json:"private"`
+	Summary       string                            `json:"summary"`
+	Description   string                            `json:"description"`
+	Split         *Split                            `json:"split,omitempty"`
+	ApiKey        bool                              `json:"api_key"`
+	Scopes        []string                          `json:"scopes"`
+	RpcStatus     map[string]int                    `json:"rpc_status,omitempty"`
+	Stream        bool                              `json:"stream"`
 	middlewares   []func(http.Handler) http.Handler `json:"-"`
 	handlerFn     http.HandlerFunc                  `json:"-"`
+	breakers      map[string]*Breaker               `json:"-"`
+	muBreakers    sync.Mutex                        `json:"-"`
+	host          *regexp.Regexp                    `json:"-"`
+	node          *Router                           `json:"-"`
 }
 
 /**
@@ -108,3 +148,151 @@ func newSolver(method, path string) *Solver {
 		middlewares: make([]func(http.Handler) http.Handler, 0),
 	}
 }
+
+/**
+* setConfig: Applies the optional route settings from its JSON definition
+* @param data et.Json
+**/
+func (s *Solver) setConfig(data et.Json) {
+	s.RateLimit = middleware.NewRateLimitConfig(data.Json("rate_limit"))
+	s.setUpstreams(NewUpstreams(data.Json("upstreams")))
+	s.Timeout = Duration(parseDuration(data, "timeout"))
+	s.Retry = NewRetryPolicy(data.Json("retry"))
+	s.Breaker = NewBreakerConfig(data.Json("breaker"))
+	s.MatchHeader = map[string]string{}
+	for k, v := range data.Json("match_header") {
+		s.MatchHeader[k] = fmt.Sprintf("%v", v)
+	}
+	s.Methods = []string{}
+	for _, method := range data.ArrayStr("methods") {
+		s.Methods = append(s.Methods, strings.ToUpper(method))
+	}
+	s.Priority = data.Int("priority")
+	s.Cache = NewCacheConfig(data.Json("cache"))
+	s.Summary = data.Str("summary")
+	s.Description = data.Str("description")
+	split, err := NewSplit(data.Json("split"))
+	if err == nil {
+		err = split.check(s)
+	}
+	if err != nil {
+		logs.Alertf("Invalid split of %s: %s", s.ID, err.Error())
+		split = nil
+	}
+	s.Split = split
+	s.ApiKey = data.Bool("api_key")
+	s.Stream = data.Bool("stream")
+	s.Scopes = data.ArrayStr("scopes")
+	s.RpcStatus = map[string]int{}
+	for k := range data.Json("rpc_status") {
+		s.RpcStatus[k] = data.Json("rpc_status").Int(k)
+	}
+	s.Transform = NewTransform(data.Json("transform"))
+}
+
+/**
+* copyConfig: Copies the optional route settings from a stored solver
+* @param from *Solver
+**/
+func (s *Solver) copyConfig(from *Solver) {
+	s.RateLimit = from.RateLimit
+	s.setUpstreams(from.Upstreams)
+	s.Timeout = from.Timeout
+	s.Retry = from.Retry
+	s.Breaker = from.Breaker
+	s.MatchHeader = from.MatchHeader
+	s.Methods = from.Methods
+	s.Priority = from.Priority
+	s.Cache = from.Cache
+	s.Summary = from.Summary
+	s.Description = from.Description
+	s.Split = from.Split
+	s.ApiKey = from.ApiKey
+	s.Stream = from.Stream
+	s.Scopes = from.Scopes
+	s.RpcStatus = from.RpcStatus
+	s.Transform = from.Transform.prepare()
+	if from.Composite != nil {
+		if err := from.Composite.prepare(); err != nil {
+			logs.Alertf("Failed to load composite %s: %s", s.ID, err.Error())
+		}
+		s.Composite = from.Composite
+	}
+}
+
+/**
+* specificity: Ranks the rules of the route, a host weighs more than header or method rules.
+* @return int
+**/
+func (s *Solver) specificity() int {
+	result := 0
+	if s.Host != "" {
+		result += 2
+	}
+	if len(s.MatchHeader) > 0 || len(s.Methods) > 0 {
+		result++
+	}
+
+	return result
+}
+
+/**
+* matches: Checks the host, method and header rules of the route against r, returning
+* the labels captured from the host.
+* @param r *http.Request, host string
+* @return map[string]string, bool
+**/
+func (s *Solver) matches(r *http.Request, host string) (map[string]string, bool) {
+	if len(s.Methods) > 0 && !slices.Contains(s.Methods, r.Method) {
+		return nil, false
+	}
+
+	for k, v := range s.MatchHeader {
+		val := r.Header.Get(k)
+		if val == "" || (v != "*" && val != v) {
+			return nil, false
+		}
+	}
+
+	if s.host == nil {
+		return nil, true
+	}
+
+	values := s.host.FindStringSubmatch(host)
+	if values == nil {
+		return nil, false
+	}
+
+	result := map[string]string{}
+	for i, name := range s.host.SubexpNames() {
+		if name != "" {
+			result[name] = values[i]
+		}
+	}
+
+	return result, true
+}
+
+/**
+* setUpstreams: Replaces the upstream pool, stopping the health checks of the previous one
+* @param upstreams *Upstreams
+**/
+func (s *Solver) setUpstreams(upstreams *Upstreams) {
+	if s.Upstreams != nil && s.Upstreams != upstreams {
+		s.Upstreams.close()
+	}
+
+	s.Upstreams = upstreams
+	if upstreams != nil {
+		upstreams.start(s.ID)
+	}
+}
+
+/**
+* close: Releases the resources of the solver when it leaves the router
+**/
+func (s *Solver) close() {
+	if s.Upstreams != nil {
+		s.Upstreams.close()
+	}
+}
@@ -13,9 +13,10 @@ import (
 )
 
 type Storage struct {
-	Solvers map[string]*Solver
-	Version string
-	Key     string
+	Solvers   map[string]*Solver
+	Consumers map[string]*Consumer
+	Version   string
+	Key       string
 }
 
 /**
@@ -24,10 +25,16 @@ type Storage struct {
 * @return *Storage
 **/
 func NewStorage(s *Server) *Storage {
+	consumers := map[string]*Consumer{}
+	for _, consumer := range s.consumers.list() {
+		consumers[consumer.ID] = consumer
+	}
+
 	return &Storage{
-		Solvers: s.Solvers,
-		Version: s.Version,
-		Key:     fmt.Sprintf("%s:%s", s.Name, s.Version),
+		Solvers:   s.Solvers,
+		Consumers: consumers,
+		Version:   s.Version,
+		Key:       fmt.Sprintf("%s:%s", s.Name, s.Version),
 	}
 }
 
@@ -183,19 +190,41 @@ func (s *Server) load() error {
 			continue
 		}
 
-		s.setSolver(
-			solver.Kind,
-			solver.Method,
-			solver.Path,
-			solver.Solver,
-			solver.TypeHeader,
-			solver.Header,
-			solver.ExcludeHeader,
-			solver.Version,
-			solver.PackageName,
-			false,
-		)
+		_, err := s.loadSolver(solver)
+		if err != nil {
+			logs.Alertf("Failed to load route %s: %s", solver.ID, err.Error())
+		}
+	}
+
+	for _, consumer := range storage.Consumers {
+		s.consumers.set(consumer)
 	}
 
 	return nil
 }
+
+/**
+* loadSolver: Sets a route from its stored definition.
+* @param solver *Solver
+* @return *Solver, error
+**/
+func (s *Server) loadSolver(solver *Solver) (*Solver, error) {
+	result, err := s.setSolver(
+		solver.Kind,
+		solver.Method,
+		solver.Path,
+		solver.Solver,
+		solver.TypeHeader,
+		solver.Header,
+		solver.ExcludeHeader,
+		solver.Version,
+		solver.PackageName,
+		false,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	result.copyConfig(solver)
+	return result, nil
+}
@@ -0,0 +1,249 @@
+package ettp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/middleware"
+	"github.com/cgalvisleon/et/trace"
+)
+
+/**
+* headerHas: Reports whether the comma separated values of name hold token.
+* @param header http.Header, name, token string
+* @return bool
+**/
+func headerHas(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/**
+* isUpgrade: Reports whether r asks to switch to the WebSocket protocol.
+* @param r *http.Request
+* @return bool
+**/
+func isUpgrade(r *http.Request) bool {
+	return headerHas(r.Header, "Connection", "upgrade") && headerHas(r.Header, "Upgrade", "websocket")
+}
+
+/**
+* isStreaming: Reports whether res is a Server-Sent Events stream.
+* @param res *http.Response
+* @return bool
+**/
+func isStreaming(res *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+/**
+* acceptsStream: Reports whether r asks for a Server-Sent Events stream.
+* @param r *http.Request
+* @return bool
+**/
+func acceptsStream(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for _, item := range strings.Split(value, ",") {
+			mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(item))
+			if mediaType == "text/event-stream" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/**
+* streams: Reports whether the route streams res, an event stream or any response
+* of a route marked as stream.
+* @param res *http.Response
+* @return bool
+**/
+func (s *Solver) streams(res *http.Response) bool {
+	return isStreaming(res) || (s != nil && s.Stream)
+}
+
+/**
+* copyBody: Copies the upstream body to the client. Streams are flushed on every read
+* and freed from the server write timeout, so events reach the client without buffering.
+* @param w http.ResponseWriter, body io.Reader, stream bool
+* @return error
+**/
+func copyBody(w http.ResponseWriter, body io.Reader, stream bool) error {
+	if !stream {
+		_, err := io.Copy(w, body)
+		return err
+	}
+
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	rc.Flush()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if ferr := rc.Flush(); ferr != nil && !errors.Is(ferr, http.ErrNotSupported) {
+				return ferr
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+/**
+* upgradeURL: The transport speaks http, so ws and wss upstreams are dialed as http and https.
+* @param address string
+* @return string
+**/
+func upgradeURL(address string) string {
+	switch {
+	case strings.HasPrefix(address, "ws://"):
+		return "http://" + strings.TrimPrefix(address, "ws://")
+	case strings.HasPrefix(address, "wss://"):
+		return "https://" + strings.TrimPrefix(address, "wss://")
+	default:
+		return address
+	}
+}
+
+/**
+* handlerUpgrade: Tunnels a WebSocket connection to the upstream of the route. The
+* handshake goes through the pool and circuit of the route; once the upstream switches
+* protocols both connections are spliced until either side closes.
+* @param resolver *Resolver, metric *middleware.Metrics, rw *middleware.ResponseWriterWrapper, r *http.Request
+**/
+func (s *Server) handlerUpgrade(resolver *Resolver, metric *middleware.Metrics, rw *middleware.ResponseWriterWrapper, r *http.Request) {
+	solver := resolver.solver
+	address := resolver.URL
+	upstreams := solver.Upstreams
+	var target *Target
+	/* The pool serves the stable version, a variant of the split goes to its own address */
+	if upstreams != nil && resolver.Version == solver.Version {
+		var err error
+		target, err = upstreams.Next(r)
+		if err != nil {
+			s.HTTPError(resolver, metric, rw, r, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		address = upstreams.URL(target, address)
+	}
+
+	done := func(err error, status int) {
+		if target != nil {
+			upstreams.Done(target, err, status)
+		}
+	}
+
+	upstream := upstreamOf(address)
+	breaker := solver.breaker(upstream)
+	if !breaker.Allow() {
+		done(nil, 0)
+		s.HTTPError(resolver, metric, rw, r, http.StatusServiceUnavailable, fmt.Sprintf(MSG_CIRCUIT_OPEN, upstream))
+		return
+	}
+
+	proxyReq, err := http.NewRequestWithContext(r.Context(), resolver.Method, upgradeURL(address), nil)
+	if err != nil {
+		breaker.release()
+		done(nil, 0)
+		s.HTTPError(resolver, metric, rw, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	proxyReq.Header = trace.Outbound(r.Context(), resolver.Header)
+
+	/* The client timeout would cut the tunnel, so the handshake goes to the transport */
+	transport := s.client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	res, err := transport.RoundTrip(proxyReq)
+	if err != nil {
+		breaker.Report(true)
+		done(err, 0)
+		s.HTTPError(resolver, metric, rw, r, http.StatusBadGateway, err.Error())
+		return
+	}
+	breaker.Report(res.StatusCode >= http.StatusInternalServerError)
+	defer done(nil, res.StatusCode)
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		defer res.Body.Close()
+		setHeader(rw, res.Header)
+		setCookie(rw, res.Cookies())
+		rw.WriteHeader(res.StatusCode)
+		io.Copy(rw, res.Body)
+		s.HTTPSuccess(resolver, metric, rw)
+		return
+	}
+
+	backConn, ok := res.Body.(io.ReadWriteCloser)
+	if !ok {
+		res.Body.Close()
+		s.HTTPError(resolver, metric, rw, r, http.StatusBadGateway, MSG_UPGRADE_NOT_SUPPORTED)
+		return
+	}
+	defer backConn.Close()
+
+	conn, brw, err := http.NewResponseController(rw).Hijack()
+	if err != nil {
+		s.HTTPError(resolver, metric, rw, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Time{})
+
+	for k, v := range res.Header {
+		rw.Header()[k] = v
+	}
+	res.Header = rw.Header()
+	res.Body = nil
+	if err := res.Write(brw); err != nil {
+		logs.Alertf("websocket handshake %s error:%s", resolver.ID, err.Error())
+		return
+	}
+	if err := brw.Flush(); err != nil {
+		logs.Alertf("websocket handshake %s error:%s", resolver.ID, err.Error())
+		return
+	}
+
+	/* brw may already hold bytes the client sent after its handshake */
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(backConn, brw)
+		backConn.Close()
+		close(closed)
+	}()
+
+	size, _ := io.Copy(conn, backConn)
+	conn.Close()
+	<-closed
+
+	rw.StatusCode = http.StatusSwitchingProtocols
+	rw.Size = int(size)
+	s.HTTPSuccess(resolver, metric, rw)
+}
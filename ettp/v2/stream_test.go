@@ -0,0 +1,81 @@
+package ettp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamDetection(t *testing.T) {
+	request := func(header map[string]string) *http.Request {
+		r := httptest.NewRequest(GET, "/events", nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		header  map[string]string
+		upgrade bool
+		accepts bool
+	}{
+		{name: "plain request"},
+		{name: "websocket", header: map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "websocket"}, upgrade: true},
+		{name: "upgrade to another protocol", header: map[string]string{"Connection": "upgrade", "Upgrade": "h2c"}},
+		{name: "upgrade without connection", header: map[string]string{"Upgrade": "websocket"}},
+		{name: "event stream", header: map[string]string{"Accept": "text/event-stream"}, accepts: true},
+		{name: "event stream among others", header: map[string]string{"Accept": "application/json, text/event-stream;q=0.9"}, accepts: true},
+		{name: "json", header: map[string]string{"Accept": "application/json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := request(tt.header)
+			if got := isUpgrade(r); got != tt.upgrade {
+				t.Errorf("isUpgrade = %v, want %v", got, tt.upgrade)
+			}
+			if got := acceptsStream(r); got != tt.accepts {
+				t.Errorf("acceptsStream = %v, want %v", got, tt.accepts)
+			}
+		})
+	}
+}
+
+func TestStreams(t *testing.T) {
+	response := func(contentType string) *http.Response {
+		return &http.Response{Header: http.Header{"Content-Type": []string{contentType}}}
+	}
+
+	tests := []struct {
+		name   string
+		solver *Solver
+		res    *http.Response
+		want   bool
+	}{
+		{name: "event stream", res: response("text/event-stream; charset=utf-8"), want: true},
+		{name: "json", res: response("application/json")},
+		{name: "stream route", solver: &Solver{Stream: true}, res: response("application/x-ndjson"), want: true},
+		{name: "regular route", solver: &Solver{}, res: response("application/x-ndjson")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.solver.streams(tt.res); got != tt.want {
+				t.Fatalf("streams = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgradeURL(t *testing.T) {
+	tests := map[string]string{
+		"ws://localhost:3000/ws":  "http://localhost:3000/ws",
+		"wss://api.example.com/w": "https://api.example.com/w",
+		"http://localhost:3000":   "http://localhost:3000",
+	}
+	for address, want := range tests {
+		if got := upgradeURL(address); got != want {
+			t.Errorf("upgradeURL(%s) = %s, want %s", address, got, want)
+		}
+	}
+}
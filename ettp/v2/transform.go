@@ -0,0 +1,545 @@
+package ettp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/jwt"
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/request"
+	"github.com/cgalvisleon/et/vm"
+)
+
+var captureRegex = regexp.MustCompile(`\{(\w+)\}`)
+
+/* Largest body a transform reads into memory */
+const transformMaxSize = 4 << 20
+
+/**
+* readLimited: Reads body up to limit bytes, reporting whether it ended within them.
+* When it did not, the bytes read are returned so the caller can put them back.
+* @param body io.Reader, limit int
+* @return []byte, bool, error
+**/
+func readLimited(body io.Reader, limit int) ([]byte, bool, error) {
+	result, err := io.ReadAll(io.LimitReader(body, int64(limit)+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return result, len(result) <= limit, nil
+}
+
+/**
+* Rewrite: Replaces the upstream path matching Match, a regular expression, with Replace.
+* Replace refers to the captures of Match as $1 or ${name} and to the params of the route as {name}.
+**/
+type Rewrite struct {
+	Match   string         `json:"match"`
+	Replace string         `json:"replace"`
+	re      *regexp.Regexp `json:"-"`
+}
+
+/**
+* FieldMap: Moves the field From of a JSON body to To, both dotted paths.
+* Without To the field is removed.
+**/
+type FieldMap struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+/**
+* Transform: Declarative changes a route makes to the request before sending it and to
+* the response before answering. Claims maps a header to the dotted path of a claim of
+* the token, Wrap and Unwrap put the JSON response inside a key or take it out of one and
+* Script is a vm script run on both phases over Ctx.
+**/
+type Transform struct {
+	Rewrite     *Rewrite          `json:"rewrite,omitempty"`
+	AddQuery    map[string]string `json:"add_query"`
+	RemoveQuery []string          `json:"remove_query"`
+	Body        []FieldMap        `json:"body"`
+	Claims      map[string]string `json:"claims"`
+	Wrap        string            `json:"wrap"`
+	Unwrap      string            `json:"unwrap"`
+	Script      string            `json:"script"`
+}
+
+/**
+* NewTransform: Builds a Transform from its JSON definition.
+* @param params et.Json
+* @return *Transform
+**/
+func NewTransform(params et.Json) *Transform {
+	if params.IsEmpty() {
+		return nil
+	}
+
+	bt, err := json.Marshal(params)
+	if err != nil {
+		return nil
+	}
+
+	var result *Transform
+	err = json.Unmarshal(bt, &result)
+	if err != nil {
+		return nil
+	}
+
+	return result.prepare()
+}
+
+/**
+* prepare: Compiles the rewrite, dropping it when Match is not a valid expression.
+* @return *Transform
+**/
+func (s *Transform) prepare() *Transform {
+	if s == nil || s.Rewrite == nil || s.Rewrite.re != nil {
+		return s
+	}
+
+	re, err := regexp.Compile(s.Rewrite.Match)
+	if err != nil {
+		logs.Alertf(MSG_PATTERN_INVALID, s.Rewrite.Match)
+		s.Rewrite = nil
+		return s
+	}
+	s.Rewrite.re = re
+
+	return s
+}
+
+/**
+* responds: Reports whether the transform changes the response, which then has to be buffered.
+* @return bool
+**/
+func (s *Transform) responds() bool {
+	return s != nil && (s.Wrap != "" || s.Unwrap != "" || s.Script != "")
+}
+
+/**
+* splitPath
+* @param path string
+* @return []string
+**/
+func splitPath(path string) []string {
+	return strings.Split(path, ".")
+}
+
+/**
+* getField: Returns the value at the dotted path of data.
+* @param data map[string]interface{}, path string
+* @return interface{}, bool
+**/
+func getField(data map[string]interface{}, path string) (interface{}, bool) {
+	keys := splitPath(path)
+	var val interface{} = data
+	for _, key := range keys {
+		m, ok := asMap(val)
+		if !ok {
+			return nil, false
+		}
+		val, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return val, true
+}
+
+/**
+* setField: Sets the value at the dotted path of data, creating the missing objects.
+* @param data map[string]interface{}, path string, value interface{}
+**/
+func setField(data map[string]interface{}, path string, value interface{}) {
+	keys := splitPath(path)
+	m := data
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := asMap(m[key])
+		if !ok {
+			next = map[string]interface{}{}
+			m[key] = next
+		}
+		m = next
+	}
+
+	m[keys[len(keys)-1]] = value
+}
+
+/**
+* deleteField: Removes the value at the dotted path of data.
+* @param data map[string]interface{}, path string
+**/
+func deleteField(data map[string]interface{}, path string) {
+	keys := splitPath(path)
+	m := data
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := asMap(m[key])
+		if !ok {
+			return
+		}
+		m = next
+	}
+
+	delete(m, keys[len(keys)-1])
+}
+
+/**
+* asMap
+* @param val interface{}
+* @return map[string]interface{}, bool
+**/
+func asMap(val interface{}) (map[string]interface{}, bool) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		return v, true
+	case et.Json:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+/**
+* isJson
+* @param header http.Header
+* @return bool
+**/
+func isJson(header http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+/**
+* claims: Returns the claims of the token of r, taken from the context when a middleware
+* authenticated it or validated from the Authorization header otherwise.
+* @param r *http.Request
+* @return et.Json
+**/
+func claims(r *http.Request) et.Json {
+	token, ok := r.Context().Value(request.TokenKey).(string)
+	if !ok {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			return nil
+		}
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	clm, err := jwt.Validate(token)
+	if err != nil || clm == nil {
+		return nil
+	}
+
+	result, err := clm.ToJson()
+	if err != nil {
+		return nil
+	}
+
+	return result
+}
+
+/**
+* decodeBody: Parses body as JSON, leaving it as text when it is not.
+* @param body []byte
+* @return interface{}
+**/
+func decodeBody(body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return string(body)
+	}
+
+	return result
+}
+
+/**
+* encodeBody: Turns back the body a script left in Ctx.
+* @param val interface{}
+* @return []byte, error
+**/
+func encodeBody(val interface{}) ([]byte, error) {
+	switch v := val.(type) {
+	case nil:
+		return []byte{}, nil
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+/**
+* headerToJson: Exposes header to a script, one value per name. Set-Cookie stays out.
+* @param header http.Header
+* @return map[string]interface{}
+**/
+func headerToJson(header http.Header) map[string]interface{} {
+	result := map[string]interface{}{}
+	for k, v := range header {
+		if k == "Set-Cookie" {
+			continue
+		}
+		result[k] = strings.Join(v, ", ")
+	}
+
+	return result
+}
+
+/**
+* jsonToHeader: Replaces header with the values a script left, keeping Set-Cookie.
+* @param header http.Header, val interface{}
+**/
+func jsonToHeader(header http.Header, val interface{}) {
+	values, ok := asMap(val)
+	if !ok {
+		return
+	}
+
+	for k := range header {
+		if k != "Set-Cookie" {
+			delete(header, k)
+		}
+	}
+
+	for k, v := range values {
+		if v == nil {
+			continue
+		}
+		header.Set(k, fmt.Sprintf("%v", v))
+	}
+}
+
+/**
+* run: Runs the script of the transform over ctx, returning the ctx it leaves.
+* @param name string, ctx et.Json
+* @return et.Json, error
+**/
+func (s *Transform) run(name string, ctx et.Json) (et.Json, error) {
+	script := vm.New(name)
+	script.SetCtx(ctx)
+	return script.Run(s.Script)
+}
+
+/**
+* request: Applies the transform to the request of resolver: rewrites the upstream path,
+* edits its query, maps the JSON body, injects the claims and runs the script.
+* @param resolver *Resolver, r *http.Request
+* @return int, error
+**/
+func (s *Transform) request(resolver *Resolver, r *http.Request) (int, error) {
+	if s == nil {
+		return http.StatusOK, nil
+	}
+
+	u, err := url.Parse(resolver.URL)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if s.Rewrite != nil && s.Rewrite.re != nil {
+		replace := captureRegex.ReplaceAllStringFunc(s.Rewrite.Replace, func(tag string) string {
+			return r.PathValue(strings.Trim(tag, "{}"))
+		})
+		u.Path = s.Rewrite.re.ReplaceAllString(u.Path, replace)
+		u.RawPath = ""
+	}
+
+	/* The query of the client goes with the removed params dropped and the added ones set */
+	if len(s.AddQuery) > 0 || len(s.RemoveQuery) > 0 {
+		query := u.Query()
+		for k, v := range r.URL.Query() {
+			query[k] = v
+		}
+		for _, k := range s.RemoveQuery {
+			query.Del(k)
+		}
+		for k, v := range s.AddQuery {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	if len(s.Claims) > 0 {
+		/* Values sent by the client must not pass for claims */
+		for k := range s.Claims {
+			r.Header.Del(k)
+		}
+
+		if data := claims(r); data != nil {
+			for k, path := range s.Claims {
+				val := data.Get(splitPath(path)...)
+				if val != nil {
+					r.Header.Set(k, fmt.Sprintf("%v", val))
+				}
+			}
+		}
+	}
+
+	/* The upstream has to answer in plain text for the response to be transformed */
+	if s.responds() {
+		r.Header.Del("Accept-Encoding")
+	}
+
+	var body []byte
+	readBody := r.Body != nil && r.Body != http.NoBody && ((len(s.Body) > 0 && isJson(r.Header)) || s.Script != "")
+	if readBody {
+		var fits bool
+		body, fits, err = readLimited(r.Body, transformMaxSize)
+		r.Body.Close()
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		if !fits {
+			return http.StatusRequestEntityTooLarge, fmt.Errorf(MSG_BODY_TOO_LARGE, transformMaxSize)
+		}
+	}
+
+	if len(s.Body) > 0 && len(body) > 0 && isJson(r.Header) {
+		var data map[string]interface{}
+		if err := json.Unmarshal(body, &data); err == nil {
+			for _, field := range s.Body {
+				val, ok := getField(data, field.From)
+				if !ok {
+					continue
+				}
+				deleteField(data, field.From)
+				if field.To != "" {
+					setField(data, field.To, val)
+				}
+			}
+
+			body, err = json.Marshal(data)
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+	}
+
+	if s.Script != "" {
+		ctx, err := s.run(resolver.solver.ID, et.Json{
+			"phase":   "request",
+			"method":  r.Method,
+			"path":    r.URL.Path,
+			"url":     u.String(),
+			"headers": headerToJson(r.Header),
+			"body":    decodeBody(body),
+		})
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		if address := ctx.Str("url"); address != "" {
+			u, err = url.Parse(address)
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+		jsonToHeader(r.Header, ctx["headers"])
+		body, err = encodeBody(ctx["body"])
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	if readBody {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Del("Content-Length")
+	}
+	resolver.URL = u.String()
+
+	return http.StatusOK, nil
+}
+
+/**
+* response: Applies the transform to res: wraps or unwraps its JSON body and runs the script.
+* Streams, encoded bodies and bodies larger than transformMaxSize go untouched.
+* @param resolver *Resolver, res *http.Response
+* @return error
+**/
+func (s *Transform) response(resolver *Resolver, res *http.Response) error {
+	if !s.responds() || resolver.solver.streams(res) || res.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	if encoding := res.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return nil
+	}
+
+	body, fits, err := readLimited(res.Body, transformMaxSize)
+	if err != nil {
+		res.Body.Close()
+		return err
+	}
+	if !fits {
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+		return nil
+	}
+	res.Body.Close()
+
+	if (s.Wrap != "" || s.Unwrap != "") && isJson(res.Header) {
+		var data interface{}
+		if err := json.Unmarshal(body, &data); err == nil {
+			if m, ok := asMap(data); ok && s.Unwrap != "" {
+				if val, ok := getField(m, s.Unwrap); ok {
+					data = val
+				}
+			}
+			if s.Wrap != "" {
+				wrapped := map[string]interface{}{}
+				setField(wrapped, s.Wrap, data)
+				data = wrapped
+			}
+
+			body, err = json.Marshal(data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.Script != "" {
+		ctx, err := s.run(resolver.solver.ID, et.Json{
+			"phase":   "response",
+			"status":  res.StatusCode,
+			"headers": headerToJson(res.Header),
+			"body":    decodeBody(body),
+		})
+		if err != nil {
+			return err
+		}
+
+		res.StatusCode = ctx.ValInt(res.StatusCode, "status")
+		jsonToHeader(res.Header, ctx["headers"])
+		body, err = encodeBody(ctx["body"])
+		if err != nil {
+			return err
+		}
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.Header.Del("Content-Length")
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package ettp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadLimited(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		fits bool
+	}{
+		{name: "empty", body: "", fits: true},
+		{name: "within the limit", body: "1234", fits: true},
+		{name: "at the limit", body: "12345678", fits: true},
+		{name: "over the limit", body: "123456789", fits: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, fits, err := readLimited(strings.NewReader(tt.body), 8)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fits != tt.fits {
+				t.Fatalf("fits = %v, want %v", fits, tt.fits)
+			}
+			if fits && string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestFields(t *testing.T) {
+	data := map[string]interface{}{
+		"user": map[string]interface{}{"name": "ana", "role": "admin"},
+		"id":   "1",
+	}
+
+	if val, ok := getField(data, "user.name"); !ok || val != "ana" {
+		t.Errorf("getField user.name = %v, %v", val, ok)
+	}
+	if _, ok := getField(data, "id.name"); ok {
+		t.Error("getField went through a string")
+	}
+
+	setField(data, "meta.source.name", "gateway")
+	deleteField(data, "user.role")
+	deleteField(data, "missing.role")
+
+	want := map[string]interface{}{
+		"user": map[string]interface{}{"name": "ana"},
+		"id":   "1",
+		"meta": map[string]interface{}{"source": map[string]interface{}{"name": "gateway"}},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("data = %v, want %v", data, want)
+	}
+}
@@ -0,0 +1,458 @@
+package ettp
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/event"
+	"github.com/cgalvisleon/et/middleware"
+)
+
+const (
+	EVENT_UPSTREAM_STATUS = "event:apigateway:upstream:status"
+	ringReplicas          = 100
+)
+
+type Balance string
+
+const (
+	RoundRobin     Balance = "round_robin"
+	LeastConn      Balance = "least_conn"
+	ConsistentHash Balance = "hash"
+)
+
+/**
+* Target: Upstream instance of a Solver. A target takes traffic while it is
+* healthy and not ejected.
+**/
+type Target struct {
+	URL          string    `json:"url"`
+	Weight       int       `json:"weight"`
+	Healthy      bool      `json:"healthy"`
+	Active       int       `json:"active"`
+	Failures     int       `json:"failures"`
+	EjectedUntil time.Time `json:"ejected_until"`
+	url          *url.URL  `json:"-"`
+	current      int       `json:"-"`
+	probes       int       `json:"-"`
+}
+
+/**
+* HealthCheck: Active HTTP probe. Interval and Timeout are seconds, Healthy and
+* Unhealthy the consecutive results needed to change the target state.
+**/
+type HealthCheck struct {
+	Path      string `json:"path"`
+	Interval  int    `json:"interval"`
+	Timeout   int    `json:"timeout"`
+	Healthy   int    `json:"healthy"`
+	Unhealthy int    `json:"unhealthy"`
+}
+
+/**
+* Outlier: Passive ejection. A target failing Failures consecutive requests, by
+* transport error or 5xx, leaves the rotation for Ejection seconds.
+**/
+type Outlier struct {
+	Failures int `json:"failures"`
+	Ejection int `json:"ejection"`
+}
+
+type ringPoint struct {
+	hash   uint32
+	target *Target
+}
+
+/**
+* Upstreams: Weighted pool of targets behind a Solver.
+* HashOn is header:<name>, cookie:<name> or ip, used by the hash balance.
+**/
+type Upstreams struct {
+	Targets     []*Target     `json:"targets"`
+	Balance     Balance       `json:"balance"`
+	HashOn      string        `json:"hash_on"`
+	HealthCheck *HealthCheck  `json:"health_check"`
+	Outlier     *Outlier      `json:"outlier"`
+	solver      string        `json:"-"`
+	ring        []ringPoint   `json:"-"`
+	rr          int           `json:"-"`
+	client      *http.Client  `json:"-"`
+	stop        chan struct{} `json:"-"`
+	mu          sync.Mutex
+}
+
+/**
+* NewUpstreams: Builds the pool from its JSON definition, nil without targets.
+* @param params et.Json
+* @return *Upstreams
+**/
+func NewUpstreams(params et.Json) *Upstreams {
+	if params.IsEmpty() {
+		return nil
+	}
+
+	bt, err := json.Marshal(params)
+	if err != nil {
+		return nil
+	}
+
+	var result *Upstreams
+	err = json.Unmarshal(bt, &result)
+	if err != nil || result == nil || len(result.Targets) == 0 {
+		return nil
+	}
+
+	return result
+}
+
+/**
+* MarshalJSON: Encodes the pool under its lock, the targets state changes while serving.
+* @return []byte, error
+**/
+func (s *Upstreams) MarshalJSON() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	targets := make([]Target, len(s.Targets))
+	for i, t := range s.Targets {
+		targets[i] = *t
+	}
+
+	return json.Marshal(struct {
+		Targets     []Target     `json:"targets"`
+		Balance     Balance      `json:"balance"`
+		HashOn      string       `json:"hash_on"`
+		HealthCheck *HealthCheck `json:"health_check"`
+		Outlier     *Outlier     `json:"outlier"`
+	}{
+		Targets:     targets,
+		Balance:     s.Balance,
+		HashOn:      s.HashOn,
+		HealthCheck: s.HealthCheck,
+		Outlier:     s.Outlier,
+	})
+}
+
+/**
+* start: Resets the targets state, builds the hash ring and launches the health checks.
+* @param solver string
+**/
+func (s *Upstreams) start(solver string) {
+	s.mu.Lock()
+	s.solver = solver
+	if s.Balance == "" {
+		s.Balance = RoundRobin
+	}
+
+	targets := []*Target{}
+	for _, t := range s.Targets {
+		u, err := url.Parse(t.URL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+
+		t.url = u
+		t.Weight = max(t.Weight, 1)
+		t.Healthy = true
+		t.Active = 0
+		t.Failures = 0
+		t.EjectedUntil = time.Time{}
+		targets = append(targets, t)
+	}
+	s.Targets = targets
+
+	s.ring = []ringPoint{}
+	for _, t := range s.Targets {
+		for i := 0; i < ringReplicas*t.Weight; i++ {
+			s.ring = append(s.ring, ringPoint{hash: hashKey(fmt.Sprintf("%s#%d", t.URL, i)), target: t})
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i].hash < s.ring[j].hash })
+	s.mu.Unlock()
+
+	if s.HealthCheck == nil || s.HealthCheck.Interval <= 0 {
+		return
+	}
+
+	s.client = &http.Client{Timeout: time.Duration(max(s.HealthCheck.Timeout, 1)) * time.Second}
+	s.stop = make(chan struct{})
+	go s.probeLoop(s.stop)
+}
+
+/**
+* close: Stops the health checks.
+**/
+func (s *Upstreams) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+/**
+* hashKey
+* @param key string
+* @return uint32
+**/
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+/**
+* available: Reports whether t takes traffic, called under the lock.
+* @param t *Target, now time.Time
+* @return bool
+**/
+func (s *Upstreams) available(t *Target, now time.Time) bool {
+	return t.Healthy && !now.Before(t.EjectedUntil)
+}
+
+/**
+* hashOf: Returns the value the hash balance routes by, empty when the request lacks it.
+* @param r *http.Request
+* @return string
+**/
+func (s *Upstreams) hashOf(r *http.Request) string {
+	kind, name, _ := strings.Cut(s.HashOn, ":")
+	switch kind {
+	case "header":
+		return r.Header.Get(name)
+	case "cookie":
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	default:
+		return middleware.ClientAddress(r)
+	}
+}
+
+/**
+* Next: Picks the target for r and counts it as active until Done is called.
+* @param r *http.Request
+* @return *Target, error
+**/
+func (s *Upstreams) Next(r *http.Request) (*Target, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var result *Target
+	switch s.Balance {
+	case ConsistentHash:
+		if key := s.hashOf(r); key != "" && len(s.ring) > 0 {
+			h := hashKey(key)
+			idx := sort.Search(len(s.ring), func(i int) bool { return s.ring[i].hash >= h })
+			for i := 0; i < len(s.ring); i++ {
+				point := s.ring[(idx+i)%len(s.ring)]
+				if s.available(point.target, now) {
+					result = point.target
+					break
+				}
+			}
+		}
+	case LeastConn:
+		n := len(s.Targets)
+		for i := 0; i < n; i++ {
+			t := s.Targets[(s.rr+i)%n]
+			if !s.available(t, now) {
+				continue
+			}
+			if result == nil || t.Active*result.Weight < result.Active*t.Weight {
+				result = t
+			}
+		}
+		s.rr++
+	}
+
+	if result == nil {
+		result = s.roundRobin(now)
+	}
+
+	if result == nil {
+		return nil, fmt.Errorf(MSG_UPSTREAM_NOT_AVAILABLE, s.solver)
+	}
+
+	result.Active++
+	return result, nil
+}
+
+/**
+* roundRobin: Smooth weighted round robin over the available targets, called under the lock.
+* @param now time.Time
+* @return *Target
+**/
+func (s *Upstreams) roundRobin(now time.Time) *Target {
+	var result *Target
+	total := 0
+	for _, t := range s.Targets {
+		if !s.available(t, now) {
+			continue
+		}
+
+		t.current += t.Weight
+		total += t.Weight
+		if result == nil || t.current > result.current {
+			result = t
+		}
+	}
+
+	if result != nil {
+		result.current -= total
+	}
+
+	return result
+}
+
+/**
+* Done: Releases t and feeds the passive outlier detection with the result of the request.
+* A nil err with status 0 means the request was never sent and only releases t.
+* @param t *Target, err error, status int
+**/
+func (s *Upstreams) Done(t *Target, err error, status int) {
+	s.mu.Lock()
+	t.Active = max(t.Active-1, 0)
+	if err == nil && status == 0 {
+		s.mu.Unlock()
+		return
+	}
+
+	failed := err != nil || status >= http.StatusInternalServerError
+	if !failed {
+		t.Failures = 0
+		s.mu.Unlock()
+		return
+	}
+
+	t.Failures++
+	ejected := false
+	if s.Outlier != nil && s.Outlier.Failures > 0 && t.Failures >= s.Outlier.Failures {
+		now := time.Now()
+		available := 0
+		for _, item := range s.Targets {
+			if s.available(item, now) {
+				available++
+			}
+		}
+
+		if available > 1 {
+			t.EjectedUntil = now.Add(time.Duration(max(s.Outlier.Ejection, 1)) * time.Second)
+			t.Failures = 0
+			ejected = true
+		}
+	}
+	s.mu.Unlock()
+
+	if ejected {
+		s.publish(t, "ejected")
+	}
+}
+
+/**
+* URL: Points the resolved url at the target, keeping its path and query.
+* @param t *Target, resolved string
+* @return string
+**/
+func (s *Upstreams) URL(t *Target, resolved string) string {
+	u, err := url.Parse(resolved)
+	if err != nil {
+		return resolved
+	}
+
+	u.Scheme = t.url.Scheme
+	u.Host = t.url.Host
+	u.Path = strings.TrimSuffix(t.url.Path, "/") + "/" + strings.TrimPrefix(u.Path, "/")
+	u.RawPath = ""
+	return u.String()
+}
+
+/**
+* publish: Announces a change in the state of a target.
+* @param t *Target, status string
+**/
+func (s *Upstreams) publish(t *Target, status string) {
+	event.Publish(EVENT_UPSTREAM_STATUS, et.Json{
+		"solver": s.solver,
+		"target": t.URL,
+		"status": status,
+	})
+}
+
+/**
+* probeLoop
+* @param stop chan struct{}
+**/
+func (s *Upstreams) probeLoop(stop chan struct{}) {
+	ticker := time.NewTicker(time.Duration(s.HealthCheck.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			targets := append([]*Target{}, s.Targets...)
+			s.mu.Unlock()
+			for _, t := range targets {
+				s.probe(t)
+			}
+		}
+	}
+}
+
+/**
+* probe: Checks t and flips its state after enough consecutive results.
+* @param t *Target
+**/
+func (s *Upstreams) probe(t *Target) {
+	ok := false
+	res, err := s.client.Get(strings.TrimSuffix(t.URL, "/") + "/" + strings.TrimPrefix(s.HealthCheck.Path, "/"))
+	if err == nil {
+		res.Body.Close()
+		ok = res.StatusCode < http.StatusBadRequest
+	}
+
+	s.mu.Lock()
+	if ok == t.Healthy {
+		t.probes = 0
+		s.mu.Unlock()
+		return
+	}
+
+	t.probes++
+	threshold := max(s.HealthCheck.Unhealthy, 1)
+	if ok {
+		threshold = max(s.HealthCheck.Healthy, 1)
+	}
+	changed := t.probes >= threshold
+	if changed {
+		t.Healthy = ok
+		t.probes = 0
+	}
+	s.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if ok {
+		s.publish(t, "healthy")
+	} else {
+		s.publish(t, "unhealthy")
+	}
+}
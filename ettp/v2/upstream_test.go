@@ -0,0 +1,162 @@
+package ettp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestUpstreams(balance Balance, outlier *Outlier, targets ...*Target) *Upstreams {
+	result := &Upstreams{
+		Targets: targets,
+		Balance: balance,
+		HashOn:  "header:X-User",
+		Outlier: outlier,
+	}
+	result.start("test")
+	return result
+}
+
+func TestUpstreamsNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		balance  Balance
+		targets  []*Target
+		picks    int
+		release  bool
+		want     map[string]int
+		sequence []string
+	}{
+		{
+			name:    "round robin by weight",
+			balance: RoundRobin,
+			targets: []*Target{{URL: "http://a", Weight: 2}, {URL: "http://b", Weight: 1}},
+			picks:   6,
+			release: true,
+			want:    map[string]int{"http://a": 4, "http://b": 2},
+		},
+		{
+			name:     "least conn avoids busy targets",
+			balance:  LeastConn,
+			targets:  []*Target{{URL: "http://a"}, {URL: "http://b"}},
+			picks:    2,
+			sequence: []string{"http://a", "http://b"},
+		},
+		{
+			name:    "hash keeps the key on one target",
+			balance: ConsistentHash,
+			targets: []*Target{{URL: "http://a"}, {URL: "http://b"}, {URL: "http://c"}},
+			picks:   5,
+			release: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newTestUpstreams(tt.balance, nil, tt.targets...)
+			r := httptest.NewRequest(GET, "/", nil)
+			r.Header.Set("X-User", "42")
+
+			got := map[string]int{}
+			sequence := []string{}
+			for i := 0; i < tt.picks; i++ {
+				target, err := pool.Next(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[target.URL]++
+				sequence = append(sequence, target.URL)
+				if tt.release {
+					pool.Done(target, nil, http.StatusOK)
+				}
+			}
+
+			for url, n := range tt.want {
+				if got[url] != n {
+					t.Errorf("%s picked %d times, want %d", url, got[url], n)
+				}
+			}
+			for i, url := range tt.sequence {
+				if sequence[i] != url {
+					t.Errorf("pick %d = %s, want %s", i, sequence[i], url)
+				}
+			}
+			if tt.balance == ConsistentHash && len(got) != 1 {
+				t.Errorf("hash spread the key over %d targets", len(got))
+			}
+		})
+	}
+}
+
+func TestUpstreamsDone(t *testing.T) {
+	type result struct {
+		err    error
+		status int
+	}
+
+	tests := []struct {
+		name    string
+		targets []string
+		results []result
+		ejected bool
+	}{
+		{
+			name:    "consecutive failures eject",
+			targets: []string{"http://a", "http://b"},
+			results: []result{{nil, http.StatusBadGateway}, {errors.New("refused"), 0}},
+			ejected: true,
+		},
+		{
+			name:    "a success resets the failures",
+			targets: []string{"http://a", "http://b"},
+			results: []result{{nil, http.StatusInternalServerError}, {nil, http.StatusOK}, {nil, http.StatusInternalServerError}},
+		},
+		{
+			name:    "client errors are not failures",
+			targets: []string{"http://a", "http://b"},
+			results: []result{{nil, http.StatusNotFound}, {nil, http.StatusBadRequest}},
+		},
+		{
+			name:    "requests never sent are not failures",
+			targets: []string{"http://a", "http://b"},
+			results: []result{{nil, 0}, {nil, 0}},
+		},
+		{
+			name:    "the last available target is kept",
+			targets: []string{"http://a"},
+			results: []result{{nil, http.StatusBadGateway}, {nil, http.StatusBadGateway}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets := []*Target{}
+			for _, url := range tt.targets {
+				targets = append(targets, &Target{URL: url})
+			}
+			pool := newTestUpstreams(RoundRobin, &Outlier{Failures: 2, Ejection: 60}, targets...)
+			first := pool.Targets[0]
+			for _, res := range tt.results {
+				first.Active++
+				pool.Done(first, res.err, res.status)
+			}
+
+			if first.Active != 0 {
+				t.Errorf("active = %d, want 0", first.Active)
+			}
+
+			r := httptest.NewRequest(GET, "/", nil)
+			picked := false
+			for i := 0; i < 2*len(targets); i++ {
+				target, err := pool.Next(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				picked = picked || target == first
+				pool.Done(target, nil, 0)
+			}
+			if picked == tt.ejected {
+				t.Errorf("ejected = %v, want %v", !picked, tt.ejected)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package event
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+)
+
+/**
+* Msg: Raw message delivered by a Broker.
+**/
+type Msg struct {
+	Subject string
+	Reply   string
+	Data    []byte
+	broker  Broker
+}
+
+/**
+* Respond: Publishes data to the reply subject of a request.
+* @param data []byte
+* @return error
+**/
+func (s *Msg) Respond(data []byte) error {
+	if s.Reply == "" || s.broker == nil {
+		return nats.ErrMsgNoReply
+	}
+
+	return s.broker.Publish(s.Reply, data)
+}
+
+type Subscription interface {
+	Unsubscribe() error
+}
+
+/**
+* Broker: Transport behind Publish, Subscribe, Queue and Request. Subjects are dot
+* separated and subscriptions accept the * (one token) and > (rest) wildcards.
+**/
+type Broker interface {
+	Type() string
+	Publish(subject string, data []byte) error
+	PublishRequest(subject, reply string, data []byte) error
+	Subscribe(subject string, f func(*Msg)) (Subscription, error)
+	QueueSubscribe(subject, queue string, f func(*Msg)) (Subscription, error)
+	Request(ctx context.Context, subject string, data []byte) (*Msg, error)
+	NewInbox() string
+	IsConnected() bool
+	Close()
+}
+
+/**
+* natsBroker: Broker over a NATS connection.
+**/
+type natsBroker struct {
+	conn *nats.Conn
+}
+
+/**
+* newNatsBroker
+* @param conn *nats.Conn
+* @return *natsBroker
+**/
+func newNatsBroker(conn *nats.Conn) *natsBroker {
+	return &natsBroker{conn: conn}
+}
+
+func (s *natsBroker) Type() string {
+	return "nats"
+}
+
+func (s *natsBroker) Publish(subject string, data []byte) error {
+	return s.conn.Publish(subject, data)
+}
+
+func (s *natsBroker) PublishRequest(subject, reply string, data []byte) error {
+	return s.conn.PublishRequest(subject, reply, data)
+}
+
+/**
+* handler: Adapts f to a NATS callback.
+* @param f func(*Msg)
+* @return nats.MsgHandler
+**/
+func (s *natsBroker) handler(f func(*Msg)) nats.MsgHandler {
+	return func(m *nats.Msg) {
+		if m == nil {
+			return
+		}
+
+		f(&Msg{
+			Subject: m.Subject,
+			Reply:   m.Reply,
+			Data:    m.Data,
+			broker:  s,
+		})
+	}
+}
+
+func (s *natsBroker) Subscribe(subject string, f func(*Msg)) (Subscription, error) {
+	return s.conn.Subscribe(subject, s.handler(f))
+}
+
+func (s *natsBroker) QueueSubscribe(subject, queue string, f func(*Msg)) (Subscription, error) {
+	return s.conn.QueueSubscribe(subject, queue, s.handler(f))
+}
+
+func (s *natsBroker) Request(ctx context.Context, subject string, data []byte) (*Msg, error) {
+	m, err := s.conn.RequestWithContext(ctx, subject, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Msg{
+		Subject: m.Subject,
+		Reply:   m.Reply,
+		Data:    m.Data,
+		broker:  s,
+	}, nil
+}
+
+func (s *natsBroker) NewInbox() string {
+	return s.conn.NewRespInbox()
+}
+
+func (s *natsBroker) IsConnected() bool {
+	return s.conn.IsConnected()
+}
+
+func (s *natsBroker) Close() {
+	s.conn.Close()
+}
@@ -1,7 +1,6 @@
 package event
 
 import (
-	"sync"
 	"time"
 
 	"github.com/cgalvisleon/et/logs"
@@ -38,10 +37,5 @@ func connectTo(host, user, password string) (*Conn, error) {
 
 	logs.Logf(packageName, `Connected host:%s`, host)
 
-	return &Conn{
-		id:     utility.UUID(),
-		Conn:   client,
-		events: map[string]*nats.Subscription{},
-		mutex:  &sync.RWMutex{},
-	}, nil
+	return newConn(newNatsBroker(client), client), nil
 }
@@ -0,0 +1,435 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/msg"
+	"github.com/cgalvisleon/et/request"
+	"github.com/cgalvisleon/et/response"
+	"github.com/cgalvisleon/et/timezone"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	DLQ_SUFFIX = ".dlq"
+	dlqPrefix  = "DLQ"
+)
+
+/**
+* RetryPolicy: Retries of a handler that panics. Backoff[i] is the wait before attempt
+* i+2, the last value repeats. After MaxAttempts the message goes to <channel>.dlq.
+**/
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     []time.Duration
+}
+
+/**
+* delay
+* @param attempt int
+* @return time.Duration
+**/
+func (s RetryPolicy) delay(attempt int) time.Duration {
+	if len(s.Backoff) == 0 {
+		return time.Second
+	}
+
+	idx := min(attempt-1, len(s.Backoff)-1)
+	return s.Backoff[max(idx, 0)]
+}
+
+/**
+* call: Runs f in a consumer span turning a panic into an error.
+* @param f func(Message), m Message
+* @return error
+**/
+func call(f func(Message), m Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	consume(m.Channel+" process", m, f)
+	return nil
+}
+
+/**
+* deliver: Runs f on m, retrying with the policy backoff and dead-lettering m
+* once the attempts are exhausted. Without a policy the failure is only logged.
+* @param kind, channel string, f func(Message), m Message, policy *RetryPolicy, attempt int
+**/
+func deliver(kind, channel string, f func(Message), m Message, policy *RetryPolicy, attempt int) {
+	err := call(f, m)
+	if err == nil {
+		return
+	}
+
+	logs.ErrorCtx(m.Context(), fmt.Errorf("panic in %s channel:%s attempt:%d err:%v", kind, channel, attempt, err))
+	if policy == nil {
+		return
+	}
+
+	if attempt >= policy.MaxAttempts {
+		deadLetter(channel, m, err, attempt)
+		return
+	}
+
+	time.AfterFunc(policy.delay(attempt), func() {
+		deliver(kind, channel, f, m, policy, attempt+1)
+	})
+}
+
+/**
+* handler: Builds the core NATS callback shared by Subscribe and Queue.
+* @param kind, channel string, f func(Message), opts []RetryPolicy
+* @return func(*Msg)
+**/
+func handler(kind, channel string, f func(Message), opts []RetryPolicy) func(*Msg) {
+	var policy *RetryPolicy
+	if len(opts) > 0 {
+		policy = &opts[0]
+		if policy.MaxAttempts <= 0 {
+			policy.MaxAttempts = 1
+		}
+	}
+
+	return func(m *Msg) {
+		msg, err := DecodeMessage(m.Data)
+		if err != nil {
+			return
+		}
+
+		msg.Myself = msg.FromId == conn.id
+		deliver(kind, channel, f, msg, policy, 1)
+	}
+}
+
+/**
+* deadLetter: Publishes m with its failure to <channel>.dlq, persisted in JetStream when available.
+* @param channel string, m Message, err error, attempts int
+**/
+func deadLetter(channel string, m Message, err error, attempts int) {
+	subject := channel + DLQ_SUFFIX
+	if e := ensureStream(subject, dlqPrefix, LimitsRetention); e != nil {
+		logs.Alertf("dead letter channel:%s not persisted:%s", subject, e.Error())
+	}
+
+	original, e := m.ToJson()
+	if e != nil {
+		original = et.Json{}
+	}
+
+	letter := NewEvenMessage(subject, et.Json{
+		"channel":   channel,
+		"message":   original,
+		"error":     err.Error(),
+		"attempts":  attempts,
+		"failed_at": timezone.Now(),
+	})
+	letter.Trace = m.Trace
+	e = publishMessage(letter)
+	if e != nil {
+		logs.Alertf("dead letter channel:%s error:%s", subject, e.Error())
+	}
+}
+
+/**
+* ErrDeadLetterNotFound: The channel has no dead-letter stream.
+**/
+var ErrDeadLetterNotFound = errors.New("dead letter channel not found")
+
+/**
+* ErrLastDelivery: A durable message was nacked or left unsettled on its last delivery.
+**/
+var ErrLastDelivery = errors.New("message not acknowledged on its last delivery")
+
+/**
+* dlqStream: Returns the stream holding the dead letters of channel, which must be
+* one of the DLQ_ streams created by deadLetter.
+* @param channel string
+* @return nats.JetStreamContext, string, error
+**/
+func dlqStream(channel string) (nats.JetStreamContext, string, error) {
+	if channel == "" {
+		return nil, "", errors.New(msg.MSG_ERR_CHANNEL_REQUIRED)
+	}
+
+	js, err := jetStream()
+	if err != nil {
+		return nil, "", err
+	}
+
+	name, err := js.StreamNameBySubject(channel + DLQ_SUFFIX)
+	if errors.Is(err, nats.ErrNoMatchingStream) || (err == nil && !strings.HasPrefix(name, dlqPrefix+"_")) {
+		return nil, "", ErrDeadLetterNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	return js, name, nil
+}
+
+/**
+* deadLetterJson
+* @param raw *nats.RawStreamMsg
+* @return et.Json, error
+**/
+func deadLetterJson(raw *nats.RawStreamMsg) (et.Json, error) {
+	m, err := DecodeMessage(raw.Data)
+	if err != nil {
+		return et.Json{}, err
+	}
+
+	result := m.Data
+	if result == nil {
+		result = et.Json{}
+	}
+	result["seq"] = raw.Sequence
+	result["stored_at"] = raw.Time
+	return result, nil
+}
+
+/**
+* DeadLetters: Lists the channels holding dead letters with their counts.
+* @return []et.Json, error
+**/
+func DeadLetters() ([]et.Json, error) {
+	js, err := jetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []et.Json{}
+	for info := range js.StreamsInfo() {
+		if !strings.HasPrefix(info.Config.Name, dlqPrefix+"_") || len(info.Config.Subjects) == 0 {
+			continue
+		}
+
+		result = append(result, et.Json{
+			"channel":   strings.TrimSuffix(info.Config.Subjects[0], DLQ_SUFFIX),
+			"stream":    info.Config.Name,
+			"count":     info.State.Msgs,
+			"first_seq": info.State.FirstSeq,
+			"last_seq":  info.State.LastSeq,
+		})
+	}
+
+	return result, nil
+}
+
+/**
+* DeadLetterList: Returns up to limit dead letters of channel starting at sequence from.
+* @param channel string, from uint64, limit int
+* @return []et.Json, error
+**/
+func DeadLetterList(channel string, from uint64, limit int) ([]et.Json, error) {
+	js, name, err := dlqStream(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := js.StreamInfo(name)
+	if err != nil {
+		return nil, err
+	}
+
+	from = max(from, info.State.FirstSeq)
+	result := []et.Json{}
+	for seq := from; seq <= info.State.LastSeq && len(result) < limit; seq++ {
+		raw, err := js.GetMsg(name, seq)
+		if errors.Is(err, nats.ErrMsgNotFound) {
+			continue
+		} else if err != nil {
+			return result, err
+		}
+
+		item, err := deadLetterJson(raw)
+		if err != nil {
+			continue
+		}
+		result = append(result, item)
+	}
+
+	return result, nil
+}
+
+/**
+* DeadLetter: Returns the dead letter stored at seq for channel.
+* @param channel string, seq uint64
+* @return et.Json, error
+**/
+func DeadLetter(channel string, seq uint64) (et.Json, error) {
+	js, name, err := dlqStream(channel)
+	if err != nil {
+		return et.Json{}, err
+	}
+
+	raw, err := js.GetMsg(name, seq)
+	if err != nil {
+		return et.Json{}, err
+	}
+
+	return deadLetterJson(raw)
+}
+
+/**
+* Redrive: Publishes the original message of a dead letter back to its channel and
+* removes it from the dead letters. A zero seq re-drives every dead letter of channel.
+* @param channel string, seq uint64
+* @return int, error
+**/
+func Redrive(channel string, seq uint64) (int, error) {
+	js, name, err := dlqStream(channel)
+	if err != nil {
+		return 0, err
+	}
+
+	seqs := []uint64{seq}
+	if seq == 0 {
+		info, err := js.StreamInfo(name)
+		if err != nil {
+			return 0, err
+		}
+
+		seqs = []uint64{}
+		for s := info.State.FirstSeq; s <= info.State.LastSeq && info.State.Msgs > 0; s++ {
+			seqs = append(seqs, s)
+		}
+	}
+
+	result := 0
+	for _, s := range seqs {
+		raw, err := js.GetMsg(name, s)
+		if errors.Is(err, nats.ErrMsgNotFound) && seq == 0 {
+			continue
+		} else if err != nil {
+			return result, err
+		}
+
+		letter, err := DecodeMessage(raw.Data)
+		if err != nil {
+			return result, err
+		}
+
+		original := letter.Data.Json("message")
+		m := NewEvenMessage(channel, original.Json("data"))
+		m.FromId = conn.id
+		m.Schema = original.Str("schema")
+		m.Version = original.Int("version")
+		m.Trace = original.Str("traceparent")
+		dt, err := m.Encode()
+		if err != nil {
+			return result, err
+		}
+
+		if err := conn.broker.Publish(channel, dt); err != nil {
+			return result, err
+		}
+
+		if err := js.DeleteMsg(name, s); err != nil {
+			return result, err
+		}
+		result++
+	}
+
+	return result, nil
+}
+
+/**
+* HttpDeadLetters: Lists the dead letter channels; with channel lists its dead letters
+* from the from query param (limit, default 100) and with seq returns a single one.
+* @param w http.ResponseWriter, r *http.Request
+**/
+func HttpDeadLetters(w http.ResponseWriter, r *http.Request) {
+	channel := request.Query(r, "channel").Str()
+	seq := request.Query(r, "seq").Int()
+	if channel == "" {
+		items, err := DeadLetters()
+		if err != nil {
+			response.HTTPError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		response.ITEMS(w, r, http.StatusOK, et.Items{
+			Ok:     true,
+			Count:  len(items),
+			Result: items,
+		})
+		return
+	}
+
+	if seq > 0 {
+		item, err := DeadLetter(channel, uint64(seq))
+		if err != nil {
+			response.HTTPError(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+
+		response.ITEM(w, r, http.StatusOK, et.Item{
+			Ok:     true,
+			Result: item,
+		})
+		return
+	}
+
+	limit := request.Query(r, "limit").Int()
+	if limit <= 0 {
+		limit = 100
+	}
+	from := request.Query(r, "from").Int()
+	items, err := DeadLetterList(channel, uint64(max(from, 0)), limit)
+	if err != nil {
+		response.HTTPError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.ITEMS(w, r, http.StatusOK, et.Items{
+		Ok:     true,
+		Count:  len(items),
+		Result: items,
+	})
+}
+
+/**
+* HttpRedrive: Re-drives the dead letter seq of channel, every one when seq is 0.
+* @param w http.ResponseWriter, r *http.Request
+**/
+func HttpRedrive(w http.ResponseWriter, r *http.Request) {
+	body, err := request.GetBody(r)
+	if err != nil {
+		response.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	channel := body.Str("channel")
+	if channel == "" {
+		response.HTTPError(w, r, http.StatusBadRequest, msg.MSG_ERR_CHANNEL_REQUIRED)
+		return
+	}
+
+	seq := body.Int("seq")
+	n, err := Redrive(channel, uint64(max(seq, 0)))
+	if errors.Is(err, ErrDeadLetterNotFound) {
+		response.HTTPError(w, r, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		response.HTTPError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(w, r, http.StatusOK, et.Item{
+		Ok: true,
+		Result: et.Json{
+			"message":  "Dead letters re-driven",
+			"channel":  channel,
+			"redriven": n,
+		},
+	})
+}
@@ -1,19 +1,83 @@
 package event
 
 import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
 	"github.com/cgalvisleon/et/et"
 	"github.com/cgalvisleon/et/logs"
-	"github.com/cgalvisleon/et/timezone"
-	"github.com/cgalvisleon/et/utility"
+	"github.com/cgalvisleon/et/reg"
+	"github.com/nats-io/nats.go"
 )
 
+// emiterBufSize is the number of pending messages per subscription before dropping.
+const emiterBufSize = 1024
+
 var emiter *EventEmiter
 
 type Handler func(message *Message)
 
+/**
+* EventEmiter: In-process Broker. Each subscription delivers its messages in order on
+* its own goroutine, like a NATS subscription.
+**/
 type EventEmiter struct {
-	events map[string]Handler `json:"-"`
-	ch     chan *Message      `json:"-"`
+	subs   map[uint64]*emiterSub   `json:"-"`
+	events map[string]Subscription `json:"-"`
+	next   atomic.Uint64           `json:"-"`
+	rr     atomic.Uint64           `json:"-"`
+	closed bool                    `json:"-"`
+	mu     sync.RWMutex            `json:"-"`
+}
+
+type emiterSub struct {
+	id     uint64
+	tokens []string
+	queue  string
+	ch     chan *Msg
+	done   chan struct{}
+	once   sync.Once
+	emiter *EventEmiter
+}
+
+/**
+* Unsubscribe
+* @return error
+**/
+func (s *emiterSub) Unsubscribe() error {
+	s.emiter.mu.Lock()
+	delete(s.emiter.subs, s.id)
+	s.emiter.mu.Unlock()
+	s.once.Do(func() { close(s.done) })
+
+	return nil
+}
+
+/**
+* loop: Delivers the messages of the subscription in order.
+* @param f func(*Msg)
+**/
+func (s *emiterSub) loop(f func(*Msg)) {
+	for {
+		select {
+		case <-s.done:
+			return
+		case m := <-s.ch:
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						logs.Errorf("panic in emiter subject:%s err:%v", m.Subject, r)
+					}
+				}()
+
+				f(m)
+			}()
+		}
+	}
 }
 
 /**
@@ -21,64 +85,228 @@ type EventEmiter struct {
 * @return *EventEmiter
 **/
 func newEventEmiter() *EventEmiter {
-	result := &EventEmiter{
-		events: make(map[string]Handler),
-		ch:     make(chan *Message),
+	return &EventEmiter{
+		subs:   make(map[uint64]*emiterSub),
+		events: make(map[string]Subscription),
 	}
+}
 
-	logs.Log("event", "Event emitter initialized")
-	go result.loop()
-	return result
+/**
+* NewEventEmiter: Creates an in-process Broker.
+* @return *EventEmiter
+**/
+func NewEventEmiter() *EventEmiter {
+	return newEventEmiter()
 }
 
 /**
-* start
+* match: Reports whether subject matches the pattern tokens.
+* @param pattern []string, subject string
+* @return bool
 **/
-func (s *EventEmiter) loop() {
-	for {
+func match(pattern []string, subject string) bool {
+	tokens := strings.Split(subject, ".")
+	for i, p := range pattern {
+		if p == ">" {
+			return len(tokens) > i
+		}
+		if i >= len(tokens) {
+			return false
+		}
+		if p != "*" && p != tokens[i] {
+			return false
+		}
+	}
+
+	return len(tokens) == len(pattern)
+}
+
+func (s *EventEmiter) Type() string {
+	return "memory"
+}
+
+/**
+* publish: Delivers m to every matching subscription and to one member of each queue group.
+* @param m *Msg
+* @return int
+**/
+func (s *EventEmiter) publish(m *Msg) int {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return 0
+	}
+
+	targets := []*emiterSub{}
+	groups := map[string][]*emiterSub{}
+	for _, sub := range s.subs {
+		if !match(sub.tokens, m.Subject) {
+			continue
+		}
+
+		if sub.queue == "" {
+			targets = append(targets, sub)
+		} else {
+			groups[sub.queue] = append(groups[sub.queue], sub)
+		}
+	}
+	s.mu.RUnlock()
+
+	/* Subscriptions come out of the map in random order, sorting them keeps the round robin */
+	for _, group := range groups {
+		slices.SortFunc(group, func(a, b *emiterSub) int { return cmp.Compare(a.id, b.id) })
+		targets = append(targets, group[s.rr.Add(1)%uint64(len(group))])
+	}
+
+	for _, sub := range targets {
+		select {
+		case sub.ch <- m:
+		default:
+			logs.Alertf("emiter subject:%s subscription full, dropping message", m.Subject)
+		}
+	}
+
+	return len(targets)
+}
+
+func (s *EventEmiter) Publish(subject string, data []byte) error {
+	s.publish(&Msg{Subject: subject, Data: data, broker: s})
+	return nil
+}
+
+func (s *EventEmiter) PublishRequest(subject, reply string, data []byte) error {
+	s.publish(&Msg{Subject: subject, Reply: reply, Data: data, broker: s})
+	return nil
+}
+
+/**
+* subscribe
+* @param subject, queue string, f func(*Msg)
+* @return Subscription, error
+**/
+func (s *EventEmiter) subscribe(subject, queue string, f func(*Msg)) (Subscription, error) {
+	if len(subject) == 0 {
+		return nil, nats.ErrBadSubject
+	}
+
+	result := &emiterSub{
+		id:     s.next.Add(1),
+		tokens: strings.Split(subject, "."),
+		queue:  queue,
+		ch:     make(chan *Msg, emiterBufSize),
+		done:   make(chan struct{}),
+		emiter: s,
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, nats.ErrConnectionClosed
+	}
+	s.subs[result.id] = result
+	s.mu.Unlock()
+
+	go result.loop(f)
+
+	return result, nil
+}
+
+func (s *EventEmiter) Subscribe(subject string, f func(*Msg)) (Subscription, error) {
+	return s.subscribe(subject, "", f)
+}
+
+func (s *EventEmiter) QueueSubscribe(subject, queue string, f func(*Msg)) (Subscription, error) {
+	return s.subscribe(subject, queue, f)
+}
+
+func (s *EventEmiter) Request(ctx context.Context, subject string, data []byte) (*Msg, error) {
+	inbox := s.NewInbox()
+	ch := make(chan *Msg, 1)
+	sub, err := s.Subscribe(inbox, func(m *Msg) {
 		select {
-		case message := <-s.ch:
-			if message != nil {
-				fn, ok := s.events[message.Channel]
-				if !ok {
-					continue
-				}
-
-				fn(message)
-			}
+		case ch <- m:
+		default:
 		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+
+	if s.publish(&Msg{Subject: subject, Reply: inbox, Data: data, broker: s}) == 0 {
+		return nil, nats.ErrNoResponders
+	}
+
+	select {
+	case m := <-ch:
+		return m, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *EventEmiter) NewInbox() string {
+	return "_INBOX." + reg.ULID()
+}
+
+func (s *EventEmiter) IsConnected() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return !s.closed
+}
+
+func (s *EventEmiter) Close() {
+	s.mu.Lock()
+	s.closed = true
+	subs := s.subs
+	s.subs = make(map[uint64]*emiterSub)
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.once.Do(func() { close(sub.done) })
 	}
 }
 
 /**
-* on
+* on: Replaces the handler of channel.
 * @param channel string, handler Handler
 **/
 func (s *EventEmiter) on(channel string, handler Handler) {
-	if s.events == nil {
-		s.events = make(map[string]Handler)
+	sub, err := s.Subscribe(channel, func(m *Msg) {
+		message, err := DecodeMessage(m.Data)
+		if err != nil {
+			return
+		}
+
+		handler(&message)
+	})
+	if err != nil {
+		logs.Alertf("emiter on channel:%s error:%s", channel, err.Error())
+		return
 	}
 
-	s.events[channel] = handler
+	s.mu.Lock()
+	old, ok := s.events[channel]
+	s.events[channel] = sub
+	s.mu.Unlock()
+	if ok {
+		old.Unsubscribe()
+	}
 }
 
 /**
-* emit
+* emiter
 * @param channel string, data et.Json
 **/
 func (s *EventEmiter) emiter(channel string, data et.Json) {
-	if s.ch == nil {
+	message := NewEvenMessage(channel, data)
+	dt, err := message.Encode()
+	if err != nil {
 		return
 	}
 
-	message := &Message{
-		CreatedAt: timezone.Now(),
-		Id:        utility.UUID(),
-		Channel:   channel,
-		Data:      data,
-	}
-
-	s.ch <- message
+	s.Publish(channel, dt)
 }
 
 /**
@@ -86,10 +314,6 @@ func (s *EventEmiter) emiter(channel string, data et.Json) {
 * @param channel string, handler Handler
 **/
 func On(channel string, handler Handler) {
-	if emiter == nil {
-		emiter = newEventEmiter()
-	}
-
 	emiter.on(channel, handler)
 }
 
@@ -98,9 +322,5 @@ func On(channel string, handler Handler) {
 * @param channel string, data et.Json
 **/
 func Emiter(channel string, data et.Json) {
-	if emiter == nil {
-		emiter = newEventEmiter()
-	}
-
 	emiter.emiter(channel, data)
 }
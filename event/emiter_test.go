@@ -0,0 +1,201 @@
+package event
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		subject string
+		want    bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.updated", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.created.eu", false},
+		{"orders.*", "orders", false},
+		{"*.created", "orders.created", true},
+		{"orders.>", "orders.created", true},
+		{"orders.>", "orders.created.eu", true},
+		{"orders.>", "orders", false},
+		{">", "orders", true},
+		{"orders", "orders.created", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.subject, func(t *testing.T) {
+			if got := match(strings.Split(tt.pattern, "."), tt.subject); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+/**
+* collector: Counts the messages received by each subscriber.
+**/
+type collector struct {
+	counts map[string]int
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+}
+
+func (s *collector) handler(name string) func(*Msg) {
+	return func(m *Msg) {
+		s.mu.Lock()
+		s.counts[name]++
+		s.mu.Unlock()
+		s.wg.Done()
+	}
+}
+
+func TestEmiterDelivery(t *testing.T) {
+	tests := []struct {
+		name      string
+		subscribe func(b *EventEmiter, c *collector)
+		publish   []string
+		delivered int
+		want      map[string]int
+	}{
+		{
+			name: "every subscriber gets the message",
+			subscribe: func(b *EventEmiter, c *collector) {
+				b.Subscribe("orders.created", c.handler("a"))
+				b.Subscribe("orders.created", c.handler("b"))
+			},
+			publish:   []string{"orders.created"},
+			delivered: 2,
+			want:      map[string]int{"a": 1, "b": 1},
+		},
+		{
+			name: "wildcards",
+			subscribe: func(b *EventEmiter, c *collector) {
+				b.Subscribe("orders.*", c.handler("token"))
+				b.Subscribe("orders.>", c.handler("tail"))
+				b.Subscribe("billing.>", c.handler("other"))
+			},
+			publish:   []string{"orders.created", "orders.created.eu"},
+			delivered: 3,
+			want:      map[string]int{"token": 1, "tail": 2},
+		},
+		{
+			name: "one member of each queue group",
+			subscribe: func(b *EventEmiter, c *collector) {
+				b.QueueSubscribe("jobs", "workers", c.handler("workers"))
+				b.QueueSubscribe("jobs", "workers", c.handler("workers"))
+				b.QueueSubscribe("jobs", "audit", c.handler("audit"))
+				b.Subscribe("jobs", c.handler("plain"))
+			},
+			publish:   []string{"jobs", "jobs", "jobs"},
+			delivered: 9,
+			want:      map[string]int{"workers": 3, "audit": 3, "plain": 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := NewEventEmiter()
+			defer broker.Close()
+
+			c := &collector{counts: map[string]int{}}
+			c.wg.Add(tt.delivered)
+			tt.subscribe(broker, c)
+			for _, subject := range tt.publish {
+				broker.Publish(subject, []byte("{}"))
+			}
+
+			done := make(chan struct{})
+			go func() { c.wg.Wait(); close(done) }()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatalf("delivered %v, want %v", c.counts, tt.want)
+			}
+
+			time.Sleep(20 * time.Millisecond)
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if fmt.Sprint(c.counts) != fmt.Sprint(tt.want) {
+				t.Fatalf("delivered %v, want %v", c.counts, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmiterQueueBalance(t *testing.T) {
+	broker := NewEventEmiter()
+	defer broker.Close()
+
+	c := &collector{counts: map[string]int{}}
+	c.wg.Add(10)
+	broker.QueueSubscribe("jobs", "workers", c.handler("a"))
+	broker.QueueSubscribe("jobs", "workers", c.handler("b"))
+	for i := 0; i < 10; i++ {
+		broker.Publish("jobs", []byte("{}"))
+	}
+	c.wg.Wait()
+
+	if c.counts["a"] != 5 || c.counts["b"] != 5 {
+		t.Fatalf("queue group split %v, want 5 each", c.counts)
+	}
+}
+
+func TestEmiterOrder(t *testing.T) {
+	broker := NewEventEmiter()
+	defer broker.Close()
+
+	got := []string{}
+	var wg sync.WaitGroup
+	wg.Add(100)
+	broker.Subscribe("seq", func(m *Msg) {
+		got = append(got, string(m.Data))
+		wg.Done()
+	})
+	want := []string{}
+	for i := 0; i < 100; i++ {
+		data := fmt.Sprintf("%03d", i)
+		want = append(want, data)
+		broker.Publish("seq", []byte(data))
+	}
+	wg.Wait()
+
+	if !sort.StringsAreSorted(got) || len(got) != len(want) {
+		t.Fatalf("messages out of order: %v", got)
+	}
+}
+
+func TestUseBrokerMovesSubscriptions(t *testing.T) {
+	previous := conn.broker
+	defer UseBroker(previous)
+
+	channel := fmt.Sprintf("test-move-%d", time.Now().UnixNano())
+	received := make(chan string, 4)
+	Subscribe(channel, func(m Message) { received <- "a" })
+	Subscribe(channel, func(m Message) { received <- "b" })
+	defer Unsubscribe(channel)
+
+	UseBroker(NewEventEmiter())
+	if err := Publish(channel, et.Json{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for len(got) < 2 {
+		select {
+		case name := <-received:
+			got = append(got, name)
+		case <-time.After(time.Second):
+			t.Fatalf("received %v on the new broker, want both subscriptions", got)
+		}
+	}
+	sort.Strings(got)
+	if fmt.Sprint(got) != "[a b]" {
+		t.Fatalf("received %v", got)
+	}
+}
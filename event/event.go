@@ -37,6 +37,8 @@ var (
 func init() {
 	oS = runtime.GOOS
 	hostName, _ = os.Hostname()
+	emiter = newEventEmiter()
+	conn = newConn(emiter, nil)
 	go func() {
 		for m := range asyncPublishCh {
 			publish(m.channel, m.data)
@@ -45,12 +47,132 @@ func init() {
 }
 
 type Conn struct {
-	*nats.Conn
+	broker Broker
+	nats   *nats.Conn
 	id     string
-	events map[string]*nats.Subscription
+	js     nats.JetStreamContext
+	events map[string][]*subscription
 	mutex  *sync.RWMutex
 }
 
+/**
+* subscription: Registered handler, kept so it can move to a new broker. A channel
+* holds every subscription made on it. JetStream subscriptions have no handler and
+* stay on their connection.
+**/
+type subscription struct {
+	subject string
+	queue   string
+	f       func(*Msg)
+	sub     Subscription
+}
+
+/**
+* newConn
+* @param broker Broker, nc *nats.Conn
+* @return *Conn
+**/
+func newConn(broker Broker, nc *nats.Conn) *Conn {
+	return &Conn{
+		broker: broker,
+		nats:   nc,
+		id:     utility.UUID(),
+		events: map[string][]*subscription{},
+		mutex:  &sync.RWMutex{},
+	}
+}
+
+/**
+* subscribe: Subscribes f on channel, in queue when given, and registers it.
+* @param channel, queue string, f func(*Msg)
+* @return error
+**/
+func (s *Conn) subscribe(channel, queue string, f func(*Msg)) error {
+	var sub Subscription
+	var err error
+	if queue == "" {
+		sub, err = s.broker.Subscribe(channel, f)
+	} else {
+		sub, err = s.broker.QueueSubscribe(channel, queue, f)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.events[channel] = append(s.events[channel], &subscription{
+		subject: channel,
+		queue:   queue,
+		f:       f,
+		sub:     sub,
+	})
+	s.mutex.Unlock()
+
+	return nil
+}
+
+/**
+* register: Registers a subscription made outside the broker, such as JetStream.
+* @param channel string, sub Subscription
+**/
+func (s *Conn) register(channel string, sub Subscription) {
+	s.mutex.Lock()
+	s.events[channel] = append(s.events[channel], &subscription{
+		subject: channel,
+		sub:     sub,
+	})
+	s.mutex.Unlock()
+}
+
+/**
+* setConn: Replaces the connection, moving the handlers subscribed on the previous one.
+* @param result *Conn
+**/
+func setConn(result *Conn) {
+	old := conn
+	conn = result
+	if old == nil {
+		return
+	}
+
+	old.mutex.Lock()
+	events := old.events
+	old.events = map[string][]*subscription{}
+	old.mutex.Unlock()
+
+	for channel, items := range events {
+		for _, item := range items {
+			if item.f == nil {
+				continue
+			}
+
+			item.sub.Unsubscribe()
+			if err := result.subscribe(channel, item.queue, item.f); err != nil {
+				logs.Alertf("event move channel:%s error:%s", channel, err.Error())
+			}
+		}
+	}
+}
+
+/**
+* UseBroker: Sends the events through broker, moving the current subscriptions to it.
+* @param broker Broker
+**/
+func UseBroker(broker Broker) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	setConn(newConn(broker, nil))
+}
+
+/**
+* Type: Returns the kind of broker in use, memory until Load connects to NATS.
+* @return string
+**/
+func Type() string {
+	return conn.broker.Type()
+}
+
 /**
 * LoadTo loads the event connection from a Config struct.
 * @param params utility.Config
@@ -61,9 +183,13 @@ func LoadTo(params utility.Config) error {
 	user := params.GetStr("NATS_USER", "")
 	password := params.GetStr("NATS_PASSWORD", "")
 
-	var err error
-	conn, err = connectTo(host, user, password)
-	return err
+	result, err := connectTo(host, user, password)
+	if err != nil {
+		return err
+	}
+
+	setConn(result)
+	return nil
 }
 
 /**
@@ -78,7 +204,7 @@ func Load() error {
 	loadMu.Lock()
 	defer loadMu.Unlock()
 
-	if conn != nil {
+	if conn != nil && conn.nats != nil {
 		return nil
 	}
 
@@ -96,28 +222,35 @@ func Load() error {
 }
 
 /**
-* Close unsubscribes all active subscriptions and closes the NATS connection.
+* Close unsubscribes all active subscriptions and closes the broker connection.
 **/
 func Close() {
 	if conn == nil {
 		return
 	}
 
-	for _, sub := range conn.events {
-		sub.Unsubscribe()
+	conn.mutex.Lock()
+	for _, items := range conn.events {
+		for _, item := range items {
+			item.sub.Unsubscribe()
+		}
 	}
+	conn.events = map[string][]*subscription{}
+	conn.mutex.Unlock()
 
-	conn.Close()
+	if conn.broker != Broker(emiter) {
+		conn.broker.Close()
+	}
 
 	logs.Log(packageName, `Disconnect...`)
 }
 
 /**
-* IsLoad
+* IsLoad: Reports whether the events go through NATS.
 * @return bool
 **/
 func IsLoad() bool {
-	return conn != nil
+	return conn != nil && conn.nats != nil
 }
 
 /**
@@ -129,5 +262,5 @@ func HealthCheck() bool {
 		return false
 	}
 
-	return conn.IsConnected()
+	return conn.broker.IsConnected()
 }
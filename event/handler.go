@@ -1,7 +1,9 @@
 package event
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/cgalvisleon/et/et"
@@ -9,7 +11,7 @@ import (
 	"github.com/cgalvisleon/et/msg"
 	"github.com/cgalvisleon/et/request"
 	"github.com/cgalvisleon/et/response"
-	"github.com/nats-io/nats.go"
+	"github.com/cgalvisleon/et/trace"
 )
 
 type EventStatus string
@@ -20,6 +22,7 @@ const (
 	EventUnsubscribed EventStatus = "unsubscribed"
 	EventReceived     EventStatus = "received"
 	QUEUE_STACK                   = "stack"
+	QUEUE_SOURCE                  = "source"
 	EVENT_STATUS                  = "event:status"
 	EVENT_LOG                     = "event:log"
 	EVENT_OVERFLOW                = "event:overflow"
@@ -37,14 +40,52 @@ func publish(channel string, data et.Json) error {
 		return nil
 	}
 
-	msg := NewEvenMessage(channel, data)
-	msg.FromId = conn.id
-	dt, err := msg.Encode()
+	return publishMessage(NewEvenMessage(channel, data))
+}
+
+/**
+* PublishContext: Publish carrying the traceparent of ctx.
+* @param ctx context.Context, channel string, data et.Json
+* @return error
+**/
+func PublishContext(ctx context.Context, channel string, data et.Json) error {
+	if conn == nil {
+		return nil
+	}
+
+	return publishContext(ctx, NewEvenMessage(channel, data))
+}
+
+/**
+* publishContext: Publishes message as a producer span child of ctx.
+* @param ctx context.Context, message Message
+* @return error
+**/
+func publishContext(ctx context.Context, message Message) error {
+	ctx, record := trace.Start(ctx, message.Channel+" publish", trace.KindProducer)
+	record.Set("messaging.system", Type()).Set("messaging.destination.name", message.Channel)
+	err := publishMessage(message.WithTrace(ctx))
+	record.Error(err).Finish()
+	return err
+}
+
+/**
+* publishMessage: Publishes an envelope already built, stamping the sender.
+* @param message Message
+* @return error
+**/
+func publishMessage(message Message) error {
+	if conn == nil {
+		return nil
+	}
+
+	message.FromId = conn.id
+	dt, err := message.Encode()
 	if err != nil {
 		return err
 	}
 
-	return conn.Publish(msg.Channel, dt)
+	return conn.broker.Publish(message.Channel, dt)
 }
 
 /**
@@ -61,7 +102,7 @@ func Publish(channel string, data et.Json) error {
 }
 
 /**
-* Unsubscribe
+* Unsubscribe: Removes every subscription on channel.
 * @param channel string
 * @return error
 **/
@@ -77,23 +118,20 @@ func Unsubscribe(channel string) error {
 	conn.mutex.Lock()
 	defer conn.mutex.Unlock()
 
-	subscribe, ok := conn.events[channel]
-	if !ok {
-		return nil
+	for _, item := range conn.events[channel] {
+		item.sub.Unsubscribe()
 	}
-
-	subscribe.Unsubscribe()
 	delete(conn.events, channel)
 
 	return nil
 }
 
 /**
-* Subscribe
-* @param channel string, f func(Message)
+* Subscribe: With a RetryPolicy a panicking f is retried and then dead-lettered to <channel>.dlq.
+* @param channel string, f func(Message), opts ...RetryPolicy
 * @return error
 **/
-func Subscribe(channel string, f func(Message)) (err error) {
+func Subscribe(channel string, f func(Message), opts ...RetryPolicy) (err error) {
 	if conn == nil {
 		return
 	}
@@ -102,44 +140,15 @@ func Subscribe(channel string, f func(Message)) (err error) {
 		return
 	}
 
-	subscribe, err := conn.Subscribe(channel,
-		func(m *nats.Msg) {
-			defer func() {
-				if r := recover(); r != nil {
-					logs.Errorf("panic in Subscribe channel:%s err:%v", channel, r)
-				}
-			}()
-
-			if m == nil {
-				return
-			}
-
-			msg, err := DecodeMessage(m.Data)
-			if err != nil {
-				return
-			}
-
-			msg.Myself = msg.FromId == conn.id
-			f(msg)
-		},
-	)
-	if err != nil {
-		return err
-	}
-
-	conn.mutex.Lock()
-	conn.events[channel] = subscribe
-	conn.mutex.Unlock()
-
-	return err
+	return conn.subscribe(channel, "", handler("Subscribe", channel, f, opts))
 }
 
 /**
-* Queue
-* @param channel string, queue string, f func(Message)
+* Queue: With a RetryPolicy a panicking f is retried and then dead-lettered to <channel>.dlq.
+* @param channel string, queue string, f func(Message), opts ...RetryPolicy
 * @return error
 **/
-func Queue(channel, queue string, f func(Message)) (err error) {
+func Queue(channel, queue string, f func(Message), opts ...RetryPolicy) (err error) {
 	if conn == nil {
 		return errors.New(msg.MSG_ERR_NOT_CONNECT)
 	}
@@ -148,57 +157,65 @@ func Queue(channel, queue string, f func(Message)) (err error) {
 		return nil
 	}
 
-	subscribe, err := conn.QueueSubscribe(
-		channel,
-		queue,
-		func(m *nats.Msg) {
-			defer func() {
-				if r := recover(); r != nil {
-					logs.Errorf("panic in Queue channel:%s err:%v", channel, r)
-				}
-			}()
-
-			if m == nil {
-				return
-			}
-
-			msg, err := DecodeMessage(m.Data)
-			if err != nil {
-				return
-			}
-
-			msg.Myself = msg.FromId == conn.id
-
-			f(msg)
-		},
-	)
-	if err != nil {
-		return err
-	}
-
-	conn.mutex.Lock()
-	conn.events[channel] = subscribe
-	conn.mutex.Unlock()
-
-	return nil
+	return conn.subscribe(channel, queue, handler("Queue", channel, f, opts))
 }
 
 /**
-* Stack
+* Stack: Work queue on channel backed by JetStream, so messages published while no
+* instance is listening are delivered later. Each message is acked after f returns.
+* Falls back to a core NATS queue when JetStream is not available.
 * @param channel string, f func(Message)
 * @return error
 **/
 func Stack(channel string, f func(Message)) error {
-	return Queue(channel, QUEUE_STACK, f)
+	if conn == nil {
+		return errors.New(msg.MSG_ERR_NOT_CONNECT)
+	}
+
+	if len(channel) == 0 {
+		return nil
+	}
+
+	err := ensureStream(channel, "STACK", WorkQueueRetention)
+	if err != nil {
+		logs.Alertf("stack channel:%s jetstream unavailable, using core queue:%s", channel, err.Error())
+		return Queue(channel, QUEUE_STACK, f)
+	}
+
+	return Durable(channel, QUEUE_STACK+"_"+channel, func(m Message) {
+		f(m)
+		m.Ack()
+	})
 }
 
 /**
-* Source
+* Source: Delivers the messages of channel to this host through a durable consumer, so
+* a restart resumes after the last message acked instead of replaying the history.
+* The first start begins with new messages. Falls back to a core NATS subscription
+* when JetStream is not available.
 * @param channel string, f func(Message)
 * @return error
 **/
 func Source(channel string, f func(Message)) error {
-	return Subscribe(channel, f)
+	if conn == nil {
+		return errors.New(msg.MSG_ERR_NOT_CONNECT)
+	}
+
+	if len(channel) == 0 {
+		return nil
+	}
+
+	err := ensureStream(channel, "SOURCE", LimitsRetention)
+	if err != nil {
+		logs.Alertf("source channel:%s jetstream unavailable, using core subscription:%s", channel, err.Error())
+		return Subscribe(channel, f)
+	}
+
+	consumer := fmt.Sprintf("%s_%s_%s", QUEUE_SOURCE, channel, hostName)
+	return Durable(channel, consumer, func(m Message) {
+		f(m)
+		m.Ack()
+	}, DurableOptions{DeliverNew: true})
 }
 
 /**
@@ -0,0 +1,322 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/msg"
+	"github.com/nats-io/nats.go"
+)
+
+type Retention string
+
+const (
+	LimitsRetention    Retention = "limits"
+	InterestRetention  Retention = "interest"
+	WorkQueueRetention Retention = "workqueue"
+)
+
+/**
+* policy
+* @return nats.RetentionPolicy
+**/
+func (s Retention) policy() nats.RetentionPolicy {
+	switch s {
+	case InterestRetention:
+		return nats.InterestPolicy
+	case WorkQueueRetention:
+		return nats.WorkQueuePolicy
+	default:
+		return nats.LimitsPolicy
+	}
+}
+
+/**
+* DurableOptions: Delivery settings of a durable consumer. StartSeq, StartTime and
+* DeliverNew only apply when the consumer is created; without them it replays everything
+* in the stream. A message is delivered up to MaxDeliver times, 5 by default, waiting
+* the Backoff schedule between attempts, and then goes to <channel>.dlq.
+**/
+type DurableOptions struct {
+	MaxDeliver int
+	Backoff    []time.Duration
+	AckWait    time.Duration
+	StartSeq   uint64
+	StartTime  time.Time
+	DeliverNew bool
+}
+
+const defaultMaxDeliver = 5
+
+var defaultBackoff = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, time.Minute}
+
+var invalidName = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+/**
+* streamName: Stream and consumer names cannot hold subject separators or wildcards.
+* @param val string
+* @return string
+**/
+func streamName(val string) string {
+	return invalidName.ReplaceAllString(val, "_")
+}
+
+/**
+* jetStream: Returns the JetStream context of the connection, creating it once.
+* @return nats.JetStreamContext, error
+**/
+func jetStream() (nats.JetStreamContext, error) {
+	if conn == nil {
+		return nil, errors.New(msg.MSG_ERR_NOT_CONNECT)
+	}
+
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if conn.js != nil {
+		return conn.js, nil
+	}
+
+	if conn.nats == nil {
+		return nil, fmt.Errorf(msg.MSG_JETSTREAM_NOT_AVAILABLE, conn.broker.Type())
+	}
+
+	js, err := conn.nats.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	conn.js = js
+
+	return js, nil
+}
+
+/**
+* Stream: Creates or updates a stream persisting the subjects.
+* @param name string, subjects []string, retention Retention
+* @return error
+**/
+func Stream(name string, subjects []string, retention Retention) error {
+	js, err := jetStream()
+	if err != nil {
+		return err
+	}
+
+	config := &nats.StreamConfig{
+		Name:      streamName(name),
+		Subjects:  subjects,
+		Retention: retention.policy(),
+		Storage:   nats.FileStorage,
+	}
+	_, err = js.StreamInfo(config.Name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(config)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	_, err = js.UpdateStream(config)
+	return err
+}
+
+/**
+* ensureStream: Makes sure channel is persisted, creating a stream for it when none covers it.
+* @param channel, prefix string, retention Retention
+* @return error
+**/
+func ensureStream(channel, prefix string, retention Retention) error {
+	js, err := jetStream()
+	if err != nil {
+		return err
+	}
+
+	_, err = js.StreamNameBySubject(channel)
+	if err == nil {
+		return nil
+	} else if !errors.Is(err, nats.ErrNoMatchingStream) {
+		return err
+	}
+
+	return Stream(prefix+"_"+channel, []string{channel}, retention)
+}
+
+/**
+* jetHandler: Decodes a JetStream delivery and hands it to f. With options a panic naks
+* it after the backoff of the attempt. On the last attempt the message goes to the
+* dead-letter channel when f panics, naks it or returns without settling it, as
+* JetStream would otherwise drop it. Without options, as in replays, a panic is only logged.
+* @param channel string, f func(Message), options *DurableOptions
+* @return nats.MsgHandler
+**/
+func jetHandler(channel string, f func(Message), options *DurableOptions) nats.MsgHandler {
+	return func(m *nats.Msg) {
+		if m == nil {
+			return
+		}
+
+		result, err := DecodeMessage(m.Data)
+		if err != nil {
+			logs.Alertf("durable channel:%s decode error:%s", channel, err.Error())
+			m.Term()
+			return
+		}
+
+		result.Myself = result.FromId == conn.id
+		result.raw = m
+
+		delivered := 1
+		if meta, err := m.Metadata(); err == nil {
+			delivered = int(meta.NumDelivered)
+		}
+		if options != nil && options.MaxDeliver > 0 && delivered >= options.MaxDeliver {
+			result.final = &settlement{channel: channel, attempts: delivered}
+		}
+
+		defer func() {
+			r := recover()
+			if r == nil {
+				if result.final != nil && !result.final.settled.Load() {
+					result.deadLetter(ErrLastDelivery)
+				}
+				return
+			}
+
+			logs.Errorf("panic in Durable channel:%s err:%v", channel, r)
+			if options == nil {
+				return
+			}
+
+			if result.final != nil {
+				result.deadLetter(fmt.Errorf("%v", r))
+				return
+			}
+
+			m.NakWithDelay(RetryPolicy{Backoff: options.Backoff}.delay(delivered))
+		}()
+
+		consume(channel+" process", result, f)
+	}
+}
+
+/**
+* Durable: Subscribes consumer to channel through JetStream, creating an interest stream
+* for channel when none covers it. Instances sharing the consumer name split the messages
+* and f must settle each one with Ack, Nak or Term; unsettled messages are redelivered
+* after AckWait or the Backoff schedule, up to MaxDeliver times. On the last delivery f
+* must settle the message before returning, otherwise it goes to <channel>.dlq.
+* @param channel, consumer string, f func(Message), opts ...DurableOptions
+* @return error
+**/
+func Durable(channel, consumer string, f func(Message), opts ...DurableOptions) error {
+	if len(channel) == 0 {
+		return errors.New(msg.MSG_ERR_CHANNEL_REQUIRED)
+	}
+
+	err := ensureStream(channel, "DURABLE", InterestRetention)
+	if err != nil {
+		return err
+	}
+
+	js, err := jetStream()
+	if err != nil {
+		return err
+	}
+
+	options := DurableOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.MaxDeliver <= 0 && len(options.Backoff) == 0 {
+		options.MaxDeliver = defaultMaxDeliver
+		options.Backoff = defaultBackoff
+	}
+
+	name := streamName(consumer)
+	subOpts := []nats.SubOpt{
+		nats.Durable(name),
+		nats.ManualAck(),
+		nats.AckExplicit(),
+	}
+	if len(options.Backoff) > 0 {
+		if options.MaxDeliver <= len(options.Backoff) {
+			options.MaxDeliver = len(options.Backoff) + 1
+		}
+		subOpts = append(subOpts, nats.BackOff(options.Backoff))
+	}
+	subOpts = append(subOpts, nats.MaxDeliver(options.MaxDeliver))
+	if options.AckWait > 0 {
+		subOpts = append(subOpts, nats.AckWait(options.AckWait))
+	}
+	switch {
+	case options.StartSeq > 0:
+		subOpts = append(subOpts, nats.StartSequence(options.StartSeq))
+	case !options.StartTime.IsZero():
+		subOpts = append(subOpts, nats.StartTime(options.StartTime))
+	case options.DeliverNew:
+		subOpts = append(subOpts, nats.DeliverNew())
+	default:
+		subOpts = append(subOpts, nats.DeliverAll())
+	}
+
+	subscribe, err := js.QueueSubscribe(channel, name, jetHandler(channel, f, &options), subOpts...)
+	if err != nil {
+		return err
+	}
+
+	conn.register(channel, subscribe)
+
+	return nil
+}
+
+/**
+* Replay: Delivers the messages stored for channel from a sequence or a time, without
+* creating a durable consumer. A zero seq and since replays the whole stream.
+* @param channel string, seq uint64, since time.Time, f func(Message)
+* @return error
+**/
+func Replay(channel string, seq uint64, since time.Time, f func(Message)) error {
+	if len(channel) == 0 {
+		return errors.New(msg.MSG_ERR_CHANNEL_REQUIRED)
+	}
+
+	js, err := jetStream()
+	if err != nil {
+		return err
+	}
+
+	subOpts := []nats.SubOpt{nats.OrderedConsumer()}
+	switch {
+	case seq > 0:
+		subOpts = append(subOpts, nats.StartSequence(seq))
+	case !since.IsZero():
+		subOpts = append(subOpts, nats.StartTime(since))
+	default:
+		subOpts = append(subOpts, nats.DeliverAll())
+	}
+
+	subscribe, err := js.Subscribe(channel, jetHandler(channel, f, nil), subOpts...)
+	if err != nil {
+		return err
+	}
+
+	conn.register(channel, subscribe)
+
+	return nil
+}
+
+/**
+* DeleteDurable: Removes a durable consumer so it can be created again from another position.
+* @param stream, consumer string
+* @return error
+**/
+func DeleteDurable(stream, consumer string) error {
+	js, err := jetStream()
+	if err != nil {
+		return err
+	}
+
+	return js.DeleteConsumer(streamName(stream), streamName(consumer))
+}
@@ -0,0 +1,152 @@
+package event
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/nats-io/nats.go"
+)
+
+func TestStreamName(t *testing.T) {
+	tests := []struct {
+		val  string
+		want string
+	}{
+		{"orders", "orders"},
+		{"orders.created", "orders_created"},
+		{"orders.*", "orders__"},
+		{"orders.>", "orders__"},
+		{"billing-worker_1", "billing-worker_1"},
+		{"a b/c", "a_b_c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			if got := streamName(tt.val); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	tests := []struct {
+		retention Retention
+		want      nats.RetentionPolicy
+	}{
+		{LimitsRetention, nats.LimitsPolicy},
+		{InterestRetention, nats.InterestPolicy},
+		{WorkQueueRetention, nats.WorkQueuePolicy},
+		{"", nats.LimitsPolicy},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.retention), func(t *testing.T) {
+			if got := tt.retention.policy(); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJetStreamWithoutNats(t *testing.T) {
+	if conn.nats != nil {
+		t.Skip("connected to NATS")
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"stream", func() error { return Stream("test", []string{"test"}, LimitsRetention) }},
+		{"durable", func() error { return Durable("test", "worker", func(Message) {}) }},
+		{"replay", func() error { return Replay("test", 0, time.Time{}, func(Message) {}) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); err == nil {
+				t.Fatal("expected an error on the memory broker")
+			}
+		})
+	}
+
+	/* Settling a core message is a no-op */
+	m := NewEvenMessage("test", et.Json{})
+	for _, err := range []error{m.Ack(), m.Nak(0), m.Term(), m.InProgress()} {
+		if err != nil {
+			t.Fatalf("settling a core message: %v", err)
+		}
+	}
+}
+
+/**
+* testDelivery: Builds the JetStream delivery number delivered of a message on channel,
+* bound to a subscription without connection so its acks are dropped.
+* @param t *testing.T, channel string, delivered int
+* @return *nats.Msg
+**/
+func testDelivery(t *testing.T, channel string, delivered int) *nats.Msg {
+	t.Helper()
+	data, err := NewEvenMessage(channel, et.Json{"n": 1}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &nats.Msg{
+		Subject: channel,
+		Reply:   fmt.Sprintf("$JS.ACK.DURABLE_%s.test.%d.1.1.%d.0", channel, delivered, time.Now().UnixNano()),
+		Data:    data,
+		Sub:     &nats.Subscription{},
+	}
+}
+
+func TestJetHandlerLastDelivery(t *testing.T) {
+	tests := []struct {
+		name      string
+		delivered int
+		handler   func(Message)
+		dead      bool
+	}{
+		{name: "ack on the last delivery", delivered: 3, handler: func(m Message) { m.Ack() }},
+		{name: "term on the last delivery", delivered: 3, handler: func(m Message) { m.Term() }},
+		{name: "nak on the last delivery", delivered: 3, handler: func(m Message) { m.Nak(0) }, dead: true},
+		{name: "unsettled last delivery", delivered: 3, handler: func(m Message) {}, dead: true},
+		{name: "panic on the last delivery", delivered: 3, handler: func(m Message) { panic("failed") }, dead: true},
+		{name: "nak before the last delivery", delivered: 2, handler: func(m Message) { m.Nak(0) }},
+		{name: "panic before the last delivery", delivered: 2, handler: func(m Message) { panic("failed") }},
+		{name: "unsettled before the last delivery", delivered: 1, handler: func(m Message) {}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := fmt.Sprintf("test-%d", time.Now().UnixNano())
+			letters := make(chan Message, 2)
+			if err := Subscribe(channel+DLQ_SUFFIX, func(m Message) { letters <- m }); err != nil {
+				t.Fatal(err)
+			}
+			defer Unsubscribe(channel + DLQ_SUFFIX)
+
+			handler := jetHandler(channel, tt.handler, &DurableOptions{MaxDeliver: 3})
+			handler(testDelivery(t, channel, tt.delivered))
+
+			select {
+			case letter := <-letters:
+				if !tt.dead {
+					t.Fatalf("dead-lettered %v", letter.Data)
+				}
+				if letter.Data.Int("attempts") != tt.delivered || letter.Data.Str("channel") != channel {
+					t.Fatalf("letter = %v", letter.Data)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.dead {
+					t.Fatal("message was not dead-lettered")
+				}
+			}
+
+			select {
+			case letter := <-letters:
+				t.Fatalf("dead-lettered twice: %v", letter.Data)
+			default:
+			}
+		})
+	}
+}
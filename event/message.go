@@ -1,21 +1,43 @@
 package event
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/cgalvisleon/et/et"
 	"github.com/cgalvisleon/et/reg"
 	"github.com/cgalvisleon/et/timezone"
+	"github.com/cgalvisleon/et/trace"
+	"github.com/nats-io/nats.go"
 )
 
 type Message struct {
-	CreatedAt time.Time `json:"created_at"`
-	FromId    string    `json:"from_id"`
-	Id        string    `json:"id"`
-	Channel   string    `json:"channel"`
-	Data      et.Json   `json:"data"`
-	Myself    bool      `json:"myself"`
+	CreatedAt time.Time    `json:"created_at"`
+	FromId    string       `json:"from_id"`
+	Id        string       `json:"id"`
+	Channel   string       `json:"channel"`
+	Schema    string       `json:"schema,omitempty"`
+	Version   int          `json:"version,omitempty"`
+	Trace     string       `json:"traceparent,omitempty"`
+	Data      et.Json      `json:"data"`
+	Myself    bool         `json:"myself"`
+	Error     *RemoteError `json:"error,omitempty"`
+	raw       *nats.Msg
+	span      trace.Span
+	final     *settlement
+}
+
+/**
+* settlement: Last allowed delivery of a durable message, which is dead-lettered
+* instead of being redelivered or dropped.
+**/
+type settlement struct {
+	channel  string
+	attempts int
+	settled  atomic.Bool
 }
 
 /**
@@ -35,6 +57,56 @@ func NewEvenMessage(channel string, data et.Json) Message {
 	}
 }
 
+/**
+* WithTrace: Sets the traceparent of the span in ctx, if any.
+* @param ctx context.Context
+* @return Message
+**/
+func (m Message) WithTrace(ctx context.Context) Message {
+	m.Trace = trace.Traceparent(ctx)
+	return m
+}
+
+/**
+* Context: Returns a context holding the span of the handler, child of the
+* span that published the message or a new trace when it carries none.
+* @return context.Context
+**/
+func (m Message) Context() context.Context {
+	span := m.span
+	if !span.IsValid() {
+		span = trace.FromParent(m.Trace)
+	}
+
+	return trace.WithContext(context.Background(), span)
+}
+
+/**
+* consume: Runs f on m as a consumer span of the span that published m. Every
+* attempt gets its own span, untraced messages run f as is.
+* @param name string, m Message, f func(Message)
+**/
+func consume(name string, m Message, f func(Message)) {
+	parent, ok := trace.Parse(m.Trace)
+	if !ok {
+		f(m)
+		return
+	}
+
+	m.span = parent.Child()
+	record := trace.Begin(m.span, name, trace.KindConsumer)
+	record.Set("messaging.system", Type()).Set("messaging.destination.name", m.Channel)
+	defer func() {
+		if r := recover(); r != nil {
+			record.Error(fmt.Errorf("%v", r)).Finish()
+			panic(r)
+		}
+		record.Finish()
+	}()
+
+	f(m)
+}
+
 /**
 * Encode
 * @return []byte, error
@@ -104,6 +176,104 @@ func DecodeMessage(data []byte) (Message, error) {
 	if err != nil {
 		return Message{}, err
 	}
+	m.span = trace.FromParent(m.Trace)
 
 	return m, nil
 }
+
+/**
+* Ack: Confirms a JetStream delivery, it does nothing for core NATS messages.
+* @return error
+**/
+func (s Message) Ack() error {
+	if s.final != nil {
+		s.final.settled.Store(true)
+	}
+
+	if s.raw == nil || s.raw.Reply == "" {
+		return nil
+	}
+
+	return s.raw.Ack()
+}
+
+/**
+* Nak: Asks JetStream to redeliver the message after delay, zero uses the consumer backoff.
+* On the last delivery the message goes to the dead-letter channel instead.
+* @param delay time.Duration
+* @return error
+**/
+func (s Message) Nak(delay time.Duration) error {
+	if s.final != nil {
+		return s.deadLetter(ErrLastDelivery)
+	}
+
+	if s.raw == nil || s.raw.Reply == "" {
+		return nil
+	}
+
+	if delay > 0 {
+		return s.raw.NakWithDelay(delay)
+	}
+
+	return s.raw.Nak()
+}
+
+/**
+* Term: Tells JetStream to stop redelivering the message.
+* @return error
+**/
+func (s Message) Term() error {
+	if s.final != nil {
+		s.final.settled.Store(true)
+	}
+
+	if s.raw == nil || s.raw.Reply == "" {
+		return nil
+	}
+
+	return s.raw.Term()
+}
+
+/**
+* deadLetter: Sends a message on its last delivery to the dead-letter channel and
+* terminates it.
+* @param err error
+* @return error
+**/
+func (s Message) deadLetter(err error) error {
+	if !s.final.settled.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	deadLetter(s.final.channel, s, err, s.final.attempts)
+	if s.raw == nil || s.raw.Reply == "" {
+		return nil
+	}
+
+	return s.raw.Term()
+}
+
+/**
+* InProgress: Resets the ack timer of a long running delivery.
+* @return error
+**/
+func (s Message) InProgress() error {
+	if s.raw == nil || s.raw.Reply == "" {
+		return nil
+	}
+
+	return s.raw.InProgress()
+}
+
+/**
+* Metadata: Stream sequence, delivery count and timestamp of a JetStream delivery.
+* @return *nats.MsgMetadata, error
+**/
+func (s Message) Metadata() (*nats.MsgMetadata, error) {
+	if s.raw == nil {
+		return nil, nats.ErrNotJSMessage
+	}
+
+	return s.raw.Metadata()
+}
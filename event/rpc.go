@@ -0,0 +1,280 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/msg"
+	"github.com/cgalvisleon/et/trace"
+)
+
+// RequestTimeout bounds a request whose context has no deadline.
+var RequestTimeout = 10 * time.Second
+
+/**
+* RemoteError: Error returned by a Reply handler, carried in the reply envelope.
+**/
+type RemoteError struct {
+	Code    string  `json:"code"`
+	Message string  `json:"message"`
+	Data    et.Json `json:"data,omitempty"`
+}
+
+/**
+* NewRemoteError
+* @param code, message string, data et.Json
+* @return *RemoteError
+**/
+func NewRemoteError(code, message string, data et.Json) *RemoteError {
+	return &RemoteError{
+		Code:    code,
+		Message: message,
+		Data:    data,
+	}
+}
+
+/**
+* Error
+* @return string
+**/
+func (s *RemoteError) Error() string {
+	return fmt.Sprintf("%s: %s", s.Code, s.Message)
+}
+
+/**
+* toRemoteError
+* @param err error
+* @return *RemoteError
+**/
+func toRemoteError(err error) *RemoteError {
+	var result *RemoteError
+	if errors.As(err, &result) {
+		return result
+	}
+
+	return NewRemoteError("error", err.Error(), nil)
+}
+
+/**
+* withTimeout: Applies RequestTimeout when ctx has no deadline.
+* @param ctx context.Context
+* @return context.Context, context.CancelFunc
+**/
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, RequestTimeout)
+}
+
+/**
+* Request: Publishes data on channel and waits for the first reply.
+* An error answered by the handler is returned as *RemoteError along with the reply.
+* @param ctx context.Context, channel string, data et.Json
+* @return Message, error
+**/
+func Request(ctx context.Context, channel string, data et.Json) (Message, error) {
+	if conn == nil {
+		return Message{}, errors.New(msg.MSG_ERR_NOT_CONNECT)
+	}
+
+	if len(channel) == 0 {
+		return Message{}, errors.New(msg.MSG_ERR_CHANNEL_REQUIRED)
+	}
+
+	ctx, record := trace.Start(ctx, channel+" request", trace.KindClient)
+	record.Set("messaging.system", Type()).Set("messaging.destination.name", channel)
+	defer record.Finish()
+
+	message := NewEvenMessage(channel, data).WithTrace(ctx)
+	message.FromId = conn.id
+	dt, err := message.Encode()
+	if err != nil {
+		return Message{}, err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	m, err := conn.broker.Request(ctx, channel, dt)
+	if err != nil {
+		record.Error(err)
+		return Message{}, err
+	}
+
+	result, err := DecodeMessage(m.Data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	result.Myself = result.FromId == conn.id
+	if result.Error != nil {
+		record.Error(result.Error)
+		return result, result.Error
+	}
+
+	return result, nil
+}
+
+/**
+* RequestMany: Publishes data on channel and collects up to n replies before the deadline,
+* n <= 0 collects every reply until the deadline. Replies holding an error are included.
+* The replicas must answer with ReplyAll, Reply answers once per request.
+* @param ctx context.Context, channel string, data et.Json, n int
+* @return []Message, error
+**/
+func RequestMany(ctx context.Context, channel string, data et.Json, n int) ([]Message, error) {
+	if conn == nil {
+		return nil, errors.New(msg.MSG_ERR_NOT_CONNECT)
+	}
+
+	if len(channel) == 0 {
+		return nil, errors.New(msg.MSG_ERR_CHANNEL_REQUIRED)
+	}
+
+	message := NewEvenMessage(channel, data).WithTrace(ctx)
+	message.FromId = conn.id
+	dt, err := message.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	replies := make(chan *Msg, max(n, 64))
+	inbox := conn.broker.NewInbox()
+	sub, err := conn.broker.Subscribe(inbox, func(m *Msg) {
+		select {
+		case replies <- m:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+
+	err = conn.broker.PublishRequest(channel, inbox, dt)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Message{}
+	for n <= 0 || len(result) < n {
+		var m *Msg
+		select {
+		case m = <-replies:
+		case <-ctx.Done():
+			if len(result) > 0 {
+				return result, nil
+			}
+			return result, ctx.Err()
+		}
+
+		reply, err := DecodeMessage(m.Data)
+		if err != nil {
+			logs.Alertf("request many channel:%s decode error:%s", channel, err.Error())
+			continue
+		}
+
+		reply.Myself = reply.FromId == conn.id
+		result = append(result, reply)
+	}
+
+	return result, nil
+}
+
+/**
+* Reply: Answers the requests published on channel with the result of f. Replicas
+* replying on the same channel form a queue group, so each request is answered once.
+* An error from f, or a panic, is sent back as a RemoteError.
+* @param channel string, f func(Message) (et.Json, error)
+* @return error
+**/
+func Reply(channel string, f func(Message) (et.Json, error)) error {
+	return reply(channel, channel, f)
+}
+
+/**
+* ReplyAll: Answers every request published on channel from each replica, for the
+* scatter-gather of RequestMany.
+* @param channel string, f func(Message) (et.Json, error)
+* @return error
+**/
+func ReplyAll(channel string, f func(Message) (et.Json, error)) error {
+	return reply(channel, "", f)
+}
+
+/**
+* respond: Sends data, or err as a RemoteError, back to the requester of m.
+* @param m *Msg, channel string, request Message, data et.Json, err error
+**/
+func respond(m *Msg, channel string, request Message, data et.Json, err error) {
+	reply := NewEvenMessage(m.Reply, data)
+	reply.FromId = conn.id
+	reply.Trace = request.Trace
+	if err != nil {
+		reply.Error = toRemoteError(err)
+	}
+
+	dt, err := reply.Encode()
+	if err != nil {
+		logs.Alertf("reply channel:%s encode error:%s", channel, err.Error())
+		return
+	}
+
+	if err := m.Respond(dt); err != nil {
+		logs.Alertf("reply channel:%s respond error:%s", channel, err.Error())
+	}
+}
+
+/**
+* reply: Subscribes f on channel, in queue when given, answering each request.
+* @param channel, queue string, f func(Message) (et.Json, error)
+* @return error
+**/
+func reply(channel, queue string, f func(Message) (et.Json, error)) error {
+	if conn == nil {
+		return errors.New(msg.MSG_ERR_NOT_CONNECT)
+	}
+
+	if len(channel) == 0 {
+		return errors.New(msg.MSG_ERR_CHANNEL_REQUIRED)
+	}
+
+	return conn.subscribe(channel, queue, func(m *Msg) {
+		if m.Reply == "" {
+			return
+		}
+
+		request, err := DecodeMessage(m.Data)
+		if err != nil {
+			/* The requester learns the request was unreadable instead of waiting for the deadline */
+			respond(m, channel, Message{}, nil, NewRemoteError("decode", err.Error(), nil))
+			return
+		}
+		request.Myself = request.FromId == conn.id
+
+		record := trace.Begin(request.span, channel+" reply", trace.KindServer)
+		record.Set("messaging.system", Type()).Set("messaging.destination.name", channel)
+		data, rErr := func() (result et.Json, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					logs.ErrorCtx(request.Context(), fmt.Errorf("panic in Reply channel:%s err:%v", channel, r))
+					err = NewRemoteError("panic", fmt.Sprint(r), nil)
+				}
+			}()
+
+			return f(request)
+		}()
+		record.Error(rErr).Finish()
+
+		respond(m, channel, request, data, rErr)
+	})
+}
@@ -0,0 +1,121 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+)
+
+func TestRequestReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(Message) (et.Json, error)
+		result  string
+		code    string
+	}{
+		{
+			name:    "answer",
+			handler: func(m Message) (et.Json, error) { return et.Json{"echo": m.Data.Str("name")}, nil },
+			result:  "a",
+		},
+		{
+			name:    "plain error",
+			handler: func(m Message) (et.Json, error) { return nil, errors.New("failed") },
+			code:    "error",
+		},
+		{
+			name:    "remote error",
+			handler: func(m Message) (et.Json, error) { return nil, NewRemoteError("not_found", "missing", nil) },
+			code:    "not_found",
+		},
+		{
+			name:    "panic",
+			handler: func(m Message) (et.Json, error) { panic("boom") },
+			code:    "panic",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := fmt.Sprintf("test-rpc-%d", time.Now().UnixNano())
+			if err := Reply(channel, tt.handler); err != nil {
+				t.Fatal(err)
+			}
+			defer Unsubscribe(channel)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			result, err := Request(ctx, channel, et.Json{"name": "a"})
+			if tt.code == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := result.Data.Str("echo"); got != tt.result {
+					t.Fatalf("echo = %q, want %q", got, tt.result)
+				}
+				return
+			}
+
+			var remote *RemoteError
+			if !errors.As(err, &remote) {
+				t.Fatalf("err = %v, want a RemoteError", err)
+			}
+			if remote.Code != tt.code {
+				t.Fatalf("code = %q, want %q", remote.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestRequestMany(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   func(channel string, f func(Message) (et.Json, error)) error
+		replies int
+	}{
+		{name: "queue group answers once", reply: Reply, replies: 1},
+		{name: "every replica answers", reply: ReplyAll, replies: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := fmt.Sprintf("test-many-%d", time.Now().UnixNano())
+			for i := 0; i < 3; i++ {
+				replica := i
+				err := tt.reply(channel, func(m Message) (et.Json, error) {
+					return et.Json{"replica": replica}, nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			defer Unsubscribe(channel)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			replies, err := RequestMany(ctx, channel, et.Json{}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(replies) != tt.replies {
+				t.Fatalf("got %d replies, want %d", len(replies), tt.replies)
+			}
+		})
+	}
+}
+
+func TestRequestWithoutResponders(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := Request(ctx, fmt.Sprintf("test-none-%d", time.Now().UnixNano()), et.Json{})
+	if err == nil {
+		t.Fatal("expected an error without responders")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("request waited %s", time.Since(start))
+	}
+}
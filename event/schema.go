@@ -0,0 +1,263 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/jval"
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/msg"
+)
+
+/**
+* Converter: Rewrites the payload of one schema version into the next one.
+**/
+type Converter func(data et.Json) (et.Json, error)
+
+/**
+* Schema: Typed publisher and subscriber of a channel. Messages carry the schema
+* name and version in the envelope; handlers receive other versions converted
+* through the registered upcasters and downcasters. Configure it before subscribing.
+**/
+type Schema[T any] struct {
+	Channel     string
+	Name        string
+	Version     int
+	rules       []jval.Rule
+	upcasters   map[int]Converter
+	downcasters map[int]Converter
+}
+
+/**
+* Define: The schema is named after the channel, so producers and consumers in other
+* services share it whatever Go type they decode into.
+* @param channel string, version int
+* @return *Schema[T]
+**/
+func Define[T any](channel string, version int) *Schema[T] {
+	return &Schema[T]{
+		Channel:     channel,
+		Name:        channel,
+		Version:     max(version, 1),
+		rules:       []jval.Rule{},
+		upcasters:   map[int]Converter{},
+		downcasters: map[int]Converter{},
+	}
+}
+
+/**
+* Named: Sets the schema name carried in the envelope, for channels holding several schemas.
+* @param name string
+* @return *Schema[T]
+**/
+func (s *Schema[T]) Named(name string) *Schema[T] {
+	if name != "" {
+		s.Name = name
+	}
+	return s
+}
+
+/**
+* Rules: Validates the payloads published and received with rules.
+* @param rules ...jval.Rule
+* @return *Schema[T]
+**/
+func (s *Schema[T]) Rules(rules ...jval.Rule) *Schema[T] {
+	s.rules = append(s.rules, rules...)
+	return s
+}
+
+/**
+* Upcast: Registers the conversion of version from into version from+1.
+* @param from int, f Converter
+* @return *Schema[T]
+**/
+func (s *Schema[T]) Upcast(from int, f Converter) *Schema[T] {
+	s.upcasters[from] = f
+	return s
+}
+
+/**
+* Downcast: Registers the conversion of version from into version from-1.
+* @param from int, f Converter
+* @return *Schema[T]
+**/
+func (s *Schema[T]) Downcast(from int, f Converter) *Schema[T] {
+	s.downcasters[from] = f
+	return s
+}
+
+/**
+* convert: Walks data from version from to the schema version.
+* @param data et.Json, from int
+* @return et.Json, error
+**/
+func (s *Schema[T]) convert(data et.Json, from int) (et.Json, error) {
+	var err error
+	for v := from; v != s.Version; {
+		var f Converter
+		var ok bool
+		next := v + 1
+		if v < s.Version {
+			f, ok = s.upcasters[v]
+		} else {
+			next = v - 1
+			f, ok = s.downcasters[v]
+		}
+		if !ok {
+			return nil, fmt.Errorf(msg.MSG_SCHEMA_NO_CONVERTER, s.Name, v, next)
+		}
+
+		data, err = f(data)
+		if err != nil {
+			return nil, err
+		}
+		v = next
+	}
+
+	return data, nil
+}
+
+/**
+* validate
+* @param data et.Json
+* @return error
+**/
+func (s *Schema[T]) validate(data et.Json) error {
+	if len(s.rules) == 0 {
+		return nil
+	}
+
+	return jval.Require(data, s.rules...)
+}
+
+/**
+* Encode: Validates data and builds its versioned envelope.
+* @param data T
+* @return Message, error
+**/
+func (s *Schema[T]) Encode(data T) (Message, error) {
+	bt, err := json.Marshal(data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	payload := et.Json{}
+	err = json.Unmarshal(bt, &payload)
+	if err != nil {
+		return Message{}, err
+	}
+
+	err = s.validate(payload)
+	if err != nil {
+		return Message{}, err
+	}
+
+	result := NewEvenMessage(s.Channel, payload)
+	result.Schema = s.Name
+	result.Version = s.Version
+	return result, nil
+}
+
+/**
+* Decode: Converts the payload of m to the schema version, validates it and unmarshals it.
+* Messages of another schema are rejected; messages without schema are taken as this
+* one and messages without version as version 1.
+* @param m Message
+* @return T, error
+**/
+func (s *Schema[T]) Decode(m Message) (T, error) {
+	var result T
+	if m.Schema != "" && m.Schema != s.Name {
+		return result, fmt.Errorf(msg.MSG_SCHEMA_MISMATCH, s.Name, m.Schema)
+	}
+
+	data, err := s.convert(m.Data, max(m.Version, 1))
+	if err != nil {
+		return result, err
+	}
+
+	err = s.validate(data)
+	if err != nil {
+		return result, err
+	}
+
+	bt, err := json.Marshal(data)
+	if err != nil {
+		return result, err
+	}
+
+	err = json.Unmarshal(bt, &result)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+/**
+* Publish
+* @param data T
+* @return error
+**/
+func (s *Schema[T]) Publish(data T) error {
+	message, err := s.Encode(data)
+	if err != nil {
+		return err
+	}
+
+	return publishMessage(message)
+}
+
+/**
+* PublishContext: Publish carrying the traceparent of ctx.
+* @param ctx context.Context, data T
+* @return error
+**/
+func (s *Schema[T]) PublishContext(ctx context.Context, data T) error {
+	message, err := s.Encode(data)
+	if err != nil {
+		return err
+	}
+
+	return publishContext(ctx, message)
+}
+
+/**
+* Handler: Adapts f to func(Message). A message that can not be decoded is sent
+* to <channel>.dlq instead of reaching f.
+* @param f func(T, Message)
+* @return func(Message)
+**/
+func (s *Schema[T]) Handler(f func(T, Message)) func(Message) {
+	return func(m Message) {
+		data, err := s.Decode(m)
+		if err != nil {
+			logs.Alertf("schema:%s v%d channel:%s message v%d rejected:%s", s.Name, s.Version, s.Channel, m.Version, err.Error())
+			deadLetter(s.Channel, m, err, 0)
+			return
+		}
+
+		f(data, m)
+	}
+}
+
+/**
+* Subscribe
+* @param f func(T, Message), opts ...RetryPolicy
+* @return error
+**/
+func (s *Schema[T]) Subscribe(f func(T, Message), opts ...RetryPolicy) error {
+	return Subscribe(s.Channel, s.Handler(f), opts...)
+}
+
+/**
+* Queue
+* @param queue string, f func(T, Message), opts ...RetryPolicy
+* @return error
+**/
+func (s *Schema[T]) Queue(queue string, f func(T, Message), opts ...RetryPolicy) error {
+	return Queue(s.Channel, queue, s.Handler(f), opts...)
+}
@@ -0,0 +1,168 @@
+package event
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/jval"
+)
+
+type orderV1 struct {
+	Name string `json:"name"`
+}
+
+type orderV2 struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+/**
+* orderSchema: Version 2 of the orders schema, which split name in two.
+* @return *Schema[orderV2]
+**/
+func orderSchema() *Schema[orderV2] {
+	return Define[orderV2]("orders", 2).
+		Rules(jval.Str("first_name").NotEmpty()).
+		Upcast(1, func(data et.Json) (et.Json, error) {
+			return et.Json{"first_name": data.Str("name"), "last_name": ""}, nil
+		}).
+		Downcast(3, func(data et.Json) (et.Json, error) {
+			name := data.Json("name")
+			return et.Json{"first_name": name.Str("first"), "last_name": name.Str("last")}, nil
+		})
+}
+
+func TestSchemaDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+		first   string
+		last    string
+		fails   bool
+	}{
+		{
+			name:    "same version",
+			message: Message{Schema: "orders", Version: 2, Data: et.Json{"first_name": "Ada", "last_name": "Lovelace"}},
+			first:   "Ada", last: "Lovelace",
+		},
+		{
+			name:    "upcast from version 1",
+			message: Message{Schema: "orders", Version: 1, Data: et.Json{"name": "Ada"}},
+			first:   "Ada",
+		},
+		{
+			name:    "message without version is version 1",
+			message: Message{Schema: "orders", Data: et.Json{"name": "Ada"}},
+			first:   "Ada",
+		},
+		{
+			name:    "message without schema",
+			message: Message{Version: 2, Data: et.Json{"first_name": "Ada"}},
+			first:   "Ada",
+		},
+		{
+			name:    "downcast from version 3",
+			message: Message{Schema: "orders", Version: 3, Data: et.Json{"name": et.Json{"first": "Ada", "last": "Lovelace"}}},
+			first:   "Ada", last: "Lovelace",
+		},
+		{
+			name:    "no converter from version 4",
+			message: Message{Schema: "orders", Version: 4, Data: et.Json{}},
+			fails:   true,
+		},
+		{
+			name:    "another schema",
+			message: Message{Schema: "invoices", Version: 2, Data: et.Json{"first_name": "Ada"}},
+			fails:   true,
+		},
+		{
+			name:    "invalid payload",
+			message: Message{Schema: "orders", Version: 2, Data: et.Json{"first_name": ""}},
+			fails:   true,
+		},
+	}
+	schema := orderSchema()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := schema.Decode(tt.message)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("decoded %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.FirstName != tt.first || got.LastName != tt.last {
+				t.Fatalf("got %+v, want %s %s", got, tt.first, tt.last)
+			}
+		})
+	}
+}
+
+func TestSchemaAcrossServices(t *testing.T) {
+	/* Producer and consumer decode into different Go types */
+	producer := Define[orderV1]("orders", 1)
+	consumer := orderSchema()
+
+	message, err := producer.Encode(orderV1{Name: "Ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Schema != "orders" || message.Version != 1 {
+		t.Fatalf("envelope schema:%s v%d", message.Schema, message.Version)
+	}
+
+	got, err := consumer.Decode(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FirstName != "Ada" {
+		t.Fatalf("got %+v", got)
+	}
+
+	named := Define[orderV2]("orders", 2).Named("orders.v2")
+	if _, err := named.Decode(message); err == nil {
+		t.Fatal("a named schema decoded a message of another schema")
+	}
+}
+
+func TestSchemaEncode(t *testing.T) {
+	schema := orderSchema()
+	if _, err := schema.Encode(orderV2{}); err == nil {
+		t.Fatal("encoded an invalid payload")
+	}
+
+	message, err := schema.Encode(orderV2{FirstName: "Ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Channel != "orders" || message.Data.Str("first_name") != "Ada" {
+		t.Fatalf("message = %+v", message)
+	}
+}
+
+func TestSchemaHandler(t *testing.T) {
+	channel := fmt.Sprintf("test-schema-%d", time.Now().UnixNano())
+	schema := Define[orderV2](channel, 2).Rules(jval.Str("first_name").NotEmpty())
+	letters := make(chan Message, 1)
+	Subscribe(channel+DLQ_SUFFIX, func(m Message) { letters <- m })
+	defer Unsubscribe(channel + DLQ_SUFFIX)
+
+	calls := 0
+	handler := schema.Handler(func(data orderV2, m Message) { calls++ })
+	handler(Message{Channel: channel, Schema: channel, Version: 2, Data: et.Json{"first_name": "Ada"}})
+	handler(Message{Channel: channel, Schema: channel, Version: 2, Data: et.Json{}})
+
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls)
+	}
+	select {
+	case <-letters:
+	case <-time.After(time.Second):
+		t.Fatal("invalid message was not dead-lettered")
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 var (
 	ErrorRpcNotConnected = errors.New("rpc not connected")
+	ErrorSolverNotFound  = errors.New("solver not found")
 	pkg                  *Package
 )
 
@@ -20,9 +21,13 @@ var (
 * @return (*Solver, error)
 **/
 func GetSolver(method string) (*Solver, error) {
+	if pkg == nil {
+		return nil, ErrorSolverNotFound
+	}
+
 	solver, ok := pkg.Solvers[method]
 	if !ok {
-		return nil, errors.New("solver not found")
+		return nil, ErrorSolverNotFound
 	}
 	return solver, nil
 }
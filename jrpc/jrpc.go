@@ -1,6 +1,7 @@
 package jrpc
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
 	"net"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/cgalvisleon/et/et"
 	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/trace"
 )
 
 var (
@@ -22,6 +24,7 @@ func init() {
 	os = runtime.GOOS
 	rpcs = make(map[string]et.Json)
 	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
 	gob.Register(et.Json{})
 	gob.Register(et.Item{})
 	gob.Register(et.Items{})
@@ -199,3 +202,31 @@ func CallItem(method string, args et.Json) (et.Item, error) {
 
 	return reply, nil
 }
+
+/**
+* WithTrace: Adds the traceparent of ctx to the args of a call.
+* @param ctx context.Context, args et.Json
+* @return et.Json
+**/
+func WithTrace(ctx context.Context, args et.Json) et.Json {
+	traceparent := trace.Traceparent(ctx)
+	if traceparent == "" {
+		return args
+	}
+
+	if args == nil {
+		args = et.Json{}
+	}
+	args[trace.HEADER] = traceparent
+	return args
+}
+
+/**
+* Context: Returns a context holding the span of the procedure, child of the
+* span that sent args or a new trace when they carry none.
+* @param args et.Json
+* @return context.Context
+**/
+func Context(args et.Json) context.Context {
+	return trace.WithContext(context.Background(), trace.FromParent(args.Str(trace.HEADER)))
+}
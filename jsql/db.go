@@ -10,6 +10,7 @@ import (
 
 	"github.com/cgalvisleon/et/et"
 	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/trace"
 	"github.com/cgalvisleon/et/utility"
 )
 
@@ -309,10 +310,27 @@ func (s *DB) GetModel(schema string, name string) (*Model, error) {
 * @return et.Items, error
 **/
 func (s *DB) SqlTx(tx *Tx, query string, arg ...any) (et.Items, error) {
+	return s.SqlTxCtx(context.Background(), tx, query, arg...)
+}
+
+/**
+* SqlTxCtx: SqlTx recorded as a client span child of the span in ctx.
+* @param ctx context.Context
+* @param tx *Tx
+* @param query string
+* @param arg ...any
+* @return et.Items, error
+**/
+func (s *DB) SqlTxCtx(ctx context.Context, tx *Tx, query string, arg ...any) (et.Items, error) {
 	query = SQLParse(query, arg...)
+	ctx, record := trace.Start(ctx, s.Driver+" "+s.Name, trace.KindClient)
+	record.Set("db.system", s.Driver).Set("db.namespace", s.Name).Set("db.query.text", query)
+	defer record.Finish()
+
 	if tx != nil {
 		rows, err := tx.Query(s.db, query)
 		if err != nil {
+			record.Error(err)
 			return et.Items{}, err
 		}
 
@@ -320,8 +338,9 @@ func (s *DB) SqlTx(tx *Tx, query string, arg ...any) (et.Items, error) {
 		return result, nil
 	}
 
-	rows, err := s.db.Query(query)
+	rows, err := s.db.QueryContext(ctx, query)
 	if err != nil {
+		record.Error(err)
 		return et.Items{}, err
 	}
 
@@ -339,6 +358,17 @@ func (s *DB) Sql(query string, args ...any) (et.Items, error) {
 	return s.SqlTx(nil, query, args...)
 }
 
+/**
+* SqlCtx: Sql recorded as a client span child of the span in ctx.
+* @param ctx context.Context
+* @param query string
+* @param args ...any
+* @return et.Items, error
+**/
+func (s *DB) SqlCtx(ctx context.Context, query string, args ...any) (et.Items, error) {
+	return s.SqlTxCtx(ctx, nil, query, args...)
+}
+
 /**
 * Define: Creates a model from a declarative definition (delegates to DefineModel).
 * @param definition Def
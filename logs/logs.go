@@ -1,12 +1,14 @@
 package logs
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/cgalvisleon/et/stdrout"
+	"github.com/cgalvisleon/et/trace"
 )
 
 /**
@@ -256,3 +258,74 @@ func Rpc(args ...any) error {
 
 	return nil
 }
+
+/**
+* traceTag: Returns the trace and span of ctx as a log prefix.
+* @param ctx context.Context
+* @return string
+**/
+func traceTag(ctx context.Context) string {
+	span, ok := trace.FromContext(ctx)
+	if !ok || !span.IsValid() {
+		return ""
+	}
+
+	return fmt.Sprintf("[trace:%s span:%s] ", span.TraceId, span.SpanId)
+}
+
+/**
+* withTrace: Prepends the trace tag of ctx to args.
+* @param ctx context.Context, args []any
+* @return []any
+**/
+func withTrace(ctx context.Context, args []any) []any {
+	tag := traceTag(ctx)
+	if tag == "" {
+		return args
+	}
+
+	return append([]any{tag}, args...)
+}
+
+/**
+* LogCtx: Log including the trace of ctx.
+* @param ctx context.Context, kind string, args ...any
+* @return error
+**/
+func LogCtx(ctx context.Context, kind string, args ...any) error {
+	return Log(kind, withTrace(ctx, args)...)
+}
+
+/**
+* InfoCtx: Info including the trace of ctx.
+* @param ctx context.Context, v ...any
+**/
+func InfoCtx(ctx context.Context, v ...any) {
+	Info(withTrace(ctx, v)...)
+}
+
+/**
+* AlertCtx: Alert including the trace of ctx.
+* @param ctx context.Context, err error
+* @return error
+**/
+func AlertCtx(ctx context.Context, err error) error {
+	if err != nil {
+		printLn("Alert", "Yellow", withTrace(ctx, []any{err.Error()})...)
+	}
+
+	return err
+}
+
+/**
+* ErrorCtx: Error including the trace of ctx.
+* @param ctx context.Context, err error
+* @return error
+**/
+func ErrorCtx(ctx context.Context, err error) error {
+	if err != nil {
+		printLn("Error", "Red", withTrace(ctx, []any{err.Error()})...)
+	}
+
+	return err
+}
@@ -1,6 +1,7 @@
 package mem
 
 import (
+	"container/list"
 	"encoding/json"
 	"time"
 
@@ -8,34 +9,58 @@ import (
 	"github.com/cgalvisleon/et/timezone"
 )
 
+// entryOverhead approximates the bytes held by an Entry besides its key and value.
+const entryOverhead = 96
+
 type Entry struct {
 	Key        string
 	Value      []byte
 	Version    int
 	LastUpdate time.Time
 	Expiration time.Duration
-	timer      *time.Timer
+	ExpiresAt  time.Time
+	size       int64
+	elem       *list.Element
+	list       int
+	freq       int
+	tick       uint64
+	index      int
 }
 
 /**
-* New create new item
+* NewEntry create new item
 * @param key string
 * @param value interface{}
 * @return *Entry
 **/
-func New(key string, value interface{}, expiration time.Duration) (*Entry, error) {
-	now := timezone.Now()
-	bt, err := json.Marshal(value)
-	if err != nil {
+func NewEntry(key string, value interface{}, expiration time.Duration) (*Entry, error) {
+	result := &Entry{
+		Key:   key,
+		index: -1,
+	}
+	if _, err := result.Set(value, expiration); err != nil {
 		return nil, err
 	}
+	result.Version = 0
 
-	return &Entry{
-		LastUpdate: now,
-		Expiration: expiration,
-		Key:        key,
-		Value:      bt,
-	}, nil
+	return result, nil
+}
+
+/**
+* Size return the approximate memory held by the item
+* @return int64
+**/
+func (s *Entry) Size() int64 {
+	return s.size
+}
+
+/**
+* IsExpired
+* @param now time.Time
+* @return bool
+**/
+func (s *Entry) IsExpired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt)
 }
 
 /**
@@ -55,7 +80,12 @@ func (s *Entry) Set(value interface{}, expiration time.Duration) (*Entry, error)
 
 	s.LastUpdate = timezone.Now()
 	s.Expiration = expiration
+	s.ExpiresAt = time.Time{}
+	if expiration > 0 {
+		s.ExpiresAt = s.LastUpdate.Add(expiration)
+	}
 	s.Value = bt
+	s.size = int64(len(s.Key)+len(s.Value)) + entryOverhead
 	s.Version++
 
 	return s, nil
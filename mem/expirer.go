@@ -0,0 +1,166 @@
+package mem
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/cgalvisleon/et/timezone"
+)
+
+type deadline struct {
+	key   string
+	at    time.Time
+	index int
+}
+
+type deadlines []*deadline
+
+func (h deadlines) Len() int           { return len(h) }
+func (h deadlines) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+
+func (h deadlines) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *deadlines) Push(x any) {
+	item := x.(*deadline)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *deadlines) Pop() any {
+	old := *h
+	n := len(old)
+	result := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return result
+}
+
+/**
+* expirer: Min-heap of deadlines served by a single timer armed for the earliest one.
+* Each key holds one deadline, moved on update and dropped on cancel, so the heap
+* grows with the keys that expire and not with the writes. fn must still ignore keys
+* whose expiration moved while it was due.
+**/
+type expirer struct {
+	items deadlines
+	keys  map[string]*deadline
+	timer *time.Timer
+	next  time.Time
+	fn    func(key string, at time.Time)
+	mu    sync.Mutex
+}
+
+/**
+* newExpirer
+* @param fn func(key string, at time.Time)
+* @return *expirer
+**/
+func newExpirer(fn func(key string, at time.Time)) *expirer {
+	return &expirer{
+		items: deadlines{},
+		keys:  map[string]*deadline{},
+		fn:    fn,
+	}
+}
+
+/**
+* schedule: Registers key to expire at, re-arming the timer when it becomes the earliest deadline.
+* @param key string, at time.Time
+**/
+func (s *expirer) schedule(key string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if item, ok := s.keys[key]; ok {
+		item.at = at
+		heap.Fix(&s.items, item.index)
+	} else {
+		item = &deadline{key: key, at: at}
+		heap.Push(&s.items, item)
+		s.keys[key] = item
+	}
+	s.arm()
+}
+
+/**
+* cancel: Drops the deadline of key, if any.
+* @param key string
+**/
+func (s *expirer) cancel(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.keys[key]
+	if !ok {
+		return
+	}
+
+	heap.Remove(&s.items, item.index)
+	delete(s.keys, key)
+}
+
+/**
+* arm: Points the timer at the earliest deadline, must be called holding mu.
+**/
+func (s *expirer) arm() {
+	if len(s.items) == 0 {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		s.next = time.Time{}
+		return
+	}
+
+	at := s.items[0].at
+	if !s.next.IsZero() && !at.Before(s.next) {
+		return
+	}
+
+	s.next = at
+	wait := at.Sub(timezone.Now())
+	if s.timer == nil {
+		s.timer = time.AfterFunc(wait, s.run)
+		return
+	}
+
+	s.timer.Reset(wait)
+}
+
+/**
+* run: Pops every due deadline and hands it to fn outside the lock.
+**/
+func (s *expirer) run() {
+	now := timezone.Now()
+	due := []*deadline{}
+
+	s.mu.Lock()
+	for len(s.items) > 0 && !s.items[0].at.After(now) {
+		item := heap.Pop(&s.items).(*deadline)
+		delete(s.keys, item.key)
+		due = append(due, item)
+	}
+	s.next = time.Time{}
+	s.arm()
+	s.mu.Unlock()
+
+	for _, item := range due {
+		s.fn(item.key, item.at)
+	}
+}
+
+/**
+* reset: Drops every pending deadline.
+**/
+func (s *expirer) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items = deadlines{}
+	s.keys = map[string]*deadline{}
+	s.arm()
+}
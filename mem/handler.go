@@ -1,6 +1,7 @@
 package mem
 
 import (
+	"io"
 	"time"
 
 	"github.com/cgalvisleon/et/et"
@@ -195,3 +196,55 @@ func Values() []string {
 
 	return conn.Values()
 }
+
+/**
+* GetStats
+* @return Stats
+**/
+func GetStats() Stats {
+	return conn.Stats()
+}
+
+/**
+* OnEvict
+* @param fn func(entry *Entry, reason EvictReason)
+**/
+func OnEvict(fn func(entry *Entry, reason EvictReason)) {
+	conn.OnEvict(fn)
+}
+
+/**
+* Snapshot
+* @param w io.Writer
+* @return error
+**/
+func Snapshot(w io.Writer) error {
+	return conn.Snapshot(w)
+}
+
+/**
+* Restore
+* @param r io.Reader
+* @return int, error
+**/
+func Restore(r io.Reader) (int, error) {
+	return conn.Restore(r)
+}
+
+/**
+* Persist
+* @param path string, interval time.Duration
+* @return error
+**/
+func Persist(path string, interval time.Duration) error {
+	return conn.Persist(path, interval)
+}
+
+/**
+* AppendLog
+* @param path string
+* @return error
+**/
+func AppendLog(path string) error {
+	return conn.AppendLog(path)
+}
@@ -2,17 +2,125 @@ package mem
 
 import (
 	"fmt"
+	"hash/fnv"
 	"regexp"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cgalvisleon/et/et"
 	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/timezone"
 )
 
+type EvictReason string
+
+const (
+	EvictCapacity EvictReason = "capacity"
+	EvictExpired  EvictReason = "expired"
+	defaultShards             = 16
+)
+
+/**
+* Options: Bounds of a Mem store. Zero MaxEntries or MaxBytes means unbounded.
+**/
+type Options struct {
+	MaxEntries int
+	MaxBytes   int64
+	Policy     Policy
+	Shards     int
+	OnEvict    func(entry *Entry, reason EvictReason)
+}
+
+type Stats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	Entries     int    `json:"entries"`
+	Bytes       int64  `json:"bytes"`
+}
+
+/**
+* ToJson
+* @return et.Json
+**/
+func (s Stats) ToJson() et.Json {
+	return et.Json{
+		"hits":        s.Hits,
+		"misses":      s.Misses,
+		"evictions":   s.Evictions,
+		"expirations": s.Expirations,
+		"entries":     s.Entries,
+		"bytes":       s.Bytes,
+	}
+}
+
+type eviction struct {
+	entry  *Entry
+	reason EvictReason
+}
+
+type shard struct {
+	items      map[string]*Entry
+	policy     policy
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
+	mu         sync.Mutex
+}
+
+/**
+* put: Stores a new entry, must be called holding mu.
+* @param item *Entry
+**/
+func (s *shard) put(item *Entry) {
+	s.items[item.Key] = item
+	s.policy.add(item)
+	s.bytes += item.Size()
+}
+
+/**
+* remove: Drops an entry, must be called holding mu.
+* @param item *Entry
+**/
+func (s *shard) remove(item *Entry) {
+	s.policy.remove(item)
+	delete(s.items, item.Key)
+	s.bytes -= item.Size()
+}
+
+/**
+* trim: Evicts entries chosen by the policy while the shard is over its bounds, must be called holding mu.
+* @return []*Entry
+**/
+func (s *shard) trim() []*Entry {
+	result := []*Entry{}
+	for (s.maxEntries > 0 && len(s.items) > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		item := s.policy.evict()
+		if item == nil {
+			break
+		}
+		delete(s.items, item.Key)
+		s.bytes -= item.Size()
+		result = append(result, item)
+	}
+
+	return result
+}
+
 type Mem struct {
-	items map[string]*Entry
-	mu    sync.RWMutex
+	shards      []*shard
+	options     Options
+	expirer     *expirer
+	onEvict     func(entry *Entry, reason EvictReason)
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+	journal     atomic.Pointer[journal]
+	persist     []chan struct{}
+	mu          sync.RWMutex
 }
 
 var (
@@ -21,16 +129,79 @@ var (
 	clearReCache sync.Map
 )
 
-func Load() *Mem {
-	return &Mem{
-		items: make(map[string]*Entry),
+/**
+* New: Creates a store bounded by opts, split in shards with their own lock and policy.
+* @param opts Options
+* @return *Mem
+**/
+func New(opts Options) *Mem {
+	if opts.Shards <= 0 {
+		opts.Shards = defaultShards
+	}
+	if opts.MaxEntries > 0 && opts.Shards > opts.MaxEntries {
+		opts.Shards = opts.MaxEntries
+	}
+
+	maxEntries := ceil(int64(opts.MaxEntries), opts.Shards)
+	maxBytes := ceil(opts.MaxBytes, opts.Shards)
+	result := &Mem{
+		shards:  make([]*shard, opts.Shards),
+		options: opts,
+		onEvict: opts.OnEvict,
+	}
+	for i := range result.shards {
+		result.shards[i] = &shard{
+			items:      make(map[string]*Entry),
+			policy:     newPolicy(opts.Policy, int(maxEntries)),
+			maxEntries: int(maxEntries),
+			maxBytes:   maxBytes,
+		}
 	}
+	result.expirer = newExpirer(result.expire)
+
+	return result
+}
+
+/**
+* Load: Creates an unbounded LRU store.
+* @return *Mem
+**/
+func Load() *Mem {
+	return New(Options{})
 }
 
 func init() {
 	conn = Load()
 }
 
+/**
+* ceil: Splits total across n shards rounding up.
+* @param total int64, n int
+* @return int64
+**/
+func ceil(total int64, n int) int64 {
+	if total <= 0 {
+		return 0
+	}
+
+	return (total + int64(n) - 1) / int64(n)
+}
+
+/**
+* shard: Returns the shard owning key.
+* @param key string
+* @return *shard
+**/
+func (s *Mem) shard(key string) *shard {
+	if len(s.shards) == 1 {
+		return s.shards[0]
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
 /**
 * Type
 * @return string
@@ -39,42 +210,126 @@ func (s *Mem) Type() string {
 	return "mem"
 }
 
+/**
+* OnEvict: Sets the callback invoked, outside any lock, for every evicted or expired entry.
+* @param fn func(entry *Entry, reason EvictReason)
+**/
+func (s *Mem) OnEvict(fn func(entry *Entry, reason EvictReason)) {
+	s.mu.Lock()
+	s.onEvict = fn
+	s.mu.Unlock()
+}
+
+/**
+* notify: Counts evictions and hands them to the OnEvict callback.
+* @param items []*Entry, reason EvictReason
+**/
+func (s *Mem) notify(items []*Entry, reason EvictReason) {
+	if len(items) == 0 {
+		return
+	}
+
+	if reason == EvictExpired {
+		s.expirations.Add(uint64(len(items)))
+	} else {
+		s.evictions.Add(uint64(len(items)))
+	}
+
+	s.mu.RLock()
+	fn := s.onEvict
+	s.mu.RUnlock()
+	if fn == nil {
+		return
+	}
+
+	for _, item := range items {
+		fn(item, reason)
+	}
+}
+
+/**
+* expire: Removes key if it still expires at; updated entries carry a new deadline.
+* @param key string, at time.Time
+**/
+func (s *Mem) expire(key string, at time.Time) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	item, ok := sh.items[key]
+	if !ok || !item.ExpiresAt.Equal(at) {
+		sh.mu.Unlock()
+		return
+	}
+	sh.remove(item)
+	sh.mu.Unlock()
+
+	s.notify([]*Entry{item}, EvictExpired)
+}
+
+/**
+* Stats
+* @return Stats
+**/
+func (s *Mem) Stats() Stats {
+	result := Stats{
+		Hits:        s.hits.Load(),
+		Misses:      s.misses.Load(),
+		Evictions:   s.evictions.Load(),
+		Expirations: s.expirations.Load(),
+	}
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		result.Entries += len(sh.items)
+		result.Bytes += sh.bytes
+		sh.mu.Unlock()
+	}
+
+	return result
+}
+
 /**
 * Set
 * @param key string, value interface{}, expiration time.Duration
 * @return *Entry, error
 **/
 func (s *Mem) Set(key string, value interface{}, expiration time.Duration) (*Entry, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	item, ok := s.items[key]
+	sh := s.shard(key)
+	sh.mu.Lock()
+	item, ok := sh.items[key]
 	if ok {
-		if item.timer != nil {
-			item.timer.Stop()
-			item.timer = nil
-		}
+		size := item.Size()
 		if _, err := item.Set(value, expiration); err != nil {
+			sh.mu.Unlock()
 			return nil, err
 		}
-		if expiration != 0 {
-			item.timer = time.AfterFunc(expiration, func() {
-				s.Delete(key)
-			})
+		sh.bytes += item.Size() - size
+		sh.policy.access(item)
+	} else {
+		var err error
+		item, err = NewEntry(key, value, expiration)
+		if err != nil {
+			sh.mu.Unlock()
+			return nil, err
 		}
-		return item, nil
+		sh.put(item)
+	}
+	at := item.ExpiresAt
+	s.log(newRecord(item))
+	evicted := sh.trim()
+	for _, e := range evicted {
+		s.log(record{Op: opDelete, Key: e.Key})
 	}
+	sh.mu.Unlock()
 
-	item, err := New(key, value, expiration)
-	if err != nil {
-		return nil, err
+	if !at.IsZero() {
+		s.expirer.schedule(key, at)
+	} else {
+		s.expirer.cancel(key)
 	}
-	s.items[key] = item
-	if expiration != 0 {
-		item.timer = time.AfterFunc(expiration, func() {
-			s.Delete(key)
-		})
+	for _, e := range evicted {
+		s.expirer.cancel(e.Key)
 	}
+	s.notify(evicted, EvictCapacity)
+
 	return item, nil
 }
 
@@ -84,19 +339,18 @@ func (s *Mem) Set(key string, value interface{}, expiration time.Duration) (*Ent
 * @return bool
 **/
 func (s *Mem) Delete(key string) bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	item, ok := s.items[key]
+	item, ok := sh.items[key]
 	if !ok {
 		return false
 	}
 
-	if item.timer != nil {
-		item.timer.Stop()
-		item.timer = nil
-	}
-	delete(s.items, key)
+	sh.remove(item)
+	s.expirer.cancel(key)
+	s.log(record{Op: opDelete, Key: key})
 
 	return true
 }
@@ -107,11 +361,12 @@ func (s *Mem) Delete(key string) bool {
 * @return bool
 **/
 func (s *Mem) Exists(key string) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	_, ok := s.items[key]
-	return ok
+	item, ok := sh.items[key]
+	return ok && !item.IsExpired(timezone.Now())
 }
 
 /**
@@ -120,14 +375,29 @@ func (s *Mem) Exists(key string) bool {
 * @return bool, error
 **/
 func (s *Mem) GetEntry(key string) (*Entry, bool) {
-	s.mu.RLock()
-	item, ok := s.items[key]
-	s.mu.RUnlock()
+	sh := s.shard(key)
+	sh.mu.Lock()
+	item, ok := sh.items[key]
+	if ok && item.IsExpired(timezone.Now()) {
+		sh.remove(item)
+		s.expirer.cancel(key)
+		sh.mu.Unlock()
+		s.misses.Add(1)
+		s.notify([]*Entry{item}, EvictExpired)
+		return nil, false
+	}
 	if ok {
-		return item, true
+		sh.policy.access(item)
 	}
+	sh.mu.Unlock()
 
-	return nil, false
+	if !ok {
+		s.misses.Add(1)
+		return nil, false
+	}
+
+	s.hits.Add(1)
+	return item, true
 }
 
 /**
@@ -379,44 +649,55 @@ func (s *Mem) GetArrayJson(key string, def []et.Json) ([]et.Json, bool, error) {
 * @return int
 **/
 func (s *Mem) More(key string, expiration time.Duration) (int64, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	var result int64
-	item, ok := s.items[key]
-	if !ok {
-		result = 1
-		newItem, err := New(key, result, expiration)
+	sh := s.shard(key)
+	sh.mu.Lock()
+	var result int64 = 1
+	item, ok := sh.items[key]
+	if ok && !item.IsExpired(timezone.Now()) {
+		var err error
+		result, err = item.Int64()
 		if err != nil {
+			sh.mu.Unlock()
 			return 0, err
 		}
-		s.items[key] = newItem
-		if expiration != 0 {
-			newItem.timer = time.AfterFunc(expiration, func() {
-				s.Delete(key)
-			})
+		result++
+		size := item.Size()
+		if _, err = item.Set(result, expiration); err != nil {
+			sh.mu.Unlock()
+			return 0, err
 		}
-		return result, nil
-	}
-
-	var err error
-	result, err = item.Int64()
-	if err != nil {
-		return 0, err
+		sh.bytes += item.Size() - size
+		sh.policy.access(item)
+	} else {
+		if ok {
+			sh.remove(item)
+		}
+		var err error
+		item, err = NewEntry(key, result, expiration)
+		if err != nil {
+			sh.mu.Unlock()
+			return 0, err
+		}
+		sh.put(item)
 	}
-	result++
-	if _, err = item.Set(result, expiration); err != nil {
-		return 0, err
+	at := item.ExpiresAt
+	s.log(newRecord(item))
+	evicted := sh.trim()
+	for _, e := range evicted {
+		s.log(record{Op: opDelete, Key: e.Key})
 	}
-	if item.timer != nil {
-		item.timer.Stop()
-		item.timer = nil
+	sh.mu.Unlock()
+
+	if !at.IsZero() {
+		s.expirer.schedule(key, at)
+	} else {
+		s.expirer.cancel(key)
 	}
-	if expiration != 0 {
-		item.timer = time.AfterFunc(expiration, func() {
-			s.Delete(key)
-		})
+	for _, e := range evicted {
+		s.expirer.cancel(e.Key)
 	}
+	s.notify(evicted, EvictCapacity)
+
 	return result, nil
 }
 
@@ -439,29 +720,32 @@ func (s *Mem) Clear(match string) {
 		clearReCache.Store(pattern, re)
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	for key, item := range s.items {
-		if re.MatchString(key) {
-			if item.timer != nil {
-				item.timer.Stop()
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for key, item := range sh.items {
+			if re.MatchString(key) {
+				sh.remove(item)
+				s.expirer.cancel(key)
+				s.log(record{Op: opDelete, Key: key})
 			}
-			delete(s.items, key)
 		}
+		sh.mu.Unlock()
 	}
 }
 
+/**
+* Empty
+**/
 func (s *Mem) Empty() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	for _, item := range s.items {
-		if item.timer != nil {
-			item.timer.Stop()
-		}
-	}
-	s.items = make(map[string]*Entry)
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		sh.items = make(map[string]*Entry)
+		sh.policy = newPolicy(s.options.Policy, sh.maxEntries)
+		sh.bytes = 0
+		sh.mu.Unlock()
+	}
+	s.expirer.reset()
+	s.log(record{Op: opEmpty})
 }
 
 /**
@@ -469,10 +753,14 @@ func (s *Mem) Empty() {
 * @return int
 **/
 func (s *Mem) Len() int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	result := 0
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		result += len(sh.items)
+		sh.mu.Unlock()
+	}
 
-	return len(s.items)
+	return result
 }
 
 /**
@@ -480,12 +768,14 @@ func (s *Mem) Len() int {
 * @return []string
 **/
 func (s *Mem) Keys() []string {
-	s.mu.RLock()
-	keys := make([]string, 0, len(s.items))
-	for key := range s.items {
-		keys = append(keys, key)
+	keys := []string{}
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for key := range sh.items {
+			keys = append(keys, key)
+		}
+		sh.mu.Unlock()
 	}
-	s.mu.RUnlock()
 
 	return keys
 }
@@ -495,16 +785,18 @@ func (s *Mem) Keys() []string {
 * @return []string
 **/
 func (s *Mem) Values() []string {
-	s.mu.RLock()
-	values := make([]string, 0, len(s.items))
-	for _, item := range s.items {
-		str, err := item.Str()
-		if err != nil {
-			continue
+	values := []string{}
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for _, item := range sh.items {
+			str, err := item.Str()
+			if err != nil {
+				continue
+			}
+			values = append(values, str)
 		}
-		values = append(values, str)
+		sh.mu.Unlock()
 	}
-	s.mu.RUnlock()
 
 	return values
 }
@@ -0,0 +1,153 @@
+package mem
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		touch   []string
+		evicted string
+	}{
+		{name: "lru evicts the least recently used", policy: LRU, touch: []string{"a"}, evicted: "b"},
+		{name: "lru without reads evicts the oldest", policy: LRU, evicted: "a"},
+		{name: "lfu evicts the least frequently used", policy: LFU, touch: []string{"a", "a", "c"}, evicted: "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evicted := []string{}
+			store := New(Options{MaxEntries: 3, Shards: 1, Policy: tt.policy, OnEvict: func(entry *Entry, reason EvictReason) {
+				if reason == EvictCapacity {
+					evicted = append(evicted, entry.Key)
+				}
+			}})
+			for _, key := range []string{"a", "b", "c"} {
+				store.Set(key, key, 0)
+			}
+			for _, key := range tt.touch {
+				store.Get(key)
+			}
+			store.Set("d", "d", 0)
+
+			if len(evicted) != 1 || evicted[0] != tt.evicted {
+				t.Fatalf("evicted %v, want [%s]", evicted, tt.evicted)
+			}
+			if store.Exists(tt.evicted) {
+				t.Fatalf("%s is still stored", tt.evicted)
+			}
+			if stats := store.Stats(); stats.Entries != 3 || stats.Evictions != 1 {
+				t.Fatalf("stats = %+v", stats)
+			}
+		})
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	store := New(Options{MaxBytes: 64, Shards: 1})
+	for i := 0; i < 20; i++ {
+		store.Set(fmt.Sprintf("key-%d", i), "0123456789", 0)
+	}
+
+	if stats := store.Stats(); stats.Bytes > 64 || stats.Evictions == 0 {
+		t.Fatalf("stats = %+v, want at most 64 bytes after evictions", stats)
+	}
+}
+
+func TestExpirer(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   func(store *Mem)
+		exists  bool
+		pending int
+	}{
+		{
+			name:    "expires after its ttl",
+			steps:   func(store *Mem) { store.Set("a", "a", 20*time.Millisecond) },
+			exists:  false,
+			pending: 0,
+		},
+		{
+			name: "an update moves the deadline",
+			steps: func(store *Mem) {
+				store.Set("a", "a", 20*time.Millisecond)
+				store.Set("a", "b", time.Hour)
+			},
+			exists:  true,
+			pending: 1,
+		},
+		{
+			name: "an update without ttl drops the deadline",
+			steps: func(store *Mem) {
+				store.Set("a", "a", 20*time.Millisecond)
+				store.Set("a", "b", 0)
+			},
+			exists:  true,
+			pending: 0,
+		},
+		{
+			name: "a delete drops the deadline",
+			steps: func(store *Mem) {
+				store.Set("a", "a", time.Hour)
+				store.Delete("a")
+			},
+			exists:  false,
+			pending: 0,
+		},
+		{
+			name: "rewrites keep one deadline per key",
+			steps: func(store *Mem) {
+				for i := 0; i < 100; i++ {
+					store.Set("a", i, time.Hour)
+				}
+			},
+			exists:  true,
+			pending: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := Load()
+			tt.steps(store)
+			time.Sleep(60 * time.Millisecond)
+
+			if got := store.Exists("a"); got != tt.exists {
+				t.Fatalf("exists = %v, want %v", got, tt.exists)
+			}
+			store.expirer.mu.Lock()
+			pending := len(store.expirer.items)
+			store.expirer.mu.Unlock()
+			if pending != tt.pending {
+				t.Fatalf("pending deadlines = %d, want %d", pending, tt.pending)
+			}
+		})
+	}
+}
+
+func TestExpirerOrder(t *testing.T) {
+	var mu sync.Mutex
+	fired := []string{}
+	expirer := newExpirer(func(key string, at time.Time) {
+		mu.Lock()
+		fired = append(fired, key)
+		mu.Unlock()
+	})
+
+	now := time.Now()
+	expirer.schedule("c", now.Add(30*time.Millisecond))
+	expirer.schedule("a", now.Add(10*time.Millisecond))
+	expirer.schedule("b", now.Add(20*time.Millisecond))
+	expirer.schedule("x", now.Add(15*time.Millisecond))
+	expirer.cancel("x")
+	time.Sleep(80 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(fired) != "[a b c]" {
+		t.Fatalf("fired %v, want [a b c]", fired)
+	}
+}
@@ -0,0 +1,314 @@
+package mem
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+type Policy int
+
+const (
+	LRU Policy = iota
+	LFU
+	ARC
+)
+
+/**
+* String
+* @return string
+**/
+func (s Policy) String() string {
+	switch s {
+	case LFU:
+		return "lfu"
+	case ARC:
+		return "arc"
+	default:
+		return "lru"
+	}
+}
+
+/**
+* policy: Tracks entry usage and chooses the eviction victim of a shard.
+**/
+type policy interface {
+	add(e *Entry)
+	access(e *Entry)
+	remove(e *Entry)
+	evict() *Entry
+}
+
+/**
+* newPolicy
+* @param kind Policy, capacity int
+* @return policy
+**/
+func newPolicy(kind Policy, capacity int) policy {
+	switch kind {
+	case LFU:
+		return newLfu()
+	case ARC:
+		return newArc(capacity)
+	default:
+		return newLru()
+	}
+}
+
+/**
+* lru: Evicts the least recently used entry.
+**/
+type lru struct {
+	items *list.List
+}
+
+func newLru() *lru {
+	return &lru{items: list.New()}
+}
+
+func (s *lru) add(e *Entry) {
+	e.elem = s.items.PushFront(e)
+}
+
+func (s *lru) access(e *Entry) {
+	if e.elem != nil {
+		s.items.MoveToFront(e.elem)
+	}
+}
+
+func (s *lru) remove(e *Entry) {
+	if e.elem != nil {
+		s.items.Remove(e.elem)
+		e.elem = nil
+	}
+}
+
+func (s *lru) evict() *Entry {
+	back := s.items.Back()
+	if back == nil {
+		return nil
+	}
+
+	e := back.Value.(*Entry)
+	s.remove(e)
+	return e
+}
+
+/**
+* lfu: Evicts the least frequently used entry, the least recent one on ties.
+**/
+type lfu struct {
+	items lfuHeap
+	tick  uint64
+}
+
+type lfuHeap []*Entry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq == h[j].freq {
+		return h[i].tick < h[j].tick
+	}
+	return h[i].freq < h[j].freq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	e := x.(*Entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
+
+func newLfu() *lfu {
+	return &lfu{items: lfuHeap{}}
+}
+
+func (s *lfu) add(e *Entry) {
+	s.tick++
+	e.freq = 1
+	e.tick = s.tick
+	heap.Push(&s.items, e)
+}
+
+func (s *lfu) access(e *Entry) {
+	if e.index < 0 {
+		return
+	}
+
+	s.tick++
+	e.freq++
+	e.tick = s.tick
+	heap.Fix(&s.items, e.index)
+}
+
+func (s *lfu) remove(e *Entry) {
+	if e.index < 0 {
+		return
+	}
+
+	heap.Remove(&s.items, e.index)
+}
+
+func (s *lfu) evict() *Entry {
+	if len(s.items) == 0 {
+		return nil
+	}
+
+	return heap.Pop(&s.items).(*Entry)
+}
+
+/**
+* arc: Adaptive replacement cache. T1 holds entries seen once and T2 entries seen
+* more than once; the ghost lists B1/B2 remember evicted keys to adapt the T1 target p.
+**/
+type ghost struct {
+	key    string
+	recent bool
+}
+
+type arc struct {
+	t1       *list.List
+	t2       *list.List
+	b1       *list.List
+	b2       *list.List
+	ghosts   map[string]*list.Element
+	p        int
+	capacity int
+}
+
+func newArc(capacity int) *arc {
+	return &arc{
+		t1:       list.New(),
+		t2:       list.New(),
+		b1:       list.New(),
+		b2:       list.New(),
+		ghosts:   make(map[string]*list.Element),
+		capacity: capacity,
+	}
+}
+
+/**
+* size: Cache size used to bound p and the ghost lists; grows with the shard when unbounded.
+* @return int
+**/
+func (s *arc) size() int {
+	if s.capacity > 0 {
+		return s.capacity
+	}
+
+	return s.t1.Len() + s.t2.Len() + 1
+}
+
+/**
+* forget: Drops key from the ghost lists.
+* @param key string
+**/
+func (s *arc) forget(key string) {
+	el, ok := s.ghosts[key]
+	if !ok {
+		return
+	}
+
+	if el.Value.(ghost).recent {
+		s.b1.Remove(el)
+	} else {
+		s.b2.Remove(el)
+	}
+	delete(s.ghosts, key)
+}
+
+func (s *arc) add(e *Entry) {
+	el, ok := s.ghosts[e.Key]
+	if !ok {
+		e.list = 1
+		e.elem = s.t1.PushFront(e)
+		return
+	}
+
+	if el.Value.(ghost).recent {
+		delta := max(1, s.b2.Len()/max(1, s.b1.Len()))
+		s.p = min(s.p+delta, s.size())
+	} else {
+		delta := max(1, s.b1.Len()/max(1, s.b2.Len()))
+		s.p = max(s.p-delta, 0)
+	}
+
+	s.forget(e.Key)
+	e.list = 2
+	e.elem = s.t2.PushFront(e)
+}
+
+func (s *arc) access(e *Entry) {
+	if e.elem == nil {
+		return
+	}
+
+	if e.list == 1 {
+		s.t1.Remove(e.elem)
+		e.list = 2
+		e.elem = s.t2.PushFront(e)
+		return
+	}
+
+	s.t2.MoveToFront(e.elem)
+}
+
+func (s *arc) remove(e *Entry) {
+	if e.elem == nil {
+		return
+	}
+
+	if e.list == 1 {
+		s.t1.Remove(e.elem)
+	} else {
+		s.t2.Remove(e.elem)
+	}
+	e.elem = nil
+	e.list = 0
+}
+
+func (s *arc) evict() *Entry {
+	var e *Entry
+	recent := s.t1.Len() > 0 && (s.t1.Len() > s.p || s.t2.Len() == 0)
+	if recent {
+		e = s.t1.Back().Value.(*Entry)
+	} else if s.t2.Len() > 0 {
+		e = s.t2.Back().Value.(*Entry)
+	} else {
+		return nil
+	}
+
+	s.remove(e)
+	s.forget(e.Key)
+	if recent {
+		s.ghosts[e.Key] = s.b1.PushFront(ghost{key: e.Key, recent: true})
+	} else {
+		s.ghosts[e.Key] = s.b2.PushFront(ghost{key: e.Key})
+	}
+
+	limit := s.size()
+	for s.b1.Len()+s.b2.Len() > limit {
+		trim := s.b2
+		if s.b1.Len() > s.b2.Len() {
+			trim = s.b1
+		}
+		s.forget(trim.Back().Value.(ghost).key)
+	}
+
+	return e
+}
@@ -0,0 +1,639 @@
+package mem
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/msg"
+	"github.com/cgalvisleon/et/tcp"
+	"github.com/cgalvisleon/et/timezone"
+)
+
+// tombstoneTTL is how long a replicated delete is remembered to reject older writes.
+const tombstoneTTL = 10 * time.Minute
+
+/**
+* stamp: Last-write-wins clock of a key; ties are broken by the origin node address.
+**/
+type stamp struct {
+	At      int64
+	Origin  string
+	Deleted bool
+}
+
+/**
+* newer
+* @param at int64, origin string
+* @return bool
+**/
+func (s stamp) newer(at int64, origin string) bool {
+	if at != s.At {
+		return at > s.At
+	}
+
+	return origin > s.Origin
+}
+
+/**
+* Replica: Mem store whose writes are propagated to the peers of a tcp.Node. The store
+* is not exposed, so every write goes through a method that replicates it. Conflicts
+* resolve by last-write-wins timestamps and a node pulls a full snapshot from every
+* peer it connects to.
+**/
+type Replica struct {
+	store  *Mem
+	node   *tcp.Node
+	stamps map[string]stamp
+	clock  int64
+	mu     sync.Mutex
+}
+
+/**
+* Replicated: Creates a store replicated over node and mounts its service as "Replica".
+* @param node *tcp.Node, opts ...Options
+* @return *Replica
+**/
+func Replicated(node *tcp.Node, opts ...Options) *Replica {
+	options := Options{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	result := &Replica{
+		store:  New(options),
+		node:   node,
+		stamps: make(map[string]stamp),
+	}
+	node.Mount(result)
+	node.OnPeerConnect(result.sync)
+
+	return result
+}
+
+/**
+* tick: Returns a timestamp greater than any other issued or seen by this node,
+* must be called holding mu.
+* @return int64
+**/
+func (s *Replica) tick() int64 {
+	now := timezone.Now().UnixNano()
+	if now <= s.clock {
+		now = s.clock + 1
+	}
+	s.clock = now
+
+	return now
+}
+
+/**
+* Set: Stores key locally and propagates it to the peers.
+* @param key string, value interface{}, expiration time.Duration
+* @return *Entry, error
+**/
+func (s *Replica) Set(key string, value interface{}, expiration time.Duration) (*Entry, error) {
+	s.mu.Lock()
+	item, err := s.store.Set(key, value, expiration)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	rec := newRecord(item)
+	rec.Stamp = s.tick()
+	rec.Origin = s.node.Addr()
+	s.stamps[key] = stamp{At: rec.Stamp, Origin: rec.Origin}
+	s.mu.Unlock()
+
+	s.broadcast([]record{rec})
+
+	return item, nil
+}
+
+/**
+* Delete: Removes key locally and on the peers.
+* @param key string
+* @return bool
+**/
+func (s *Replica) Delete(key string) bool {
+	s.mu.Lock()
+	result := s.store.Delete(key)
+	rec := record{
+		Op:     opDelete,
+		Key:    key,
+		Stamp:  s.tick(),
+		Origin: s.node.Addr(),
+	}
+	s.stamps[key] = stamp{At: rec.Stamp, Origin: rec.Origin, Deleted: true}
+	s.mu.Unlock()
+
+	s.broadcast([]record{rec})
+
+	return result
+}
+
+/**
+* More: Increments key locally and propagates the new value to the peers.
+* @param key string, expiration time.Duration
+* @return int64, error
+**/
+func (s *Replica) More(key string, expiration time.Duration) (int64, error) {
+	s.mu.Lock()
+	result, err := s.store.More(key, expiration)
+	if err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+
+	item, ok := s.store.GetEntry(key)
+	if !ok {
+		s.mu.Unlock()
+		return result, nil
+	}
+
+	rec := newRecord(item)
+	rec.Stamp = s.tick()
+	rec.Origin = s.node.Addr()
+	s.stamps[key] = stamp{At: rec.Stamp, Origin: rec.Origin}
+	s.mu.Unlock()
+
+	s.broadcast([]record{rec})
+
+	return result, nil
+}
+
+/**
+* remove: Deletes keys locally and on the peers in a single message.
+* @param keys []string
+**/
+func (s *Replica) remove(keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	recs := make([]record, 0, len(keys))
+	for _, key := range keys {
+		s.store.Delete(key)
+		rec := record{
+			Op:     opDelete,
+			Key:    key,
+			Stamp:  s.tick(),
+			Origin: s.node.Addr(),
+		}
+		s.stamps[key] = stamp{At: rec.Stamp, Origin: rec.Origin, Deleted: true}
+		recs = append(recs, rec)
+	}
+	s.mu.Unlock()
+
+	s.broadcast(recs)
+}
+
+/**
+* Clear: Removes the keys containing match, locally and on the peers.
+* @param match string
+**/
+func (s *Replica) Clear(match string) {
+	keys := []string{}
+	for _, key := range s.store.Keys() {
+		if strings.Contains(key, match) {
+			keys = append(keys, key)
+		}
+	}
+
+	s.remove(keys)
+}
+
+/**
+* Empty: Removes every key, locally and on the peers.
+**/
+func (s *Replica) Empty() {
+	s.remove(s.store.Keys())
+}
+
+/**
+* setVersion
+* @param key string, version int
+**/
+func (s *Replica) setVersion(key string, version int) {
+	s.store.setVersion(key, version)
+}
+
+/**
+* Restore: Loads a snapshot or log from r, propagating its entries to the peers.
+* @param r io.Reader
+* @return int, error
+**/
+func (s *Replica) Restore(r io.Reader) (int, error) {
+	return restore(s, r)
+}
+
+/**
+* RestoreFile: Restores the snapshot or log at path, propagating its entries to the peers.
+* @param path string
+* @return int, error
+**/
+func (s *Replica) RestoreFile(path string) (int, error) {
+	return restoreFile(s, path)
+}
+
+/**
+* Persist: Restores path through the replica and then snapshots the store to it every
+* interval and on shutdown.
+* @param path string, interval time.Duration
+* @return error
+**/
+func (s *Replica) Persist(path string, interval time.Duration) error {
+	if _, err := s.RestoreFile(path); err != nil {
+		return err
+	}
+
+	s.store.persistTo(path, interval)
+	return nil
+}
+
+/**
+* AppendLog: Replays the log at path through the replica and then appends every write to it.
+* @param path string
+* @return error
+**/
+func (s *Replica) AppendLog(path string) error {
+	if s.store.journal.Load() != nil {
+		return nil
+	}
+
+	if _, err := s.RestoreFile(path); err != nil {
+		return err
+	}
+
+	return s.store.openLog(path)
+}
+
+/**
+* broadcast: Sends recs to every connected peer without waiting for them.
+* @param recs []record
+**/
+func (s *Replica) broadcast(recs []record) {
+	for _, peer := range s.node.GetPeers() {
+		if peer.Status != tcp.Connected {
+			continue
+		}
+
+		go func(peer *tcp.Client) {
+			res := peer.Request("Replica.Apply", recs)
+			if res.Error != nil {
+				logs.Alertf("mem replica apply on:%s error:%s", peer.Addr, res.Error.Error())
+			}
+		}(peer)
+	}
+}
+
+/**
+* sync: Pulls the snapshot of a peer that just connected.
+* @param peer *tcp.Client
+**/
+func (s *Replica) sync(peer *tcp.Client) {
+	res := peer.Request("Replica.Snapshot")
+	if res.Error != nil {
+		logs.Alertf("mem replica snapshot from:%s error:%s", peer.Addr, res.Error.Error())
+		return
+	}
+
+	var recs []record
+	if err := res.Get(&recs); err != nil {
+		logs.Alertf("mem replica snapshot from:%s error:%s", peer.Addr, err.Error())
+		return
+	}
+
+	s.apply(recs)
+}
+
+/**
+* apply: Applies the records newer than the local state of their keys.
+* @param recs []record
+* @return int
+**/
+func (s *Replica) apply(recs []record) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := timezone.Now()
+	result := 0
+	for _, rec := range recs {
+		current, ok := s.stamps[rec.Key]
+		if ok && !current.newer(rec.Stamp, rec.Origin) {
+			continue
+		}
+
+		if rec.Stamp > s.clock {
+			s.clock = rec.Stamp
+		}
+
+		if rec.Op == opDelete {
+			s.store.Delete(rec.Key)
+			s.stamps[rec.Key] = stamp{At: rec.Stamp, Origin: rec.Origin, Deleted: true}
+			result++
+			continue
+		}
+
+		var ttl time.Duration
+		if !rec.ExpiresAt.IsZero() {
+			ttl = rec.ExpiresAt.Sub(now)
+			if ttl <= 0 {
+				continue
+			}
+		}
+
+		if _, err := s.store.Set(rec.Key, rec.Value, ttl); err != nil {
+			logs.Alertf("mem replica set key:%s error:%s", rec.Key, err.Error())
+			continue
+		}
+		s.store.setVersion(rec.Key, rec.Version)
+		s.stamps[rec.Key] = stamp{At: rec.Stamp, Origin: rec.Origin}
+		result++
+	}
+
+	return result
+}
+
+/**
+* records: Returns the live entries and recent tombstones with their stamps,
+* forgetting the tombstones older than tombstoneTTL.
+* @return []record
+**/
+func (s *Replica) records() []record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := timezone.Now()
+	expired := now.Add(-tombstoneTTL).UnixNano()
+	result := []record{}
+	for key, st := range s.stamps {
+		if st.Deleted {
+			if st.At < expired {
+				delete(s.stamps, key)
+				continue
+			}
+			result = append(result, record{Op: opDelete, Key: key, Stamp: st.At, Origin: st.Origin})
+			continue
+		}
+
+		sh := s.store.shard(key)
+		sh.mu.Lock()
+		item, ok := sh.items[key]
+		if !ok || item.IsExpired(now) {
+			sh.mu.Unlock()
+			delete(s.stamps, key)
+			continue
+		}
+		rec := newRecord(item)
+		sh.mu.Unlock()
+
+		rec.Stamp = st.At
+		rec.Origin = st.Origin
+		result = append(result, rec)
+	}
+
+	return result
+}
+
+/**
+* Execute: Serves the replication methods to the peers.
+* @param method string, request *tcp.Message
+* @return *tcp.Response
+**/
+func (s *Replica) Execute(method string, request *tcp.Message) *tcp.Response {
+	switch method {
+	case "Apply":
+		var recs []record
+		if err := request.GetArgs(&recs); err != nil {
+			return tcp.TcpError(err)
+		}
+
+		return tcp.TcpResponse(s.apply(recs))
+	case "Snapshot":
+		return tcp.TcpResponse(s.records())
+	default:
+		return tcp.TcpError(msg.MSG_METHOD_NOT_FOUND)
+	}
+}
+
+/**
+* Type
+* @return string
+**/
+func (s *Replica) Type() string {
+	return s.store.Type()
+}
+
+/**
+* OnEvict
+* @param fn func(entry *Entry, reason EvictReason)
+**/
+func (s *Replica) OnEvict(fn func(entry *Entry, reason EvictReason)) {
+	s.store.OnEvict(fn)
+}
+
+/**
+* Stats
+* @return Stats
+**/
+func (s *Replica) Stats() Stats {
+	return s.store.Stats()
+}
+
+/**
+* Exists
+* @param key string
+* @return bool
+**/
+func (s *Replica) Exists(key string) bool {
+	return s.store.Exists(key)
+}
+
+/**
+* GetEntry
+* @param key string
+* @return *Entry, bool
+**/
+func (s *Replica) GetEntry(key string) (*Entry, bool) {
+	return s.store.GetEntry(key)
+}
+
+/**
+* Get
+* @param key string
+* @return interface{}, bool
+**/
+func (s *Replica) Get(key string) (interface{}, bool) {
+	return s.store.Get(key)
+}
+
+/**
+* GetStr
+* @param key string
+* @return string, bool, error
+**/
+func (s *Replica) GetStr(key string) (string, bool, error) {
+	return s.store.GetStr(key)
+}
+
+/**
+* GetInt
+* @param key string, def int
+* @return int, bool, error
+**/
+func (s *Replica) GetInt(key string, def int) (int, bool, error) {
+	return s.store.GetInt(key, def)
+}
+
+/**
+* GetInt64
+* @param key string, def int64
+* @return int64, bool, error
+**/
+func (s *Replica) GetInt64(key string, def int64) (int64, bool, error) {
+	return s.store.GetInt64(key, def)
+}
+
+/**
+* GetFloat
+* @param key string, def float64
+* @return float64, bool, error
+**/
+func (s *Replica) GetFloat(key string, def float64) (float64, bool, error) {
+	return s.store.GetFloat(key, def)
+}
+
+/**
+* GetBool
+* @param key string, def bool
+* @return bool, bool, error
+**/
+func (s *Replica) GetBool(key string, def bool) (bool, bool, error) {
+	return s.store.GetBool(key, def)
+}
+
+/**
+* GetTime
+* @param key string, def time.Time
+* @return time.Time, bool, error
+**/
+func (s *Replica) GetTime(key string, def time.Time) (time.Time, bool, error) {
+	return s.store.GetTime(key, def)
+}
+
+/**
+* GetDuration
+* @param key string, def time.Duration
+* @return time.Duration, bool, error
+**/
+func (s *Replica) GetDuration(key string, def time.Duration) (time.Duration, bool, error) {
+	return s.store.GetDuration(key, def)
+}
+
+/**
+* GetJson
+* @param key string, def et.Json
+* @return et.Json, bool, error
+**/
+func (s *Replica) GetJson(key string, def et.Json) (et.Json, bool, error) {
+	return s.store.GetJson(key, def)
+}
+
+/**
+* GetArrayStr
+* @param key string, def []string
+* @return []string, bool, error
+**/
+func (s *Replica) GetArrayStr(key string, def []string) ([]string, bool, error) {
+	return s.store.GetArrayStr(key, def)
+}
+
+/**
+* GetArrayInt
+* @param key string, def []int
+* @return []int, bool, error
+**/
+func (s *Replica) GetArrayInt(key string, def []int) ([]int, bool, error) {
+	return s.store.GetArrayInt(key, def)
+}
+
+/**
+* GetArrayFloat
+* @param key string, def []float64
+* @return []float64, bool, error
+**/
+func (s *Replica) GetArrayFloat(key string, def []float64) ([]float64, bool, error) {
+	return s.store.GetArrayFloat(key, def)
+}
+
+/**
+* GetArrayJson
+* @param key string, def []et.Json
+* @return []et.Json, bool, error
+**/
+func (s *Replica) GetArrayJson(key string, def []et.Json) ([]et.Json, bool, error) {
+	return s.store.GetArrayJson(key, def)
+}
+
+/**
+* Len
+* @return int
+**/
+func (s *Replica) Len() int {
+	return s.store.Len()
+}
+
+/**
+* Keys
+* @return []string
+**/
+func (s *Replica) Keys() []string {
+	return s.store.Keys()
+}
+
+/**
+* Values
+* @return []string
+**/
+func (s *Replica) Values() []string {
+	return s.store.Values()
+}
+
+/**
+* Snapshot: Writes the local entries to w.
+* @param w io.Writer
+* @return error
+**/
+func (s *Replica) Snapshot(w io.Writer) error {
+	return s.store.Snapshot(w)
+}
+
+/**
+* SnapshotFile: Writes a snapshot of the local entries to path.
+* @param path string
+* @return error
+**/
+func (s *Replica) SnapshotFile(path string) error {
+	return s.store.SnapshotFile(path)
+}
+
+/**
+* Compact: Rewrites the append-only log of the local store.
+* @return error
+**/
+func (s *Replica) Compact() error {
+	return s.store.Compact()
+}
+
+/**
+* Close: Stops the persistence of the local store.
+* @return error
+**/
+func (s *Replica) Close() error {
+	return s.store.Close()
+}
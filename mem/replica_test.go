@@ -0,0 +1,122 @@
+package mem
+
+import (
+	"testing"
+	"time"
+)
+
+/**
+* testRecord: Builds the record a peer would send for key set to value at stamp.
+* @param t *testing.T, key, value string, at int64, origin string
+* @return record
+**/
+func testRecord(t *testing.T, key, value string, at int64, origin string) record {
+	t.Helper()
+	item, err := NewEntry(key, value, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := newRecord(item)
+	rec.Stamp = at
+	rec.Origin = origin
+	return rec
+}
+
+func TestReplicaApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		recs    func(t *testing.T) []record
+		applied int
+		value   string
+		exists  bool
+	}{
+		{
+			name: "newer write wins",
+			recs: func(t *testing.T) []record {
+				return []record{testRecord(t, "a", "1", 10, "node-a"), testRecord(t, "a", "2", 20, "node-b")}
+			},
+			applied: 2, value: "2", exists: true,
+		},
+		{
+			name: "older write is ignored",
+			recs: func(t *testing.T) []record {
+				return []record{testRecord(t, "a", "2", 20, "node-b"), testRecord(t, "a", "1", 10, "node-a")}
+			},
+			applied: 1, value: "2", exists: true,
+		},
+		{
+			name: "ties break by origin",
+			recs: func(t *testing.T) []record {
+				return []record{testRecord(t, "a", "b", 10, "node-b"), testRecord(t, "a", "a", 10, "node-a")}
+			},
+			applied: 1, value: "b", exists: true,
+		},
+		{
+			name: "a tombstone rejects older writes",
+			recs: func(t *testing.T) []record {
+				return []record{
+					{Op: opDelete, Key: "a", Stamp: 20, Origin: "node-a"},
+					testRecord(t, "a", "1", 10, "node-b"),
+				}
+			},
+			applied: 1, exists: false,
+		},
+		{
+			name: "a newer write revives a deleted key",
+			recs: func(t *testing.T) []record {
+				return []record{
+					{Op: opDelete, Key: "a", Stamp: 20, Origin: "node-a"},
+					testRecord(t, "a", "3", 30, "node-b"),
+				}
+			},
+			applied: 2, value: "3", exists: true,
+		},
+		{
+			name: "expired writes are skipped",
+			recs: func(t *testing.T) []record {
+				rec := testRecord(t, "a", "1", 10, "node-a")
+				rec.ExpiresAt = time.Now().Add(-time.Second)
+				return []record{rec}
+			},
+			applied: 0, exists: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replica := &Replica{store: Load(), stamps: make(map[string]stamp)}
+			if got := replica.apply(tt.recs(t)); got != tt.applied {
+				t.Fatalf("applied %d records, want %d", got, tt.applied)
+			}
+
+			value, exists, _ := replica.GetStr("a")
+			if exists != tt.exists || value != tt.value {
+				t.Fatalf("got %q exists %v, want %q exists %v", value, exists, tt.value, tt.exists)
+			}
+		})
+	}
+}
+
+func TestReplicaRecords(t *testing.T) {
+	source := &Replica{store: Load(), stamps: make(map[string]stamp)}
+	source.apply([]record{
+		testRecord(t, "a", "1", 10, "node-a"),
+		testRecord(t, "b", "2", 11, "node-a"),
+		{Op: opDelete, Key: "b", Stamp: time.Now().UnixNano(), Origin: "node-a"},
+	})
+
+	/* A peer that connects pulls the snapshot, tombstones included */
+	target := &Replica{store: Load(), stamps: make(map[string]stamp)}
+	target.apply([]record{testRecord(t, "b", "old", 5, "node-b")})
+	target.apply(source.records())
+
+	if value, _, _ := target.GetStr("a"); value != "1" {
+		t.Fatalf("a = %q, want 1", value)
+	}
+	if target.Exists("b") {
+		t.Fatal("b survived the tombstone of the snapshot")
+	}
+	if target.clock < source.clock {
+		t.Fatalf("clock %d behind the applied stamps %d", target.clock, source.clock)
+	}
+}
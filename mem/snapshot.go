@@ -0,0 +1,441 @@
+package mem
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/timezone"
+	"github.com/cgalvisleon/et/utility"
+)
+
+const (
+	opSet    = "set"
+	opDelete = "delete"
+	opEmpty  = "empty"
+)
+
+/**
+* record: Line of a snapshot or of the append-only log. ExpiresAt is absolute so
+* the remaining TTL keeps counting while the process is down.
+**/
+type record struct {
+	Op        string    `json:"op"`
+	Key       string    `json:"key,omitempty"`
+	Value     []byte    `json:"value,omitempty"`
+	Version   int       `json:"version,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	Stamp     int64     `json:"stamp,omitempty"`
+	Origin    string    `json:"origin,omitempty"`
+}
+
+/**
+* newRecord
+* @param item *Entry
+* @return record
+**/
+func newRecord(item *Entry) record {
+	return record{
+		Op:        opSet,
+		Key:       item.Key,
+		Value:     item.Value,
+		Version:   item.Version,
+		ExpiresAt: item.ExpiresAt,
+	}
+}
+
+/**
+* journal: Append-only log of the writes applied to a Mem.
+**/
+type journal struct {
+	path string
+	file *os.File
+	enc  *json.Encoder
+	mu   sync.Mutex
+}
+
+/**
+* write: Appends rec, must be called holding the lock of the shard that owns rec.Key.
+* @param rec record
+**/
+func (s *journal) write(rec record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.enc == nil {
+		return
+	}
+
+	if err := s.enc.Encode(rec); err != nil {
+		logs.Alertf("mem journal:%s error:%s", s.path, err.Error())
+	}
+}
+
+/**
+* log: Appends rec when the append-only log is enabled.
+* @param rec record
+**/
+func (s *Mem) log(rec record) {
+	if j := s.journal.Load(); j != nil {
+		j.write(rec)
+	}
+}
+
+/**
+* lockAll: Locks every shard in order, to take a consistent view of the store.
+**/
+func (s *Mem) lockAll() {
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+	}
+}
+
+/**
+* unlockAll
+**/
+func (s *Mem) unlockAll() {
+	for _, sh := range s.shards {
+		sh.mu.Unlock()
+	}
+}
+
+/**
+* snapshot: Writes every live entry to w, must be called holding every shard lock.
+* @param w io.Writer
+* @return error
+**/
+func (s *Mem) snapshot(w io.Writer) error {
+	now := timezone.Now()
+	enc := json.NewEncoder(w)
+	for _, sh := range s.shards {
+		for _, item := range sh.items {
+			if item.IsExpired(now) {
+				continue
+			}
+			if err := enc.Encode(newRecord(item)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/**
+* Snapshot: Writes every live entry with its version and deadline to w.
+* @param w io.Writer
+* @return error
+**/
+func (s *Mem) Snapshot(w io.Writer) error {
+	s.lockAll()
+	defer s.unlockAll()
+
+	return s.snapshot(w)
+}
+
+/**
+* Restore: Loads the entries of a snapshot or log from r, skipping those already expired.
+* A truncated last line, as left by a crash while appending, ends the restore without error.
+* @param r io.Reader
+* @return int, error
+**/
+func (s *Mem) Restore(r io.Reader) (int, error) {
+	return restore(s, r)
+}
+
+/**
+* writer: Store that snapshots and logs are restored into.
+**/
+type writer interface {
+	Set(key string, value interface{}, expiration time.Duration) (*Entry, error)
+	Delete(key string) bool
+	Empty()
+	setVersion(key string, version int)
+}
+
+/**
+* restore: Replays the records read from r into s.
+* @param s writer, r io.Reader
+* @return int, error
+**/
+func restore(s writer, r io.Reader) (int, error) {
+	now := timezone.Now()
+	dec := json.NewDecoder(r)
+	result := 0
+	for {
+		var rec record
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return result, nil
+		} else if errors.Is(err, io.ErrUnexpectedEOF) {
+			logs.Alertf("mem restore: truncated record after %d entries", result)
+			return result, nil
+		} else if err != nil {
+			return result, err
+		}
+
+		switch rec.Op {
+		case opDelete:
+			s.Delete(rec.Key)
+			continue
+		case opEmpty:
+			s.Empty()
+			continue
+		}
+
+		if !rec.ExpiresAt.IsZero() && !now.Before(rec.ExpiresAt) {
+			s.Delete(rec.Key)
+			continue
+		}
+
+		var ttl time.Duration
+		if !rec.ExpiresAt.IsZero() {
+			ttl = rec.ExpiresAt.Sub(now)
+		}
+		if _, err := s.Set(rec.Key, rec.Value, ttl); err != nil {
+			return result, err
+		}
+		s.setVersion(rec.Key, rec.Version)
+		result++
+	}
+}
+
+/**
+* setVersion
+* @param key string, version int
+**/
+func (s *Mem) setVersion(key string, version int) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if item, ok := sh.items[key]; ok {
+		item.Version = version
+	}
+}
+
+/**
+* writeFile: Replaces path atomically with the output of fn.
+* @param path string, fn func(w io.Writer) error
+* @return error
+**/
+func writeFile(path string, fn func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := fn(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+/**
+* SnapshotFile: Writes a snapshot to path, replacing the previous one atomically.
+* @param path string
+* @return error
+**/
+func (s *Mem) SnapshotFile(path string) error {
+	return writeFile(path, s.Snapshot)
+}
+
+/**
+* RestoreFile: Restores the snapshot or log at path, a missing file restores nothing.
+* @param path string
+* @return int, error
+**/
+func (s *Mem) RestoreFile(path string) (int, error) {
+	return restoreFile(s, path)
+}
+
+/**
+* restoreFile: Replays the snapshot or log at path into s, a missing file restores nothing.
+* @param s writer, path string
+* @return int, error
+**/
+func restoreFile(s writer, path string) (int, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return restore(s, file)
+}
+
+/**
+* Persist: Restores path and then snapshots the store to it every interval and on shutdown.
+* A zero interval only snapshots on shutdown.
+* @param path string, interval time.Duration
+* @return error
+**/
+func (s *Mem) Persist(path string, interval time.Duration) error {
+	if _, err := s.RestoreFile(path); err != nil {
+		return err
+	}
+
+	s.persistTo(path, interval)
+	return nil
+}
+
+/**
+* persistTo: Snapshots the store to path every interval and on shutdown.
+* @param path string, interval time.Duration
+**/
+func (s *Mem) persistTo(path string, interval time.Duration) {
+	stop := make(chan struct{})
+	s.mu.Lock()
+	s.persist = append(s.persist, stop)
+	s.mu.Unlock()
+
+	if interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := s.SnapshotFile(path); err != nil {
+						logs.Alertf("mem snapshot:%s error:%s", path, err.Error())
+					}
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	utility.OnShutdown(func() {
+		s.Close()
+		if err := s.SnapshotFile(path); err != nil {
+			logs.Alertf("mem snapshot:%s error:%s", path, err.Error())
+		}
+	})
+}
+
+/**
+* AppendLog: Replays the log at path and then appends every write to it.
+* The log is compacted on open and on Close.
+* @param path string
+* @return error
+**/
+func (s *Mem) AppendLog(path string) error {
+	if s.journal.Load() != nil {
+		return nil
+	}
+
+	if _, err := s.RestoreFile(path); err != nil {
+		return err
+	}
+
+	return s.openLog(path)
+}
+
+/**
+* openLog: Appends every write to the log at path, compacting it first.
+* @param path string
+* @return error
+**/
+func (s *Mem) openLog(path string) error {
+	j := &journal{path: path}
+	s.journal.Store(j)
+	if err := s.Compact(); err != nil {
+		s.journal.Store(nil)
+		return err
+	}
+
+	utility.OnShutdown(func() {
+		if err := s.Close(); err != nil {
+			logs.Alertf("mem journal:%s error:%s", path, err.Error())
+		}
+	})
+
+	return nil
+}
+
+/**
+* Compact: Rewrites the append-only log as a snapshot of the current entries.
+* Writes wait while the log is rewritten.
+* @return error
+**/
+func (s *Mem) Compact() error {
+	j := s.journal.Load()
+	if j == nil {
+		return nil
+	}
+
+	s.lockAll()
+	defer s.unlockAll()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+		j.enc = nil
+	}
+
+	if err := writeFile(j.path, s.snapshot); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	j.file = file
+	j.enc = json.NewEncoder(file)
+
+	return nil
+}
+
+/**
+* Close: Stops the periodic snapshots and compacts and closes the append-only log.
+* @return error
+**/
+func (s *Mem) Close() error {
+	s.mu.Lock()
+	for _, stop := range s.persist {
+		close(stop)
+	}
+	s.persist = nil
+	s.mu.Unlock()
+
+	err := s.Compact()
+	j := s.journal.Swap(nil)
+	if j == nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+
+	return err
+}
@@ -0,0 +1,116 @@
+package mem
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	source := Load()
+	source.Set("name", "store", 0)
+	source.Set("count", "3", time.Hour)
+	source.Set("count", "4", time.Hour)
+	source.Set("gone", "x", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := source.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	target := Load()
+	n, err := target.Restore(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("restored %d entries, want 2", n)
+	}
+
+	tests := []struct {
+		key     string
+		value   string
+		exists  bool
+		expires bool
+	}{
+		{key: "name", value: "store", exists: true},
+		{key: "count", value: "4", exists: true, expires: true},
+		{key: "gone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			entry, exists := target.GetEntry(tt.key)
+			if exists != tt.exists {
+				t.Fatalf("exists = %v, want %v", exists, tt.exists)
+			}
+			if !exists {
+				return
+			}
+
+			got, _ := entry.Str()
+			if got != tt.value {
+				t.Errorf("value = %q, want %q", got, tt.value)
+			}
+			if entry.ExpiresAt.IsZero() == tt.expires {
+				t.Errorf("expires at %s, want expiring %v", entry.ExpiresAt, tt.expires)
+			}
+
+			original, _ := source.GetEntry(tt.key)
+			if entry.Version != original.Version {
+				t.Errorf("version = %d, want %d", entry.Version, original.Version)
+			}
+		})
+	}
+}
+
+func TestRestoreTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	source := Load()
+	source.Set("a", "1", 0)
+	source.Set("b", "2", 0)
+	if err := source.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	/* A crash while appending leaves half a record */
+	data := buf.String() + `{"op":"set","key":"c","val`
+	n, err := Load().Restore(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("restored %d entries, want 2", n)
+	}
+}
+
+func TestAppendLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mem.log")
+
+	first := Load()
+	if err := first.AppendLog(path); err != nil {
+		t.Fatal(err)
+	}
+	first.Set("a", "1", 0)
+	first.Set("b", "2", 0)
+	first.Set("a", "3", 0)
+	first.Delete("b")
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	second := Load()
+	if err := second.AppendLog(path); err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	if got, _, _ := second.GetStr("a"); got != "3" {
+		t.Fatalf("a = %q, want 3", got)
+	}
+	if second.Exists("b") {
+		t.Fatal("deleted key b was replayed")
+	}
+}
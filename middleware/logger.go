@@ -55,6 +55,7 @@ func RequestLogger(f LogFormatter) func(next http.Handler) http.Handler {
 			metric := NewMetric(r)
 			metric.CallSearchTime()
 			w.Header().Set("ServiceId", metric.ServiceId)
+			r = r.WithContext(metric.WithContext(r.Context()))
 			ww := &ResponseWriterWrapper{ResponseWriter: w, StatusCode: http.StatusOK}
 			entry := f.NewLogEntry(r)
 			wr := WithLogEntry(r, entry)
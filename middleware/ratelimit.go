@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cgalvisleon/et/cache"
+	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/msg"
+	"github.com/cgalvisleon/et/request"
+	"github.com/cgalvisleon/et/response"
+)
+
+type RateKey string
+
+const (
+	RateByIP     RateKey = "ip"
+	RateByUser   RateKey = "user"
+	RateByApiKey RateKey = "apikey"
+	RateByRoute  RateKey = "route"
+	ApiKeyHeader         = "X-Api-Key"
+)
+
+/**
+* RateLimitConfig: Rate limit rule plus the request attribute used to bucket requests.
+**/
+type RateLimitConfig struct {
+	cache.RateLimit
+	By RateKey `json:"by"`
+}
+
+/**
+* NewRateLimitConfig: Builds a RateLimitConfig from its JSON definition.
+* window accepts a duration string ("1s", "1m") or a number of seconds.
+* @param params et.Json
+* @return *RateLimitConfig
+**/
+func NewRateLimitConfig(params et.Json) *RateLimitConfig {
+	if params.IsEmpty() {
+		return nil
+	}
+
+	window, err := time.ParseDuration(params.Str("window"))
+	if err != nil {
+		window = time.Duration(params.Int64("window")) * time.Second
+	}
+	if window <= 0 {
+		window = time.Second
+	}
+
+	algorithm := cache.RateAlgorithm(params.ValStr(string(cache.SlidingWindow), "algorithm"))
+	by := RateKey(params.ValStr(string(RateByIP), "by"))
+
+	return &RateLimitConfig{
+		RateLimit: cache.RateLimit{
+			Algorithm: algorithm,
+			Limit:     params.Int64("limit"),
+			Window:    window,
+			Burst:     params.Int64("burst"),
+		},
+		By: by,
+	}
+}
+
+/**
+* RateKeyOf: Returns the bucket key of the request for the given strategy.
+* User and API key strategies fall back to the client IP when the value is missing.
+* API keys are hashed so the credential never shows up in the cache keys.
+* @param r *http.Request, by RateKey
+* @return string
+**/
+func RateKeyOf(r *http.Request, by RateKey) string {
+	switch by {
+	case RateByUser:
+		if userId := request.UserId(r); userId != "" {
+			return userId
+		}
+	case RateByApiKey:
+		if apiKey := r.Header.Get(ApiKeyHeader); apiKey != "" {
+			hash := sha256.Sum256([]byte(apiKey))
+			return hex.EncodeToString(hash[:])
+		}
+	case RateByRoute:
+		return fmt.Sprintf(`%s:%s`, r.Method, r.URL.Path)
+	}
+
+	return ClientAddress(r)
+}
+
+/**
+* SetRateHeaders: Writes the X-RateLimit-* and Retry-After headers.
+* @param w http.ResponseWriter, result cache.RateResult
+**/
+func SetRateHeaders(w http.ResponseWriter, result cache.RateResult) {
+	header := w.Header()
+	header.Set("X-RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+	header.Set("X-RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(result.Reset.Seconds())), 10))
+	if !result.Allowed {
+		header.Set("Retry-After", strconv.FormatInt(int64(math.Ceil(result.RetryAfter.Seconds())), 10))
+	}
+}
+
+/**
+* Allow: Consumes one request from the bucket of r and writes the rate headers.
+* Fails open when the cache service is not available.
+* @param w http.ResponseWriter, r *http.Request, scope string
+* @return bool
+**/
+func (s *RateLimitConfig) Allow(w http.ResponseWriter, r *http.Request, scope string) bool {
+	key := fmt.Sprintf(`%s:%s`, s.By, RateKeyOf(r, s.By))
+	if scope != "" {
+		key = fmt.Sprintf(`%s:%s`, scope, key)
+	}
+
+	result, err := cache.Allow(key, s.RateLimit)
+	if err != nil {
+		return true
+	}
+
+	SetRateHeaders(w, result)
+	if !result.Allowed {
+		PushTelemetryOverflow(et.Json{
+			"key":         key,
+			"limit":       result.Limit,
+			"retry_after": result.RetryAfter.Seconds(),
+		})
+	}
+
+	return result.Allowed
+}
+
+/**
+* RateLimiter: Middleware that rejects requests over the configured limit with 429.
+* @param config RateLimitConfig
+* @return func(http.Handler) http.Handler
+**/
+func RateLimiter(config RateLimitConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !config.Allow(w, r, "") {
+				response.HTTPError(w, r, http.StatusTooManyRequests, msg.MSG_RATE_LIMIT_EXCEEDED)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRateKeyOf(t *testing.T) {
+	r := httptest.NewRequest("GET", "/items", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	r.Header.Set(ApiKeyHeader, "secret-key")
+
+	key := RateKeyOf(r, RateByApiKey)
+	if strings.Contains(key, "secret-key") {
+		t.Fatalf("key %q leaks the API key", key)
+	}
+	if len(key) != 64 {
+		t.Fatalf("key %q is not a sha256 hex digest", key)
+	}
+	if again := RateKeyOf(r, RateByApiKey); again != key {
+		t.Fatalf("key is not stable: %q and %q", key, again)
+	}
+
+	r.Header.Del(ApiKeyHeader)
+	if got := RateKeyOf(r, RateByApiKey); got != "10.0.0.1" {
+		t.Fatalf("without API key got %q, want the client address", got)
+	}
+	if got := RateKeyOf(r, RateByRoute); got != "GET:/items" {
+		t.Fatalf("route key = %q", got)
+	}
+}
+
+func TestClientAddress(t *testing.T) {
+	SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	defer SetTrustedProxies(nil)
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		realIp    string
+		want      string
+	}{
+		{name: "direct client", remote: "203.0.113.7:4000", want: "203.0.113.7"},
+		{name: "untrusted peer sends X-Forwarded-For", remote: "203.0.113.7:4000", forwarded: "1.2.3.4", want: "203.0.113.7"},
+		{name: "untrusted peer sends X-Real-IP", remote: "203.0.113.7:4000", realIp: "1.2.3.4", want: "203.0.113.7"},
+		{name: "trusted proxy", remote: "10.1.2.3:4000", forwarded: "198.51.100.9", want: "198.51.100.9"},
+		{name: "spoofed hop before the proxy", remote: "10.1.2.3:4000", forwarded: "1.2.3.4, 198.51.100.9", want: "198.51.100.9"},
+		{name: "chain of trusted proxies", remote: "10.1.2.3:4000", forwarded: "198.51.100.9, 192.168.1.1", want: "198.51.100.9"},
+		{name: "trusted proxy with X-Real-IP", remote: "192.168.1.1:4000", realIp: "198.51.100.9", want: "198.51.100.9"},
+		{name: "trusted proxy without headers", remote: "10.1.2.3:4000", want: "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIp != "" {
+				r.Header.Set("X-Real-IP", tt.realIp)
+			}
+
+			if got := ClientAddress(r); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
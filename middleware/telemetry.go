@@ -1,11 +1,16 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cgalvisleon/et/cache"
@@ -17,13 +22,37 @@ import (
 	lg "github.com/cgalvisleon/et/stdrout"
 	"github.com/cgalvisleon/et/strs"
 	"github.com/cgalvisleon/et/timezone"
+	"github.com/cgalvisleon/et/trace"
 	"github.com/cgalvisleon/et/utility"
 )
 
 var (
 	hostName, _ = os.Hostname()
+	// OpenTelemetry histograms by route, exported while trace exporter runs
+	durationHistogram = trace.NewHistogram("http.server.request.duration", "ms", "Duration of HTTP server requests", trace.DurationBounds)
+	requestHistogram  = trace.NewHistogram("http.server.request.body.size", "By", "Size of HTTP server request bodies", trace.SizeBounds)
+	responseHistogram = trace.NewHistogram("http.server.response.body.size", "By", "Size of HTTP server response bodies", trace.SizeBounds)
 )
 
+var traceOnce sync.Once
+
+/**
+* LoadTrace: Starts the OTLP exporter configured in the environment, once, and stops
+* it on shutdown. Servers call it when they are created.
+* @return bool
+**/
+func LoadTrace() bool {
+	result := false
+	traceOnce.Do(func() {
+		result = trace.Load()
+		if result {
+			utility.OnShutdown(trace.Shutdown)
+		}
+	})
+
+	return result
+}
+
 const (
 	TELEMETRY                                   = "telemetry"
 	TELEMETRY_LOG                               = "telemetry:log"
@@ -50,6 +79,15 @@ func (rw *ResponseWriterWrapper) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+/**
+* Unwrap: Returns the underlying writer, so http.ResponseController reaches its
+* Flush and Hijack.
+* @return http.ResponseWriter
+**/
+func (rw *ResponseWriterWrapper) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 /**
 * Write: Delegates to the underlying writer and accumulates the bytes written.
 * @param b []byte
@@ -90,8 +128,12 @@ type Metrics struct {
 	ResponseSize int `json:"response_size"`
 	// user_agent.original
 	UserAgent string `json:"user_agent"`
-	// trace_id — from X-Trace-ID or X-Request-ID header
+	// trace_id — from traceparent, X-Trace-ID or X-Request-ID header
 	TraceID string `json:"trace_id"`
+	// request.id — X-Trace-ID or X-Request-ID header as received
+	RequestID string `json:"request_id"`
+	// span_id — span of this request, sent as parent on outbound calls
+	SpanID string `json:"span_id"`
 	// app_name — client application identifier (AppName header)
 	AppName string `json:"app_name"`
 	// Search/query phase duration in milliseconds
@@ -104,8 +146,11 @@ type Metrics struct {
 	OverLimit bool `json:"over_limit"`
 
 	key     string
+	route   string
 	mark    time.Time
 	metrics Telemetry
+	span    trace.Span
+	record  *trace.Record
 }
 
 /**
@@ -127,6 +172,8 @@ func (s *Metrics) ToJson() et.Json {
 		"response_size":    s.ResponseSize,
 		"user_agent":       s.UserAgent,
 		"trace_id":         s.TraceID,
+		"request_id":       s.RequestID,
+		"span_id":          s.SpanID,
 		"app_name":         s.AppName,
 		"search_time_ms":   s.SearchTime,
 		"response_time_ms": s.ResponseTime,
@@ -210,21 +257,126 @@ func PushTokenLastUse(data et.Json) {
 	go event.Publish(TELEMETRY_TOKEN_LAST_USE, data)
 }
 
+var (
+	trustedOnce    sync.Once
+	trustedProxies []*net.IPNet
+)
+
+/**
+* SetTrustedProxies: Sets the proxies allowed to report the client address through
+* X-Forwarded-For and X-Real-IP. Accepts IPs and CIDR ranges; invalid entries are skipped.
+* Defaults to the comma separated TRUSTED_PROXIES variable.
+* @param proxies []string
+**/
+func SetTrustedProxies(proxies []string) {
+	trustedOnce.Do(func() {})
+	trustedProxies = parseProxies(proxies)
+}
+
+/**
+* parseProxies: Parses a list of IPs and CIDR ranges.
+* @param proxies []string
+* @return []*net.IPNet
+**/
+func parseProxies(proxies []string) []*net.IPNet {
+	result := []*net.IPNet{}
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			result = append(result, network)
+		}
+	}
+	return result
+}
+
+/**
+* isTrustedProxy: Returns true when ip belongs to one of the trusted proxies.
+* @param ip string
+* @return bool
+**/
+func isTrustedProxy(ip string) bool {
+	trustedOnce.Do(func() {
+		proxies := envar.GetStr("TRUSTED_PROXIES", "")
+		if proxies == "" {
+			return
+		}
+		trustedProxies = parseProxies(strs.Split(proxies, ","))
+	})
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+* remoteHost: Returns the host of a RemoteAddr, without the port.
+* @param addr string
+* @return string
+**/
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+/**
+* ClientAddress: Returns the originating client IP of the request.
+* X-Forwarded-For and X-Real-IP are only honored when the peer is a trusted proxy;
+* the forwarded chain is walked from the right, skipping the trusted hops.
+* @param r *http.Request
+* @return string
+**/
+func ClientAddress(r *http.Request) string {
+	remote := remoteHost(r.RemoteAddr)
+	if !isTrustedProxy(remote) {
+		return remote
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strs.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+			if i == 0 || !isTrustedProxy(hop) {
+				return hop
+			}
+		}
+	}
+	if realIp := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIp != "" {
+		return realIp
+	}
+
+	return remote
+}
+
 /**
 * NewMetric: Creates a Metrics instance populated from the incoming HTTP request.
-* Client IP resolution order: X-Forwarded-For → X-Real-IP → RemoteAddr.
 * @param r *http.Request
 * @return *Metrics
 **/
 func NewMetric(r *http.Request) *Metrics {
-	clientAddr := r.Header.Get("X-Forwarded-For")
-	if clientAddr == "" {
-		clientAddr = r.Header.Get("X-Real-IP")
-	}
-	if clientAddr == "" {
-		clientAddr = r.RemoteAddr
-	}
-	clientAddr = strs.Split(clientAddr, ",")[0]
+	clientAddr := ClientAddress(r)
 
 	serviceId := r.Header.Get("ServiceId")
 	if serviceId == "" {
@@ -232,10 +384,7 @@ func NewMetric(r *http.Request) *Metrics {
 		r.Header.Set("ServiceId", serviceId)
 	}
 
-	traceID := r.Header.Get("X-Trace-ID")
-	if traceID == "" {
-		traceID = r.Header.Get("X-Request-ID")
-	}
+	span := trace.Extract(r.Header)
 
 	appName := r.Header.Get("AppName")
 	if appName == "" {
@@ -258,10 +407,14 @@ func NewMetric(r *http.Request) *Metrics {
 		Path:          r.URL.Path,
 		Query:         r.URL.RawQuery,
 		UserAgent:     r.UserAgent(),
-		TraceID:       traceID,
+		TraceID:       span.TraceId,
+		SpanID:        span.SpanId,
+		RequestID:     trace.LegacyId(r.Header),
 		AppName:       appName,
 		RequestSize:   int(r.ContentLength),
 		mark:          now,
+		span:          span,
+		record:        trace.Begin(span, r.Method, trace.KindServer),
 		key:           fmt.Sprintf(`%s:%s`, r.Method, r.URL.Path),
 	}
 	result.metrics = result.CallMetrics()
@@ -275,19 +428,43 @@ func NewMetric(r *http.Request) *Metrics {
 **/
 func NewRpcMetric(method string) *Metrics {
 	now := timezone.Now()
+	span := trace.New()
 	result := &Metrics{
 		TimeStamp: now,
 		ServiceId: utility.UUID(),
 		Scheme:    "rpc",
 		Method:    "RPC",
 		Path:      method,
+		TraceID:   span.TraceId,
+		SpanID:    span.SpanId,
 		mark:      now,
+		route:     method,
 		key:       fmt.Sprintf(`RPC:%s`, method),
+		span:      span,
+		record:    trace.Begin(span, method, trace.KindServer),
 	}
 	result.metrics = result.CallMetrics()
 	return result
 }
 
+/**
+* Span: Returns the trace span of the request.
+* @return trace.Span
+**/
+func (s *Metrics) Span() trace.Span {
+	return s.span
+}
+
+/**
+* WithContext: Returns ctx holding the metrics and the trace span of the request.
+* @param ctx context.Context
+* @return context.Context
+**/
+func (s *Metrics) WithContext(ctx context.Context) context.Context {
+	ctx = trace.WithContext(ctx, s.span)
+	return context.WithValue(ctx, MetricKey, s)
+}
+
 /**
 * setRequest: Adds or removes the request key from the in-flight tracking list.
 * @param remove bool
@@ -310,6 +487,7 @@ func (s *Metrics) SetPath(val string) {
 		return
 	}
 	s.Path = val
+	s.route = val
 	s.setRequest(false)
 }
 
@@ -362,6 +540,53 @@ func (s *Metrics) CallMetrics() Telemetry {
 	return result
 }
 
+/**
+* export: Finishes the server span and records the request in the histograms. The
+* route is the matched template, "unmatched" when no route was matched, so the raw
+* path never becomes a label.
+**/
+func (s *Metrics) export() {
+	route := s.route
+	if route == "" {
+		route = "unmatched"
+	}
+
+	attrs := map[string]any{
+		"http.request.method":       s.Method,
+		"http.route":                route,
+		"http.response.status_code": s.StatusCode,
+	}
+	durationHistogram.Record(s.Latency, attrs)
+	requestHistogram.Record(float64(max(s.RequestSize, 0)), attrs)
+	responseHistogram.Record(float64(s.ResponseSize), attrs)
+
+	if s.record == nil {
+		return
+	}
+
+	s.record.Name = fmt.Sprintf("%s %s", s.Method, route)
+	s.record.SetStart(s.TimeStamp).
+		Set("http.request.method", s.Method).
+		Set("http.route", route).
+		Set("url.path", s.Path).
+		Set("url.scheme", s.Scheme).
+		Set("url.query", s.Query).
+		Set("client.address", s.ClientAddress).
+		Set("server.address", s.ServerAddress).
+		Set("user_agent.original", s.UserAgent).
+		Set("http.response.status_code", s.StatusCode).
+		Set("http.response.body.size", s.ResponseSize).
+		Set("service_id", s.ServiceId).
+		Set("app_name", s.AppName)
+	if s.RequestID != "" {
+		s.record.Set("request.id", s.RequestID)
+	}
+	if s.StatusCode >= 500 {
+		s.record.Error(errors.New(http.StatusText(s.StatusCode)))
+	}
+	s.record.Finish()
+}
+
 /**
 * logRequest: Prints a color-coded summary line to stdout and publishes the log event.
 * @return et.Json
@@ -419,6 +644,9 @@ func (s *Metrics) logRequest() et.Json {
 	if s.TraceID != "" {
 		lg.Color(w, lg.Cyan, " [TraceId]:%s", s.TraceID)
 	}
+	if s.RequestID != "" && s.RequestID != s.TraceID {
+		lg.Color(w, lg.Cyan, " [RequestId]:%s", s.RequestID)
+	}
 	lg.Color(w, lg.White, " [App]:%s", s.AppName)
 	println(*w)
 
@@ -459,6 +687,7 @@ func (s *Metrics) DoneHTTP(rw *ResponseWriterWrapper) et.Json {
 	s.ResponseSize = rw.Size
 	s.CallResponseTime()
 	s.CallLatency()
+	s.export()
 	s.logRequest()
 	return s.telemetry()
 }
@@ -495,6 +724,7 @@ func (s *Metrics) DoneRpc(r any) et.Json {
 	s.StatusCode = http.StatusOK
 	s.CallResponseTime()
 	s.CallLatency()
+	s.export()
 	s.logRequest()
 	return s.telemetry()
 }
@@ -98,6 +98,11 @@ var (
 	MSG_INSTANCE_RESTARTED             = "Instance restarted"
 	MSG_INSTANCE_NOT_FOUND             = "instance not found"
 	MSG_STORE_IS_REQUIRED              = "store is required"
+	MSG_RATE_LIMIT_INVALID_REPLY       = "rate limit invalid reply key:%s"
+	MSG_RATE_LIMIT_EXCEEDED            = "rate limit exceeded"
+	MSG_JETSTREAM_NOT_AVAILABLE        = "jetstream not available on broker:%s"
+	MSG_SCHEMA_NO_CONVERTER            = "schema:%s has no converter from version %d to %d"
+	MSG_SCHEMA_MISMATCH                = "schema:%s can not decode a message of schema:%s"
 )
 
 func init() {
@@ -199,5 +204,10 @@ func init() {
 		MSG_INSTANCE_RESTARTED = "Instancia reiniciada"
 		MSG_INSTANCE_NOT_FOUND = "instancia no encontrada"
 		MSG_STORE_IS_REQUIRED = "store es requerido"
+		MSG_RATE_LIMIT_INVALID_REPLY = "respuesta inválida del límite de peticiones clave:%s"
+		MSG_RATE_LIMIT_EXCEEDED = "límite de peticiones excedido"
+		MSG_JETSTREAM_NOT_AVAILABLE = "jetstream no disponible en el broker:%s"
+		MSG_SCHEMA_NO_CONVERTER = "el esquema:%s no tiene conversor de la versión %d a la %d"
+		MSG_SCHEMA_MISMATCH = "el esquema:%s no puede decodificar un mensaje del esquema:%s"
 	}
 }
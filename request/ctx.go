@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/trace"
 )
 
 type ContextKey string
@@ -158,6 +159,20 @@ func ProfileId(r *http.Request) string {
 	return ProfileIdKey.String(ctx, "")
 }
 
+/**
+* TraceId
+* @param r *http.Request
+* @return string
+**/
+func TraceId(r *http.Request) string {
+	span, ok := trace.FromContext(r.Context())
+	if !ok {
+		return ""
+	}
+
+	return span.TraceId
+}
+
 /**
 * SetDuration
 * @param ctx context.Context, duration time.Duration
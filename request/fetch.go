@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/cgalvisleon/et/et"
+	"github.com/cgalvisleon/et/trace"
 	"github.com/cgalvisleon/et/utility"
 )
 
@@ -50,7 +51,8 @@ var StreamClient = &http.Client{
 }
 
 /**
-* HttpWithContext: Ejecuta un request HTTP propagando el context del caller.
+* HttpWithContext: Ejecuta un request HTTP propagando el context del caller,
+* incluido su traceparent.
 * @param ctx context.Context
 * @param method string
 * @param url string
@@ -83,6 +85,15 @@ func HttpWithContext(ctx context.Context, method, url string, header, body et.Js
 		req.Header.Set(k, v.(string))
 	}
 
+	ctx, record := trace.Start(ctx, method, trace.KindClient)
+	record.Set("http.request.method", method).Set("url.full", url)
+	defer record.Finish()
+	if req.Header.Get(trace.HEADER) == "" {
+		if span, ok := trace.FromContext(ctx); ok {
+			trace.Inject(req.Header, span)
+		}
+	}
+
 	client := defaultClient
 	if tlsConfig != nil {
 		client = &http.Client{
@@ -99,6 +110,7 @@ func HttpWithContext(ctx context.Context, method, url string, header, body et.Js
 	}
 
 	res, err := client.Do(req)
+	record.Error(err)
 	if err != nil {
 		return nil, Status{
 			Ok:      false,
@@ -117,6 +129,11 @@ func HttpWithContext(ctx context.Context, method, url string, header, body et.Js
 		}
 	}
 
+	record.Set("http.response.status_code", res.StatusCode)
+	if res.StatusCode >= 500 {
+		record.Error(errors.New(res.Status))
+	}
+
 	return result, Status{
 		Ok:      statusOk(res.StatusCode),
 		Code:    res.StatusCode,
@@ -146,6 +163,15 @@ func Fetch(method, url string, header, body et.Json) (*Body, Status) {
 	return Http(method, url, header, body, nil)
 }
 
+/**
+* FetchContext: Fetch propagando el context y el traceparent del caller.
+* @param ctx context.Context, method, url string, header, body et.Json
+* @return *Body, Status
+**/
+func FetchContext(ctx context.Context, method, url string, header, body et.Json) (*Body, Status) {
+	return HttpWithContext(ctx, method, url, header, body, nil)
+}
+
 /**
 * Post
 * @param url string, header, body et.Json
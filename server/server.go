@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cgalvisleon/et/logs"
+	"github.com/cgalvisleon/et/middleware"
 	"github.com/cgalvisleon/et/response"
 	"github.com/cgalvisleon/et/utility"
 	"github.com/dimiro1/banner"
@@ -32,6 +33,7 @@ type Ettp struct {
 * @return *Ettp
 **/
 func New(name string, port int) *Ettp {
+	middleware.LoadTrace()
 	result := &Ettp{
 		port:    port,
 		pidFile: ".pid",
@@ -18,6 +18,7 @@ import (
 	"github.com/cgalvisleon/et/msg"
 	"github.com/cgalvisleon/et/reg"
 	"github.com/cgalvisleon/et/timezone"
+	"github.com/cgalvisleon/et/trace"
 )
 
 type Status string
@@ -482,11 +483,21 @@ func (s *Client) Send(ms *Message) error {
 * @return *Response
 **/
 func (s *Client) Request(method string, args ...any) *Response {
+	return s.RequestContext(context.Background(), method, args...)
+}
+
+/**
+* RequestContext: Request carrying the traceparent of ctx.
+* @param ctx context.Context, method string, args ...any
+* @return *Response
+**/
+func (s *Client) RequestContext(ctx context.Context, method string, args ...any) *Response {
 	m, err := NewMessage(Method, "")
 	if err != nil {
 		return TcpError(err)
 	}
 	m.Method = method
+	m.Trace = trace.Traceparent(ctx)
 	m.Timeout = s.timeout
 	for _, arg := range args {
 		m.Args = append(m.Args, arg)
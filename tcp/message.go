@@ -2,6 +2,7 @@ package tcp
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -11,6 +12,7 @@ import (
 	"github.com/cgalvisleon/et/et"
 	"github.com/cgalvisleon/et/msg"
 	"github.com/cgalvisleon/et/reg"
+	"github.com/cgalvisleon/et/trace"
 )
 
 type TpMessage int
@@ -158,6 +160,8 @@ type Message struct {
 	Args       []any         `json:"args"`
 	IsResponse bool          `json:"is_response"`
 	Timeout    time.Duration `json:"timeout"`
+	Trace      string        `json:"traceparent,omitempty"`
+	span       trace.Span
 }
 
 /**
@@ -240,6 +244,19 @@ func (s *Message) GetArgs(dest ...any) error {
 	return nil
 }
 
+/**
+* Context: Returns a context holding the span of the handler, child of the
+* span that sent the message or a new trace when it carries none.
+* @return context.Context
+**/
+func (s *Message) Context() context.Context {
+	if !s.span.IsValid() {
+		s.span = trace.FromParent(s.Trace)
+	}
+
+	return trace.WithContext(context.Background(), s.span)
+}
+
 /**
 * Response
 * @return *Response
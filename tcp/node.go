@@ -22,6 +22,7 @@ import (
 	"github.com/cgalvisleon/et/file"
 	"github.com/cgalvisleon/et/logs"
 	mg "github.com/cgalvisleon/et/msg"
+	"github.com/cgalvisleon/et/trace"
 )
 
 type Mode int
@@ -78,6 +79,7 @@ type Node struct {
 	onSend         []func(*Msg)             `json:"-"`
 	onBecomeLeader []func(*Node)            `json:"-"`
 	onChangeLeader []func(*Node)            `json:"-"`
+	onPeerConnect  []func(*Client)          `json:"-"`
 	index          atomic.Uint64            `json:"-"`
 	total          atomic.Int64             `json:"-"`
 }
@@ -121,6 +123,7 @@ func NewNode(port int, tlsConfig ...*tls.Config) *Node {
 		onSend:         make([]func(*Msg), 0),
 		onBecomeLeader: make([]func(*Node), 0),
 		onChangeLeader: make([]func(*Node), 0),
+		onPeerConnect:  make([]func(*Client), 0),
 	}
 	result.mode.Store(Follower)
 	result.Mount(newTcpService(result))
@@ -659,6 +662,14 @@ func (s *Node) Close() error {
 	return nil
 }
 
+/**
+* Addr
+* @return string
+**/
+func (s *Node) Addr() string {
+	return s.addr
+}
+
 /**
 * LeaderID
 * @return string, bool
@@ -681,6 +692,11 @@ func (s *Node) AddNode(addr string) {
 	node.isNode = true
 	node.onConnect = append(node.onConnect, func(c *Client) {
 		s.total.Add(1)
+		go func() {
+			for _, fn := range s.onPeerConnect {
+				fn(c)
+			}
+		}()
 	})
 	node.onDisconnect = append(node.onDisconnect, func(c *Client) {
 		s.total.Add(-1)
@@ -763,11 +779,21 @@ func (s *Node) GetMethods() et.Json {
 * @return *Response
 **/
 func (s *Node) Request(to *Client, method string, args ...any) *Response {
+	return s.RequestContext(context.Background(), to, method, args...)
+}
+
+/**
+* RequestContext: Request carrying the traceparent of ctx.
+* @param ctx context.Context, to *Client, method string, args ...any
+* @return *Response
+**/
+func (s *Node) RequestContext(ctx context.Context, to *Client, method string, args ...any) *Response {
 	msg, err := NewMessage(Method, "")
 	if err != nil {
 		return TcpError(err)
 	}
 	msg.Method = method
+	msg.Trace = trace.Traceparent(ctx)
 	for _, arg := range args {
 		msg.Args = append(msg.Args, arg)
 	}
@@ -901,3 +927,11 @@ func (s *Node) OnBecomeLeader(fn func(*Node)) {
 func (s *Node) OnChangeLeader(fn func(*Node)) {
 	s.onChangeLeader = append(s.onChangeLeader, fn)
 }
+
+/**
+* OnPeerConnect: Runs fn once the connection to a cluster peer is established.
+* @param fn func(*Client)
+**/
+func (s *Node) OnPeerConnect(fn func(*Client)) {
+	s.onPeerConnect = append(s.onPeerConnect, fn)
+}
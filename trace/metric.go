@@ -0,0 +1,143 @@
+package trace
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	DurationBounds = []float64{5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+	SizeBounds     = []float64{128, 512, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+	histograms     = map[string]*Histogram{}
+	histogramsMu   sync.Mutex
+	// MaxSeries caps the attribute sets of a histogram, the rest are recorded as overflow
+	MaxSeries = 2000
+	overflow  = map[string]any{"otel.metric.overflow": true}
+)
+
+type point struct {
+	attrs   map[string]any
+	count   uint64
+	sum     float64
+	min     float64
+	max     float64
+	buckets []uint64
+}
+
+/**
+* Histogram: Cumulative distribution of values by attribute set, exported with
+* the spans while the exporter is running.
+**/
+type Histogram struct {
+	Name        string
+	Unit        string
+	Description string
+	bounds      []float64
+	start       time.Time
+	points      map[string]*point
+	mu          sync.Mutex
+}
+
+/**
+* NewHistogram: Returns the histogram registered as name, creating it with bounds.
+* @param name, unit, description string, bounds []float64
+* @return *Histogram
+**/
+func NewHistogram(name, unit, description string, bounds []float64) *Histogram {
+	histogramsMu.Lock()
+	defer histogramsMu.Unlock()
+
+	if result, ok := histograms[name]; ok {
+		return result
+	}
+
+	result := &Histogram{
+		Name:        name,
+		Unit:        unit,
+		Description: description,
+		bounds:      bounds,
+		start:       time.Now(),
+		points:      map[string]*point{},
+	}
+	histograms[name] = result
+	return result
+}
+
+/**
+* attrsKey: Identifies an attribute set regardless of the map order.
+* @param attrs map[string]any
+* @return string
+**/
+func attrsKey(attrs map[string]any) string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%v;", k, attrs[k])
+	}
+
+	return b.String()
+}
+
+/**
+* Record: Adds val to the distribution of attrs. Once the histogram holds MaxSeries
+* attribute sets, new ones go to a single overflow set.
+* @param val float64, attrs map[string]any
+**/
+func (s *Histogram) Record(val float64, attrs map[string]any) {
+	if !Enabled() {
+		return
+	}
+
+	key := attrsKey(attrs)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.points[key]
+	if !ok && len(s.points) >= MaxSeries {
+		attrs = overflow
+		key = attrsKey(attrs)
+		p, ok = s.points[key]
+	}
+	if !ok {
+		p = &point{
+			attrs:   attrs,
+			min:     val,
+			max:     val,
+			buckets: make([]uint64, len(s.bounds)+1),
+		}
+		s.points[key] = p
+	}
+
+	idx := sort.SearchFloat64s(s.bounds, val)
+	p.buckets[idx]++
+	p.count++
+	p.sum += val
+	p.min = min(p.min, val)
+	p.max = max(p.max, val)
+}
+
+/**
+* snapshot: Copies the points so they can be encoded outside the lock.
+* @return []point
+**/
+func (s *Histogram) snapshot() []point {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]point, 0, len(s.points))
+	for _, p := range s.points {
+		item := *p
+		item.buckets = append([]uint64{}, p.buckets...)
+		result = append(result, item)
+	}
+
+	return result
+}
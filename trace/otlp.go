@@ -0,0 +1,402 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cgalvisleon/et/envar"
+	"github.com/cgalvisleon/et/stdrout"
+)
+
+const scopeName = "github.com/cgalvisleon/et"
+
+var exporter = &otlpExporter{}
+
+/**
+* Config: OTLP/HTTP collector the spans and histograms are sent to.
+**/
+type Config struct {
+	Endpoint    string
+	ServiceName string
+	Headers     map[string]string
+	Interval    time.Duration
+	MaxQueue    int
+}
+
+type otlpExporter struct {
+	config  Config
+	enabled atomic.Bool
+	queue   []*Record
+	dropped atomic.Int64
+	client  *http.Client
+	stop    chan struct{}
+	done    chan struct{}
+	mu      sync.Mutex
+}
+
+/**
+* Enabled: Reports whether the exporter is running.
+* @return bool
+**/
+func Enabled() bool {
+	return exporter.enabled.Load()
+}
+
+/**
+* Export: Starts sending spans and histograms to the collector of config.
+* Endpoint is the collector base url, for example http://localhost:4318.
+* @param config Config
+**/
+func Export(config Config) {
+	Shutdown()
+
+	if config.ServiceName == "" {
+		config.ServiceName, _ = os.Hostname()
+	}
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Second
+	}
+	if config.MaxQueue <= 0 {
+		config.MaxQueue = 2048
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+
+	exporter.mu.Lock()
+	exporter.config = config
+	exporter.queue = []*Record{}
+	exporter.client = &http.Client{Timeout: 10 * time.Second}
+	exporter.stop = make(chan struct{})
+	exporter.done = make(chan struct{})
+	exporter.mu.Unlock()
+
+	exporter.enabled.Store(true)
+	go exporter.run(exporter.stop, exporter.done)
+}
+
+/**
+* Load: Starts the exporter from OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_SERVICE_NAME,
+* OTEL_EXPORTER_OTLP_HEADERS (k=v,k=v) and OTEL_EXPORT_INTERVAL (ms). Without endpoint it does nothing.
+* @return bool
+**/
+func Load() bool {
+	endpoint := envar.GetStr("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	if endpoint == "" {
+		return false
+	}
+
+	headers := map[string]string{}
+	for _, pair := range strings.Split(envar.GetStr("OTEL_EXPORTER_OTLP_HEADERS", ""), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if ok {
+			headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+
+	Export(Config{
+		Endpoint:    endpoint,
+		ServiceName: envar.GetStr("OTEL_SERVICE_NAME", ""),
+		Headers:     headers,
+		Interval:    time.Duration(envar.GetInt("OTEL_EXPORT_INTERVAL", 5000)) * time.Millisecond,
+	})
+	return true
+}
+
+/**
+* Shutdown: Sends what is pending and stops the exporter.
+**/
+func Shutdown() {
+	if !exporter.enabled.Swap(false) {
+		return
+	}
+
+	close(exporter.stop)
+	<-exporter.done
+}
+
+/**
+* Flush: Sends the pending spans and the histograms now.
+* @return error
+**/
+func Flush() error {
+	if !Enabled() {
+		return nil
+	}
+
+	return exporter.flush()
+}
+
+/**
+* push: Queues a finished record, dropping it when the queue is full.
+* @param rec *Record
+**/
+func (s *otlpExporter) push(rec *Record) {
+	if !s.enabled.Load() {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) >= s.config.MaxQueue {
+		s.dropped.Add(1)
+		return
+	}
+	s.queue = append(s.queue, rec)
+}
+
+/**
+* run
+* @param stop, done chan struct{}
+**/
+func (s *otlpExporter) run(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			s.flush()
+			return
+		case <-ticker.C:
+			if err := s.flush(); err != nil {
+				stdrout.Printl("Otel", "Yellow", err.Error())
+			}
+		}
+	}
+}
+
+/**
+* flush
+* @return error
+**/
+func (s *otlpExporter) flush() error {
+	s.mu.Lock()
+	records := s.queue
+	s.queue = []*Record{}
+	config := s.config
+	s.mu.Unlock()
+
+	if n := s.dropped.Swap(0); n > 0 {
+		stdrout.Printl("Otel", "Yellow", fmt.Sprintf("queue full, %d spans dropped", n))
+	}
+
+	if len(records) > 0 {
+		if err := s.post(config, "/v1/traces", tracesPayload(config, records)); err != nil {
+			return err
+		}
+	}
+
+	payload := metricsPayload(config)
+	if payload == nil {
+		return nil
+	}
+
+	return s.post(config, "/v1/metrics", payload)
+}
+
+/**
+* post
+* @param config Config, path string, payload any
+* @return error
+**/
+func (s *otlpExporter) post(config Config, path string, payload any) error {
+	bt, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, config.Endpoint+path, bytes.NewReader(bt))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("otlp %s status:%d", path, res.StatusCode)
+	}
+
+	return nil
+}
+
+/**
+* anyValue: Encodes val as an OTLP AnyValue.
+* @param val any
+* @return map[string]any
+**/
+func anyValue(val any) map[string]any {
+	switch v := val.(type) {
+	case string:
+		return map[string]any{"stringValue": v}
+	case bool:
+		return map[string]any{"boolValue": v}
+	case int:
+		return map[string]any{"intValue": strconv.Itoa(v)}
+	case int64:
+		return map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]any{"doubleValue": v}
+	default:
+		return map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+}
+
+/**
+* attributes
+* @param attrs map[string]any
+* @return []map[string]any
+**/
+func attributes(attrs map[string]any) []map[string]any {
+	result := make([]map[string]any, 0, len(attrs))
+	for k, v := range attrs {
+		result = append(result, map[string]any{"key": k, "value": anyValue(v)})
+	}
+
+	return result
+}
+
+/**
+* resource
+* @param config Config
+* @return map[string]any
+**/
+func resource(config Config) map[string]any {
+	return map[string]any{
+		"attributes": attributes(map[string]any{"service.name": config.ServiceName}),
+	}
+}
+
+/**
+* nanos
+* @param t time.Time
+* @return string
+**/
+func nanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+/**
+* tracesPayload: ExportTraceServiceRequest in OTLP JSON.
+* @param config Config, records []*Record
+* @return map[string]any
+**/
+func tracesPayload(config Config, records []*Record) map[string]any {
+	spans := make([]map[string]any, 0, len(records))
+	for _, rec := range records {
+		status := map[string]any{"code": 1}
+		if rec.Failed {
+			status = map[string]any{"code": 2, "message": rec.Message}
+		}
+
+		span := map[string]any{
+			"traceId":           rec.Span.TraceId,
+			"spanId":            rec.Span.SpanId,
+			"name":              rec.Name,
+			"kind":              int(rec.Kind),
+			"startTimeUnixNano": nanos(rec.Start),
+			"endTimeUnixNano":   nanos(rec.End),
+			"attributes":        attributes(rec.Attrs),
+			"status":            status,
+		}
+		if rec.Span.ParentId != "" {
+			span["parentSpanId"] = rec.Span.ParentId
+		}
+		spans = append(spans, span)
+	}
+
+	return map[string]any{
+		"resourceSpans": []map[string]any{{
+			"resource": resource(config),
+			"scopeSpans": []map[string]any{{
+				"scope": map[string]any{"name": scopeName},
+				"spans": spans,
+			}},
+		}},
+	}
+}
+
+/**
+* metricsPayload: ExportMetricsServiceRequest in OTLP JSON with cumulative
+* histograms, nil when nothing was recorded.
+* @param config Config
+* @return map[string]any
+**/
+func metricsPayload(config Config) map[string]any {
+	histogramsMu.Lock()
+	items := make([]*Histogram, 0, len(histograms))
+	for _, h := range histograms {
+		items = append(items, h)
+	}
+	histogramsMu.Unlock()
+
+	now := time.Now()
+	metrics := []map[string]any{}
+	for _, h := range items {
+		points := h.snapshot()
+		if len(points) == 0 {
+			continue
+		}
+
+		dataPoints := make([]map[string]any, 0, len(points))
+		for _, p := range points {
+			buckets := make([]string, len(p.buckets))
+			for i, n := range p.buckets {
+				buckets[i] = strconv.FormatUint(n, 10)
+			}
+
+			dataPoints = append(dataPoints, map[string]any{
+				"attributes":        attributes(p.attrs),
+				"startTimeUnixNano": nanos(h.start),
+				"timeUnixNano":      nanos(now),
+				"count":             strconv.FormatUint(p.count, 10),
+				"sum":               p.sum,
+				"min":               p.min,
+				"max":               p.max,
+				"bucketCounts":      buckets,
+				"explicitBounds":    h.bounds,
+			})
+		}
+
+		metrics = append(metrics, map[string]any{
+			"name":        h.Name,
+			"unit":        h.Unit,
+			"description": h.Description,
+			"histogram": map[string]any{
+				"aggregationTemporality": 2,
+				"dataPoints":             dataPoints,
+			},
+		})
+	}
+
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	return map[string]any{
+		"resourceMetrics": []map[string]any{{
+			"resource": resource(config),
+			"scopeMetrics": []map[string]any{{
+				"scope":   map[string]any{"name": scopeName},
+				"metrics": metrics,
+			}},
+		}},
+	}
+}
@@ -0,0 +1,127 @@
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+/**
+* collector: OTLP/HTTP endpoint keeping the payloads posted by path.
+**/
+type collector struct {
+	payloads map[string][]map[string]any
+	headers  http.Header
+	mu       sync.Mutex
+}
+
+func (s *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bt, _ := io.ReadAll(r.Body)
+	payload := map[string]any{}
+	json.Unmarshal(bt, &payload)
+
+	s.mu.Lock()
+	s.payloads[r.URL.Path] = append(s.payloads[r.URL.Path], payload)
+	s.headers = r.Header.Clone()
+	s.mu.Unlock()
+}
+
+func TestExport(t *testing.T) {
+	c := &collector{payloads: map[string][]map[string]any{}}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	Export(Config{Endpoint: server.URL + "/", ServiceName: "test", Headers: map[string]string{"Authorization": "Bearer x"}, Interval: time.Hour})
+	defer Shutdown()
+
+	root := New()
+	Begin(root, "GET /items", KindServer).Set("http.status_code", 200).Finish()
+	Begin(root.Child(), "select", KindClient).Error(errors.New("failed")).Finish()
+	Begin(Span{TraceId: root.TraceId, SpanId: root.SpanId}, "not sampled", KindInternal).Finish()
+	NewHistogram("test.export.duration", "ms", "Test", DurationBounds).Record(12, map[string]any{"route": "/items"})
+
+	if err := Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.headers.Get("Authorization") != "Bearer x" {
+		t.Errorf("headers = %v", c.headers)
+	}
+
+	traces := c.payloads["/v1/traces"]
+	if len(traces) != 1 {
+		t.Fatalf("got %d trace payloads", len(traces))
+	}
+	bt, _ := json.Marshal(traces[0])
+	var request struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceId      string `json:"traceId"`
+					ParentSpanId string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Kind         int    `json:"kind"`
+					Status       struct {
+						Code int `json:"code"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	json.Unmarshal(bt, &request)
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want the 2 sampled ones", len(spans))
+	}
+	if spans[0].Name != "GET /items" || spans[0].Kind != int(KindServer) || spans[0].Status.Code != 1 {
+		t.Errorf("server span = %+v", spans[0])
+	}
+	if spans[1].ParentSpanId != root.SpanId || spans[1].Status.Code != 2 {
+		t.Errorf("client span = %+v", spans[1])
+	}
+
+	if len(c.payloads["/v1/metrics"]) != 1 {
+		t.Fatalf("got %d metric payloads", len(c.payloads["/v1/metrics"]))
+	}
+}
+
+func TestHistogramSeries(t *testing.T) {
+	Export(Config{Endpoint: "http://127.0.0.1:1", Interval: time.Hour})
+	defer Shutdown()
+
+	previous := MaxSeries
+	MaxSeries = 3
+	defer func() { MaxSeries = previous }()
+
+	h := NewHistogram(fmt.Sprintf("test.series.%d", time.Now().UnixNano()), "ms", "Test", []float64{10, 100})
+	for i := 0; i < 10; i++ {
+		h.Record(float64(i*20), map[string]any{"route": fmt.Sprintf("/items/%d", i)})
+	}
+	h.Record(5, map[string]any{"route": "/items/0"})
+
+	points := h.snapshot()
+	if len(points) != 4 {
+		t.Fatalf("got %d series, want 3 and the overflow", len(points))
+	}
+
+	for _, p := range points {
+		switch {
+		case p.attrs["otel.metric.overflow"] == true:
+			if p.count != 7 {
+				t.Errorf("overflow count = %d, want 7", p.count)
+			}
+		case p.attrs["route"] == "/items/0":
+			if p.count != 2 || p.buckets[0] != 2 || p.min != 0 || p.max != 5 {
+				t.Errorf("/items/0 = %+v", p)
+			}
+		}
+	}
+}
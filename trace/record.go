@@ -0,0 +1,121 @@
+package trace
+
+import (
+	"context"
+	"time"
+)
+
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+	KindProducer SpanKind = 4
+	KindConsumer SpanKind = 5
+)
+
+/**
+* Record: Timed operation of a span, sent to the collector when it ends.
+* A nil Record is valid and ignores every call, so callers need no checks.
+**/
+type Record struct {
+	Name    string
+	Kind    SpanKind
+	Span    Span
+	Start   time.Time
+	End     time.Time
+	Attrs   map[string]any
+	Failed  bool
+	Message string
+}
+
+/**
+* Begin: Starts recording span when the exporter is running.
+* @param span Span, name string, kind SpanKind
+* @return *Record
+**/
+func Begin(span Span, name string, kind SpanKind) *Record {
+	if !Enabled() || !span.IsValid() || !span.Sampled {
+		return nil
+	}
+
+	return &Record{
+		Name:  name,
+		Kind:  kind,
+		Span:  span,
+		Start: time.Now(),
+		Attrs: map[string]any{},
+	}
+}
+
+/**
+* Start: Opens a child of the span in ctx and records it. Without span in ctx
+* nothing is recorded and ctx is returned as is.
+* @param ctx context.Context, name string, kind SpanKind
+* @return context.Context, *Record
+**/
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Record) {
+	parent, ok := FromContext(ctx)
+	if !ok || !parent.IsValid() {
+		return ctx, nil
+	}
+
+	span := parent.Child()
+	return WithContext(ctx, span), Begin(span, name, kind)
+}
+
+/**
+* SetStart: Moves the start of the record, for operations measured elsewhere.
+* @param at time.Time
+* @return *Record
+**/
+func (s *Record) SetStart(at time.Time) *Record {
+	if s == nil {
+		return nil
+	}
+
+	s.Start = at
+	return s
+}
+
+/**
+* Set: Adds an attribute.
+* @param key string, val any
+* @return *Record
+**/
+func (s *Record) Set(key string, val any) *Record {
+	if s == nil {
+		return nil
+	}
+
+	s.Attrs[key] = val
+	return s
+}
+
+/**
+* Error: Marks the record as failed with err, nil is ignored.
+* @param err error
+* @return *Record
+**/
+func (s *Record) Error(err error) *Record {
+	if s == nil || err == nil {
+		return s
+	}
+
+	s.Failed = true
+	s.Message = err.Error()
+	return s
+}
+
+/**
+* Finish: Closes the record and queues it for export.
+**/
+func (s *Record) Finish() {
+	if s == nil {
+		return
+	}
+
+	s.End = time.Now()
+	exporter.push(s)
+}
@@ -0,0 +1,262 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type ctxKey struct{}
+
+const (
+	HEADER        = "traceparent"
+	HEADER_LEGACY = "X-Trace-ID"
+	HEADER_REQ_ID = "X-Request-ID"
+)
+
+/**
+* Span: W3C trace context of the current unit of work. ParentId is the span
+* that called it, empty for the root of the trace.
+**/
+type Span struct {
+	TraceId  string `json:"trace_id"`
+	SpanId   string `json:"span_id"`
+	ParentId string `json:"parent_id,omitempty"`
+	Sampled  bool   `json:"sampled"`
+}
+
+/**
+* randomHex
+* @param n int
+* @return string
+**/
+func randomHex(n int) string {
+	bt := make([]byte, n)
+	rand.Read(bt)
+	return hex.EncodeToString(bt)
+}
+
+/**
+* isHex: Reports whether val is a non zero lowercase hex string of length n.
+* @param val string, n int
+* @return bool
+**/
+func isHex(val string, n int) bool {
+	if len(val) != n || strings.Trim(val, "0") == "" {
+		return false
+	}
+
+	for _, c := range val {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+/**
+* New: Starts a new trace.
+* @return Span
+**/
+func New() Span {
+	return Span{
+		TraceId: randomHex(16),
+		SpanId:  randomHex(8),
+		Sampled: true,
+	}
+}
+
+/**
+* Parse: Reads a traceparent value, version-traceid-spanid-flags.
+* @param val string
+* @return Span, bool
+**/
+func Parse(val string) (Span, bool) {
+	parts := strings.Split(strings.TrimSpace(val), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return Span{}, false
+	}
+
+	if parts[0] == "00" && len(parts) != 4 {
+		return Span{}, false
+	}
+
+	if !isHex(parts[1], 32) || !isHex(parts[2], 16) || len(parts[3]) != 2 {
+		return Span{}, false
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return Span{}, false
+	}
+
+	return Span{
+		TraceId: parts[1],
+		SpanId:  parts[2],
+		Sampled: flags[0]&1 == 1,
+	}, true
+}
+
+/**
+* IsValid
+* @return bool
+**/
+func (s Span) IsValid() bool {
+	return isHex(s.TraceId, 32) && isHex(s.SpanId, 16)
+}
+
+/**
+* String: Returns the traceparent value of the span.
+* @return string
+**/
+func (s Span) String() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+
+	return fmt.Sprintf("00-%s-%s-%s", s.TraceId, s.SpanId, flags)
+}
+
+/**
+* Child: Returns a new span of the same trace called by s.
+* @return Span
+**/
+func (s Span) Child() Span {
+	if !s.IsValid() {
+		return New()
+	}
+
+	return Span{
+		TraceId:  s.TraceId,
+		SpanId:   randomHex(8),
+		ParentId: s.SpanId,
+		Sampled:  s.Sampled,
+	}
+}
+
+/**
+* FromParent: Starts the local span of a unit of work called with traceparent,
+* a new trace when the value is missing or invalid.
+* @param traceparent string
+* @return Span
+**/
+func FromParent(traceparent string) Span {
+	parent, ok := Parse(traceparent)
+	if !ok {
+		return New()
+	}
+
+	return parent.Child()
+}
+
+/**
+* Extract: Starts the local span of an inbound HTTP request. Without traceparent a
+* 32 hex X-Trace-ID or X-Request-ID is kept as the trace id.
+* @param header http.Header
+* @return Span
+**/
+func Extract(header http.Header) Span {
+	if parent, ok := Parse(header.Get(HEADER)); ok {
+		return parent.Child()
+	}
+
+	result := New()
+	for _, key := range []string{HEADER_LEGACY, HEADER_REQ_ID} {
+		id := strings.ToLower(strings.ReplaceAll(header.Get(key), "-", ""))
+		if isHex(id, 32) {
+			result.TraceId = id
+			break
+		}
+	}
+
+	return result
+}
+
+/**
+* LegacyId: Returns the X-Trace-ID or X-Request-ID of an inbound HTTP request as
+* sent, whether or not it can be the trace id.
+* @param header http.Header
+* @return string
+**/
+func LegacyId(header http.Header) string {
+	for _, key := range []string{HEADER_LEGACY, HEADER_REQ_ID} {
+		if id := header.Get(key); id != "" {
+			return id
+		}
+	}
+
+	return ""
+}
+
+/**
+* Inject: Writes span as the traceparent of an outbound HTTP request.
+* @param header http.Header, span Span
+**/
+func Inject(header http.Header, span Span) {
+	if !span.IsValid() {
+		return
+	}
+
+	header.Set(HEADER, span.String())
+}
+
+/**
+* Outbound: Returns a copy of the header of an inbound request to forward it, carrying
+* the span of ctx as traceparent; the inbound header is left as received.
+* @param ctx context.Context, header http.Header
+* @return http.Header
+**/
+func Outbound(ctx context.Context, header http.Header) http.Header {
+	result := header.Clone()
+	if result == nil {
+		result = http.Header{}
+	}
+
+	if span, ok := FromContext(ctx); ok {
+		Inject(result, span)
+	}
+
+	return result
+}
+
+/**
+* WithContext
+* @param ctx context.Context, span Span
+* @return context.Context
+**/
+func WithContext(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, ctxKey{}, span)
+}
+
+/**
+* FromContext
+* @param ctx context.Context
+* @return Span, bool
+**/
+func FromContext(ctx context.Context) (Span, bool) {
+	if ctx == nil {
+		return Span{}, false
+	}
+
+	result, ok := ctx.Value(ctxKey{}).(Span)
+	return result, ok
+}
+
+/**
+* Traceparent: Returns the traceparent to send on behalf of ctx, empty without span.
+* @param ctx context.Context
+* @return string
+**/
+func Traceparent(ctx context.Context) string {
+	span, ok := FromContext(ctx)
+	if !ok || !span.IsValid() {
+		return ""
+	}
+
+	return span.String()
+}
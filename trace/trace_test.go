@@ -0,0 +1,127 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+const (
+	testTraceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanId  = "00f067aa0ba902b7"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		val     string
+		ok      bool
+		sampled bool
+	}{
+		{name: "sampled", val: "00-" + testTraceId + "-" + testSpanId + "-01", ok: true, sampled: true},
+		{name: "not sampled", val: "00-" + testTraceId + "-" + testSpanId + "-00", ok: true},
+		{name: "surrounding spaces", val: " 00-" + testTraceId + "-" + testSpanId + "-01 ", ok: true, sampled: true},
+		{name: "future version with more fields", val: "cc-" + testTraceId + "-" + testSpanId + "-01-what", ok: true, sampled: true},
+		{name: "version 00 with more fields", val: "00-" + testTraceId + "-" + testSpanId + "-01-what"},
+		{name: "forbidden version", val: "ff-" + testTraceId + "-" + testSpanId + "-01"},
+		{name: "zero trace id", val: "00-00000000000000000000000000000000-" + testSpanId + "-01"},
+		{name: "zero span id", val: "00-" + testTraceId + "-0000000000000000-01"},
+		{name: "uppercase trace id", val: "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + testSpanId + "-01"},
+		{name: "short trace id", val: "00-4bf92f35-" + testSpanId + "-01"},
+		{name: "bad flags", val: "00-" + testTraceId + "-" + testSpanId + "-zz"},
+		{name: "empty", val: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span, ok := Parse(tt.val)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if span.TraceId != testTraceId || span.SpanId != testSpanId || span.Sampled != tt.sampled {
+				t.Fatalf("span = %+v", span)
+			}
+		})
+	}
+}
+
+func TestSpanRoundTrip(t *testing.T) {
+	span := New()
+	parsed, ok := Parse(span.String())
+	if !ok || parsed.TraceId != span.TraceId || parsed.SpanId != span.SpanId || !parsed.Sampled {
+		t.Fatalf("parsed %+v from %s", parsed, span)
+	}
+
+	child := span.Child()
+	if child.TraceId != span.TraceId || child.ParentId != span.SpanId || child.SpanId == span.SpanId {
+		t.Fatalf("child %+v of %+v", child, span)
+	}
+
+	if orphan := (Span{}).Child(); !orphan.IsValid() || orphan.ParentId != "" {
+		t.Fatalf("child of an invalid span = %+v", orphan)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		trace  string
+		parent string
+	}{
+		{name: "traceparent", header: map[string]string{HEADER: "00-" + testTraceId + "-" + testSpanId + "-01"}, trace: testTraceId, parent: testSpanId},
+		{name: "legacy trace id", header: map[string]string{HEADER_LEGACY: testTraceId}, trace: testTraceId},
+		{name: "uuid request id", header: map[string]string{HEADER_REQ_ID: "4BF92F35-77B3-4DA6-A3CE-929D0E0E4736"}, trace: testTraceId},
+		{name: "request id that is not a trace id", header: map[string]string{HEADER_REQ_ID: "req-1"}},
+		{name: "traceparent wins", header: map[string]string{HEADER: "00-" + testTraceId + "-" + testSpanId + "-01", HEADER_LEGACY: "11111111111111111111111111111111"}, trace: testTraceId, parent: testSpanId},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+
+			span := Extract(header)
+			if !span.IsValid() {
+				t.Fatalf("span %+v is not valid", span)
+			}
+			if tt.trace != "" && span.TraceId != tt.trace {
+				t.Errorf("trace = %s, want %s", span.TraceId, tt.trace)
+			}
+			if span.ParentId != tt.parent {
+				t.Errorf("parent = %s, want %s", span.ParentId, tt.parent)
+			}
+		})
+	}
+
+	header := http.Header{}
+	header.Set(HEADER_REQ_ID, "req-1")
+	if got := LegacyId(header); got != "req-1" {
+		t.Fatalf("legacy id = %q, want req-1", got)
+	}
+}
+
+func TestOutbound(t *testing.T) {
+	inbound := http.Header{}
+	inbound.Set(HEADER, "00-"+testTraceId+"-"+testSpanId+"-01")
+	inbound.Set("Accept", "application/json")
+
+	span := Extract(inbound)
+	result := Outbound(WithContext(context.Background(), span), inbound)
+	if got := result.Get(HEADER); got != span.String() {
+		t.Fatalf("outbound traceparent = %s, want %s", got, span)
+	}
+	if result.Get("Accept") != "application/json" {
+		t.Fatal("outbound header lost the inbound values")
+	}
+	if inbound.Get(HEADER) != "00-"+testTraceId+"-"+testSpanId+"-01" {
+		t.Fatal("inbound header was modified")
+	}
+
+	if got := Outbound(context.Background(), nil); got == nil || got.Get(HEADER) != "" {
+		t.Fatalf("outbound without span = %v", got)
+	}
+}
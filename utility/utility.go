@@ -45,6 +45,10 @@ const QUEUE_STACK = "stack"
 
 var locks = make(map[string]*sync.RWMutex)
 var count = make(map[string]int64)
+var shutdown = struct {
+	hooks []func()
+	mu    sync.Mutex
+}{}
 
 /**
 * App
@@ -61,12 +65,31 @@ func App() context.Context {
 }
 
 /**
-* AppWait
+* OnShutdown: Registers fn to run when AppWait receives the stop signal.
+* @param fn func()
+**/
+func OnShutdown(fn func()) {
+	shutdown.mu.Lock()
+	shutdown.hooks = append(shutdown.hooks, fn)
+	shutdown.mu.Unlock()
+}
+
+/**
+* AppWait: Blocks until an interrupt or SIGTERM and then runs the shutdown hooks in reverse order.
 **/
 func AppWait() {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
+
+	shutdown.mu.Lock()
+	hooks := shutdown.hooks
+	shutdown.hooks = nil
+	shutdown.mu.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
 }
 
 /**
@@ -104,7 +104,7 @@ func wrapperRunTime(vm *VM) {
 * @param vm *VM
 **/
 func wrapperCtx(vm *VM) {
-	vm.Set("Ctx", vm.Ctx)
+	vm.Set("Ctx", map[string]interface{}(vm.Ctx))
 }
 
 /**
@@ -1,12 +1,29 @@
 package workflow
 
+import (
+	"github.com/cgalvisleon/et/event"
+	"github.com/cgalvisleon/et/logs"
+)
+
 const (
 	EVENT_FLOW_SET        = "workflow:flow:set"
 	EVENT_FLOW_DELETE     = "workflow:flow:delete"
 	EVENT_INSTANCE_SET    = "workflow:instance:set"
 	EVENT_INSTANCE_DELETE = "workflow:instance:delete"
+	EVENT_STREAM          = "WORKFLOW"
 )
 
+/**
+* eventInit: Persists the workflow events in JetStream so they survive subscribers being down.
+**/
 func (s *WorkFlow) eventInit() {
-
+	err := event.Stream(EVENT_STREAM, []string{
+		EVENT_FLOW_SET,
+		EVENT_FLOW_DELETE,
+		EVENT_INSTANCE_SET,
+		EVENT_INSTANCE_DELETE,
+	}, event.LimitsRetention)
+	if err != nil {
+		logs.Alertf("workflow stream:%s error:%s", EVENT_STREAM, err.Error())
+	}
 }